@@ -0,0 +1,134 @@
+package codon
+
+import (
+	"math"
+	"mesim"
+	"mesim/sampler"
+	"testing"
+)
+
+// seq converts a string of nucleotide letters into a sequence.
+func seq(s string) []int {
+	nucSeq := make([]int, len(s))
+	for i := range s {
+		switch s[i] {
+		case 'A':
+			nucSeq[i] = 0
+		case 'C':
+			nucSeq[i] = 1
+		case 'G':
+			nucSeq[i] = 2
+		case 'T':
+			nucSeq[i] = 3
+		}
+	}
+	return nucSeq
+}
+
+func TestStandardTranslate(t *testing.T) {
+	nucSeq := seq("ATGTTTTGGTAATGA")
+	expected := "MFW**"
+	actual := ProteinString(Standard.TranslateSeq(nucSeq))
+	if actual != expected {
+		t.Errorf("Standard.TranslateSeq(%v): expected %s, actual %s", nucSeq, expected, actual)
+	}
+	if len(Standard.SenseCodons()) != 61 {
+		t.Errorf("Standard.SenseCodons(): expected 61 codons, actual %d", len(Standard.SenseCodons()))
+	}
+}
+
+func TestVertebrateMitochondrialTranslate(t *testing.T) {
+	gc, err := Table(2)
+	if err != nil {
+		t.Fatalf("Table(2): expected no error, actual %v", err)
+	}
+	nucSeq := seq("TGAAGAATA")
+	expected := "W*M"
+	actual := ProteinString(gc.TranslateSeq(nucSeq))
+	if actual != expected {
+		t.Errorf("Table(2).TranslateSeq(%v): expected %s, actual %s", nucSeq, expected, actual)
+	}
+	if len(gc.SenseCodons()) != 60 {
+		t.Errorf("Table(2).SenseCodons(): expected 60 codons, actual %d", len(gc.SenseCodons()))
+	}
+	if _, err := Table(7); err == nil {
+		t.Errorf("Table(7): expected error for unknown table")
+	}
+}
+
+func TestClassifySite(t *testing.T) {
+	nucSeq := seq("TTTTGG")
+	cases := []struct {
+		site     int
+		newChar  int
+		expected MutationClass
+	}{
+		{2, 1, Synonymous},    // TTT -> TTC, F -> F
+		{2, 0, Nonsynonymous}, // TTT -> TTA, F -> L
+		{5, 0, Nonsense},      // TGG -> TGA, W -> *
+	}
+	for _, c := range cases {
+		actual := Standard.ClassifySite(nucSeq, c.site, c.newChar)
+		if actual != c.expected {
+			t.Errorf("Standard.ClassifySite(%v, %d, %d): expected %v, actual %v", nucSeq, c.site, c.newChar, c.expected, actual)
+		}
+	}
+}
+
+func TestSites(t *testing.T) {
+	synSites, nonsynSites := Standard.Sites(seq("TTT"))
+	if math.Abs(synSites-1.0/3) > 1e-12 || math.Abs(nonsynSites-8.0/3) > 1e-12 {
+		t.Errorf("Standard.Sites(TTT): expected 1/3 and 8/3, actual %v and %v", synSites, nonsynSites)
+	}
+}
+
+func TestMutationCounter(t *testing.T) {
+	seqSpace := make([][]int, 50)
+	for i := range seqSpace {
+		seqSpace[i] = seq("ATGTTTTGGCTG")
+	}
+	rateMatrix := [][]float64{
+		[]float64{0.0, 1.0 / 3, 1.0 / 3, 1.0 / 3},
+		[]float64{1.0 / 3, 0.0, 1.0 / 3, 1.0 / 3},
+		[]float64{1.0 / 3, 1.0 / 3, 0.0, 1.0 / 3},
+		[]float64{1.0 / 3, 1.0 / 3, 1.0 / 3, 0.0},
+	}
+	pop := mesim.NewPopulation(seqSpace, 4)
+	pop.Sampler = sampler.NewSampler(1)
+	counter := NewMutationCounter(Standard)
+	pop.MutationObservers = append(pop.MutationObservers, counter)
+	ancSeqSpace := pop.Copy().Sequences
+	pop.Mutate(0.05, rateMatrix)
+
+	diffCnt := 0
+	for i := range ancSeqSpace {
+		for j := range ancSeqSpace[i] {
+			if ancSeqSpace[i][j] != pop.Sequences[i][j] {
+				diffCnt++
+			}
+		}
+	}
+	total := counter.Count(Synonymous) + counter.Count(Nonsynonymous) + counter.Count(Nonsense)
+	if total != diffCnt || total == 0 {
+		t.Errorf("MutationCounter: expected %d classified mutations, actual %d", diffCnt, total)
+	}
+}
+
+func TestAminoAcidFitnessFunc(t *testing.T) {
+	fitnessMatrix := make([][]float64, 2)
+	for i := range fitnessMatrix {
+		fitnessMatrix[i] = make([]float64, NumAminoAcids)
+		for j := range fitnessMatrix[i] {
+			fitnessMatrix[i][j] = 1
+		}
+		fitnessMatrix[i][Stop] = 0
+	}
+	fitnessMatrix[0][10] = 2 // M at codon 0
+	fitnessFunc := AminoAcidFitnessFunc(Standard)
+	if f := fitnessFunc(seq("ATGTTT"), fitnessMatrix); f != 2 {
+		t.Errorf("AminoAcidFitnessFunc(Standard)(ATGTTT): expected 2, actual %v", f)
+	}
+	if f := fitnessFunc(seq("ATGTAA"), fitnessMatrix); f != 0 {
+		t.Errorf("AminoAcidFitnessFunc(Standard)(ATGTAA): expected 0, actual %v", f)
+	}
+}
@@ -0,0 +1,12 @@
+/*
+Package codon groups nucleotide sites of mesim sequences into codons,
+translates them with the NCBI genetic code tables, classifies mutations as
+synonymous, nonsynonymous or nonsense, and defines fitness at the amino acid
+level.
+
+Nucleotides use the encoding of package substitution (A=0, C=1, G=2, T=3).
+A codon is encoded as the integer 16*n1 + 4*n2 + n3 of its three
+nucleotides, so codons range from 0 (AAA) to 63 (TTT). Amino acids are
+encoded by their position in AminoAcids, with the stop signal last.
+*/
+package codon
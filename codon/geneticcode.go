@@ -0,0 +1,175 @@
+package codon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NumCodons is the number of nucleotide triplets.
+const NumCodons = 64
+
+// AminoAcids lists the one-letter codes of the amino acids in the order
+// used to encode them as integers. The stop signal '*' is last.
+const AminoAcids = "ACDEFGHIKLMNPQRSTVWY*"
+
+// NumAminoAcids is the number of amino acid characters including stop.
+const NumAminoAcids = len(AminoAcids)
+
+// Stop is the integer encoding of the stop signal.
+var Stop = strings.IndexByte(AminoAcids, '*')
+
+// GeneticCode maps codons to amino acids.
+type GeneticCode struct {
+	ID   int
+	Name string
+
+	aminoAcids [NumCodons]int
+}
+
+// ncbiTables lists the amino acid strings of the NCBI genetic code tables.
+// Codons are in NCBI order, where the bases of each position cycle
+// through T, C, A, G with the third position changing fastest.
+var ncbiTables = []struct {
+	id         int
+	name       string
+	aminoAcids string
+}{
+	{1, "Standard", "FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG"},
+	{2, "Vertebrate Mitochondrial", "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSS**VVVVAAAADDEEGGGG"},
+	{3, "Yeast Mitochondrial", "FFLLSSSSYY**CCWWTTTTPPPPHHQQRRRRIIMMTTTTNNKKSSRRVVVVAAAADDEEGGGG"},
+	{4, "Mold, Protozoan, and Coelenterate Mitochondrial and Mycoplasma/Spiroplasma", "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG"},
+	{5, "Invertebrate Mitochondrial", "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSSSSVVVVAAAADDEEGGGG"},
+	{6, "Ciliate, Dasycladacean and Hexamita Nuclear", "FFLLSSSSYYQQCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG"},
+	{9, "Echinoderm and Flatworm Mitochondrial", "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNNKSSSSVVVVAAAADDEEGGGG"},
+	{10, "Euplotid Nuclear", "FFLLSSSSYY**CCCWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG"},
+	{11, "Bacterial, Archaeal and Plant Plastid", "FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG"},
+	{12, "Alternative Yeast Nuclear", "FFLLSSSSYY**CC*WLLLSPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG"},
+	{13, "Ascidian Mitochondrial", "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSSGGVVVVAAAADDEEGGGG"},
+	{14, "Alternative Flatworm Mitochondrial", "FFLLSSSSYYY*CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNNKSSSSVVVVAAAADDEEGGGG"},
+	{16, "Chlorophycean Mitochondrial", "FFLLSSSSYY*LCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG"},
+	{21, "Trematode Mitochondrial", "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNNKSSSSVVVVAAAADDEEGGGG"},
+	{22, "Scenedesmus obliquus Mitochondrial", "FFLLSS*SYY*LCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG"},
+	{23, "Thraustochytrium Mitochondrial", "FF*LSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG"},
+	{24, "Rhabdopleuridae Mitochondrial", "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSSKVVVVAAAADDEEGGGG"},
+	{25, "Candidate Division SR1 and Gracilibacteria", "FFLLSSSSYY**CCGWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG"},
+}
+
+// ncbiBases maps the NCBI base order T, C, A, G to nucleotide characters.
+var ncbiBases = [4]int{3, 1, 0, 2}
+
+// Standard is the standard genetic code (NCBI table 1).
+var Standard = mustTable(1)
+
+// Table returns the NCBI genetic code table with the given ID.
+func Table(id int) (*GeneticCode, error) {
+	for _, t := range ncbiTables {
+		if t.id != id {
+			continue
+		}
+		gc := &GeneticCode{ID: t.id, Name: t.name}
+		for k := 0; k < NumCodons; k++ {
+			n1, n2, n3 := ncbiBases[k/16], ncbiBases[(k/4)%4], ncbiBases[k%4]
+			gc.aminoAcids[Codon(n1, n2, n3)] = strings.IndexByte(AminoAcids, t.aminoAcids[k])
+		}
+		return gc, nil
+	}
+	return nil, fmt.Errorf("codon: unknown genetic code table %d", id)
+}
+
+// TableIDs returns the IDs of the available genetic code tables.
+func TableIDs() []int {
+	ids := make([]int, len(ncbiTables))
+	for i, t := range ncbiTables {
+		ids[i] = t.id
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func mustTable(id int) *GeneticCode {
+	gc, err := Table(id)
+	if err != nil {
+		panic(err.Error())
+	}
+	return gc
+}
+
+// Codon returns the codon made of the nucleotides n1, n2 and n3.
+func Codon(n1, n2, n3 int) int {
+	return 16*n1 + 4*n2 + n3
+}
+
+// Nucleotides returns the three nucleotides of the codon.
+func Nucleotides(codon int) (n1, n2, n3 int) {
+	return codon / 16, (codon / 4) % 4, codon % 4
+}
+
+// String returns the codon as a string of nucleotide letters.
+func String(codon int) string {
+	n1, n2, n3 := Nucleotides(codon)
+	return string([]byte{"ACGT"[n1], "ACGT"[n2], "ACGT"[n3]})
+}
+
+// Translate returns the amino acid encoded by the codon.
+func (gc *GeneticCode) Translate(codon int) int {
+	return gc.aminoAcids[codon]
+}
+
+// IsStop reports whether the codon is a stop codon.
+func (gc *GeneticCode) IsStop(codon int) bool {
+	return gc.aminoAcids[codon] == Stop
+}
+
+// SenseCodons returns the codons that do not encode stop, in increasing
+// order.
+func (gc *GeneticCode) SenseCodons() []int {
+	var codons []int
+	for c := 0; c < NumCodons; c++ {
+		if !gc.IsStop(c) {
+			codons = append(codons, c)
+		}
+	}
+	return codons
+}
+
+// Codons groups a nucleotide sequence into codons. The length of the
+// sequence must be a multiple of three.
+func Codons(nucSeq []int) []int {
+	if len(nucSeq)%3 != 0 {
+		panic("Length of the nucleotide sequence must be a multiple of three")
+	}
+	codons := make([]int, len(nucSeq)/3)
+	for i := range codons {
+		codons[i] = Codon(nucSeq[3*i], nucSeq[3*i+1], nucSeq[3*i+2])
+	}
+	return codons
+}
+
+// NucleotideSeq expands a sequence of codons into nucleotides.
+func NucleotideSeq(codons []int) []int {
+	nucSeq := make([]int, 3*len(codons))
+	for i, c := range codons {
+		nucSeq[3*i], nucSeq[3*i+1], nucSeq[3*i+2] = Nucleotides(c)
+	}
+	return nucSeq
+}
+
+// TranslateSeq translates a nucleotide sequence into amino acids.
+func (gc *GeneticCode) TranslateSeq(nucSeq []int) []int {
+	codons := Codons(nucSeq)
+	protein := make([]int, len(codons))
+	for i, c := range codons {
+		protein[i] = gc.Translate(c)
+	}
+	return protein
+}
+
+// ProteinString returns the one-letter representation of a protein.
+func ProteinString(protein []int) string {
+	b := make([]byte, len(protein))
+	for i, aa := range protein {
+		b[i] = AminoAcids[aa]
+	}
+	return string(b)
+}
@@ -0,0 +1,245 @@
+package codon
+
+import (
+	"math"
+	"mesim/substitution"
+)
+
+// Model is a time-reversible codon substitution model over the sense
+// codons of a genetic code. Characters are indices into Codons, so a
+// population evolving under the model has len(Codons) characters (61 for
+// the standard code); see EncodeSense and DecodeSense.
+//
+// Q is the instantaneous rate matrix, scaled so that the mean rate of
+// substitution at equilibrium is one substitution per codon. Frequencies
+// are the equilibrium codon frequencies.
+type Model struct {
+	Name        string
+	Code        *GeneticCode
+	Codons      []int
+	Q           [][]float64
+	Frequencies []float64
+}
+
+// GY94 returns the Goldman-Yang (1994) codon model with
+// transition/transversion rate ratio kappa, nonsynonymous/synonymous rate
+// ratio omega and the given equilibrium frequencies of the sense codons.
+// If codonFreqs is nil, equal frequencies are used.
+func GY94(gc *GeneticCode, kappa, omega float64, codonFreqs []float64) *Model {
+	validateKappaOmega(kappa, omega)
+	codons := gc.SenseCodons()
+	if codonFreqs == nil {
+		codonFreqs = make([]float64, len(codons))
+		for i := range codonFreqs {
+			codonFreqs[i] = 1 / float64(len(codons))
+		}
+	}
+	if len(codonFreqs) != len(codons) {
+		panic("Number of codon frequencies must be equal to the number of sense codons")
+	}
+	validateFreqs(codonFreqs)
+	return newModel("GY94", gc, codons, codonFreqs, func(i, j, pos, toNuc int, transition, synonymous bool) float64 {
+		rate := codonFreqs[j]
+		if transition {
+			rate *= kappa
+		}
+		if !synonymous {
+			rate *= omega
+		}
+		return rate
+	})
+}
+
+// MG94 returns the Muse-Gaut (1994) codon model with
+// transition/transversion rate ratio kappa, nonsynonymous/synonymous rate
+// ratio omega and the given nucleotide frequencies, in the order A, C, G,
+// T. Rates are proportional to the frequency of the target nucleotide
+// rather than of the target codon. If nucFreqs is nil, equal frequencies
+// are used.
+func MG94(gc *GeneticCode, kappa, omega float64, nucFreqs []float64) *Model {
+	validateKappaOmega(kappa, omega)
+	if nucFreqs == nil {
+		nucFreqs = []float64{0.25, 0.25, 0.25, 0.25}
+	}
+	if len(nucFreqs) != substitution.NumNucleotides {
+		panic("Number of nucleotide frequencies must be four")
+	}
+	validateFreqs(nucFreqs)
+	codons := gc.SenseCodons()
+	return newModel("MG94", gc, codons, F1x4(gc, nucFreqs), func(i, j, pos, toNuc int, transition, synonymous bool) float64 {
+		rate := nucFreqs[toNuc]
+		if transition {
+			rate *= kappa
+		}
+		if !synonymous {
+			rate *= omega
+		}
+		return rate
+	})
+}
+
+// F1x4 returns the equilibrium frequencies of the sense codons implied by
+// a single set of nucleotide frequencies for all three codon positions.
+func F1x4(gc *GeneticCode, nucFreqs []float64) []float64 {
+	return F3x4(gc, [3][]float64{nucFreqs, nucFreqs, nucFreqs})
+}
+
+// F3x4 returns the equilibrium frequencies of the sense codons implied by
+// separate nucleotide frequencies for each codon position.
+func F3x4(gc *GeneticCode, posFreqs [3][]float64) []float64 {
+	codons := gc.SenseCodons()
+	freqs := make([]float64, len(codons))
+	sum := 0.0
+	for i, c := range codons {
+		n1, n2, n3 := Nucleotides(c)
+		freqs[i] = posFreqs[0][n1] * posFreqs[1][n2] * posFreqs[2][n3]
+		sum += freqs[i]
+	}
+	for i := range freqs {
+		freqs[i] /= sum
+	}
+	return freqs
+}
+
+// newModel builds the normalised rate matrix of a codon model. rateFunc
+// gives the rate from codon index i to codon index j, which differ only
+// at codon position pos where j has nucleotide toNuc.
+func newModel(name string, gc *GeneticCode, codons []int, freqs []float64, rateFunc func(i, j, pos, toNuc int, transition, synonymous bool) float64) *Model {
+	q := make([][]float64, len(codons))
+	for i := range q {
+		q[i] = make([]float64, len(codons))
+	}
+	meanRate := 0.0
+	for i, ci := range codons {
+		rowSum := 0.0
+		for j, cj := range codons {
+			pos, fromNuc, toNuc, ok := singleDifference(ci, cj)
+			if !ok {
+				continue
+			}
+			synonymous := gc.Translate(ci) == gc.Translate(cj)
+			q[i][j] = rateFunc(i, j, pos, toNuc, isTransition(fromNuc, toNuc), synonymous)
+			rowSum += q[i][j]
+		}
+		q[i][i] = -rowSum
+		meanRate += freqs[i] * rowSum
+	}
+	for i := range q {
+		for j := range q[i] {
+			q[i][j] /= meanRate
+		}
+	}
+	frequencies := make([]float64, len(freqs))
+	copy(frequencies, freqs)
+	return &Model{Name: name, Code: gc, Codons: codons, Q: q, Frequencies: frequencies}
+}
+
+// singleDifference returns the position and nucleotides at which two
+// codons differ, or false if they differ at zero or more than one
+// position.
+func singleDifference(c1, c2 int) (pos, fromNuc, toNuc int, ok bool) {
+	a := [3]int{}
+	b := [3]int{}
+	a[0], a[1], a[2] = Nucleotides(c1)
+	b[0], b[1], b[2] = Nucleotides(c2)
+	diffs := 0
+	for k := 0; k < 3; k++ {
+		if a[k] != b[k] {
+			pos, fromNuc, toNuc = k, a[k], b[k]
+			diffs++
+		}
+	}
+	return pos, fromNuc, toNuc, diffs == 1
+}
+
+// isTransition reports whether the change between two nucleotides is a
+// transition (A<->G or C<->T).
+func isTransition(n1, n2 int) bool {
+	return (n1 == substitution.A && n2 == substitution.G) ||
+		(n1 == substitution.G && n2 == substitution.A) ||
+		(n1 == substitution.C && n2 == substitution.T) ||
+		(n1 == substitution.T && n2 == substitution.C)
+}
+
+func validateKappaOmega(kappa, omega float64) {
+	if kappa <= 0 {
+		panic("kappa must be greater than zero")
+	}
+	if omega < 0 {
+		panic("omega must not be negative")
+	}
+}
+
+func validateFreqs(freqs []float64) {
+	sum := 0.0
+	for _, f := range freqs {
+		if f <= 0 {
+			panic("Frequencies must be greater than zero")
+		}
+		sum += f
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		panic("Frequencies must sum to one")
+	}
+}
+
+// RateMatrix returns a copy of the instantaneous rate matrix Q.
+func (m *Model) RateMatrix() [][]float64 {
+	q := make([][]float64, len(m.Q))
+	for i := range m.Q {
+		q[i] = make([]float64, len(m.Q[i]))
+		copy(q[i], m.Q[i])
+	}
+	return q
+}
+
+// JumpMatrix returns the zero-diagonal transition matrix of the embedded
+// jump chain, which can be passed as the rate matrix of MutateSeqSpace and
+// Population.Mutate for populations of sense-codon encoded sequences.
+// It panics if some codon cannot change at all, as happens with an omega
+// of zero for codons without synonymous neighbours such as ATG.
+func (m *Model) JumpMatrix() [][]float64 {
+	return substitution.JumpMatrix(m.Q)
+}
+
+// TransitionMatrix returns P(t) = exp(Qt) for a branch of length t,
+// measured in expected substitutions per codon.
+func (m *Model) TransitionMatrix(t float64) [][]float64 {
+	return substitution.TransitionMatrix(m.Q, t)
+}
+
+// NumChars returns the number of characters of the model, that is, the
+// number of sense codons.
+func (m *Model) NumChars() int {
+	return len(m.Codons)
+}
+
+// EncodeSense converts a nucleotide sequence into a sequence of sense
+// codon indices of the model. It panics if the sequence contains a stop
+// codon.
+func (m *Model) EncodeSense(nucSeq []int) []int {
+	index := make(map[int]int, len(m.Codons))
+	for i, c := range m.Codons {
+		index[c] = i
+	}
+	codons := Codons(nucSeq)
+	senseSeq := make([]int, len(codons))
+	for i, c := range codons {
+		idx, ok := index[c]
+		if !ok {
+			panic("Nucleotide sequence must not contain stop codons")
+		}
+		senseSeq[i] = idx
+	}
+	return senseSeq
+}
+
+// DecodeSense converts a sequence of sense codon indices back into
+// nucleotides.
+func (m *Model) DecodeSense(senseSeq []int) []int {
+	codons := make([]int, len(senseSeq))
+	for i, idx := range senseSeq {
+		codons[i] = m.Codons[idx]
+	}
+	return NucleotideSeq(codons)
+}
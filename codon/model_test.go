@@ -0,0 +1,99 @@
+package codon
+
+import (
+	"math"
+	"mesim"
+	"mesim/sampler"
+	"mesim/substitution"
+	"testing"
+)
+
+func TestCodonModels(t *testing.T) {
+	nucFreqs := []float64{0.1, 0.2, 0.3, 0.4}
+	models := []*Model{
+		GY94(Standard, 2, 0.5, nil),
+		GY94(Standard, 3, 0.2, F1x4(Standard, nucFreqs)),
+		MG94(Standard, 2, 0.5, nucFreqs),
+	}
+	for _, m := range models {
+		if len(m.Q) != 61 {
+			t.Fatalf("%s: expected 61x61 matrix, actual %d rows", m.Name, len(m.Q))
+		}
+		if err := substitution.ValidateRateMatrix(m.Q); err != nil {
+			t.Errorf("%s: expected valid rate matrix, actual %v", m.Name, err)
+		}
+		if err := substitution.Validate(m.JumpMatrix()); err != nil {
+			t.Errorf("%s: expected valid jump matrix, actual %v", m.Name, err)
+		}
+		meanRate := 0.0
+		for i := range m.Q {
+			meanRate -= m.Frequencies[i] * m.Q[i][i]
+			for j := range m.Q {
+				// Detailed balance
+				if math.Abs(m.Frequencies[i]*m.Q[i][j]-m.Frequencies[j]*m.Q[j][i]) > 1e-12 {
+					t.Fatalf("%s: expected detailed balance at (%d, %d)", m.Name, i, j)
+				}
+			}
+		}
+		if math.Abs(meanRate-1) > 1e-12 {
+			t.Errorf("%s: expected mean rate 1, actual %v", m.Name, meanRate)
+		}
+	}
+}
+
+func TestGY94Omega(t *testing.T) {
+	// TTT (F) -> TTC (F) is a synonymous transition, TTT -> TTA (L) a
+	// nonsynonymous transversion, and TTT -> CTT (L) a nonsynonymous
+	// transition.
+	m := GY94(Standard, 2, 0.5, nil)
+	idx := make(map[int]int)
+	for i, c := range m.Codons {
+		idx[c] = i
+	}
+	ttt := idx[Codon(3, 3, 3)]
+	ttc := idx[Codon(3, 3, 1)]
+	tta := idx[Codon(3, 3, 0)]
+	ctt := idx[Codon(1, 3, 3)]
+	if math.Abs(m.Q[ttt][tta]/m.Q[ttt][ttc]-0.25) > 1e-12 {
+		t.Errorf("GY94: expected rate ratio omega/kappa = 0.25, actual %v", m.Q[ttt][tta]/m.Q[ttt][ttc])
+	}
+	if math.Abs(m.Q[ttt][ctt]/m.Q[ttt][ttc]-0.5) > 1e-12 {
+		t.Errorf("GY94: expected rate ratio omega = 0.5, actual %v", m.Q[ttt][ctt]/m.Q[ttt][ttc])
+	}
+	if m.Q[ttt][idx[Codon(0, 0, 0)]] != 0 {
+		t.Errorf("GY94: expected zero rate between codons that differ at more than one position")
+	}
+}
+
+func TestCodonModelMutate(t *testing.T) {
+	m := GY94(Standard, 2, 0.5, nil)
+	nucSeq := seq("ATGTTTCTGCCGGGA")
+	seqSpace := make([][]int, 50)
+	for i := range seqSpace {
+		seqSpace[i] = m.EncodeSense(nucSeq)
+	}
+	pop := mesim.NewPopulation(seqSpace, m.NumChars())
+	pop.Sampler = sampler.NewSampler(1)
+	pop.Mutate(0.05, m.JumpMatrix())
+	changed := false
+	for _, senseSeq := range pop.Sequences {
+		evolved := m.DecodeSense(senseSeq)
+		for k := 0; k < len(nucSeq); k += 3 {
+			diffs := 0
+			for j := k; j < k+3; j++ {
+				if evolved[j] != nucSeq[j] {
+					diffs++
+				}
+			}
+			if diffs > 1 {
+				t.Errorf("Mutate(0.05, GY94): expected single nucleotide changes per codon, actual %d", diffs)
+			}
+			if diffs > 0 {
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		t.Errorf("Mutate(0.05, GY94): expected at least one substitution")
+	}
+}
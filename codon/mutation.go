@@ -0,0 +1,138 @@
+package codon
+
+import (
+	"mesim"
+)
+
+// MutationClass is the effect of a nucleotide mutation on the encoded
+// protein.
+type MutationClass int
+
+const (
+	// Synonymous mutations do not change the amino acid. Changes between
+	// stop codons are synonymous.
+	Synonymous MutationClass = iota
+	// Nonsynonymous mutations change the amino acid, including changes
+	// from a stop codon to a sense codon.
+	Nonsynonymous
+	// Nonsense mutations change a sense codon into a stop codon.
+	Nonsense
+)
+
+func (c MutationClass) String() string {
+	switch c {
+	case Synonymous:
+		return "synonymous"
+	case Nonsynonymous:
+		return "nonsynonymous"
+	case Nonsense:
+		return "nonsense"
+	}
+	return "unknown"
+}
+
+// Classify returns the class of the change from one codon to another.
+func (gc *GeneticCode) Classify(fromCodon, toCodon int) MutationClass {
+	fromAA, toAA := gc.Translate(fromCodon), gc.Translate(toCodon)
+	switch {
+	case fromAA == toAA:
+		return Synonymous
+	case toAA == Stop:
+		return Nonsense
+	}
+	return Nonsynonymous
+}
+
+// ClassifySite returns the class of the mutation that changes the
+// nucleotide at the given site of nucSeq into newChar.
+func (gc *GeneticCode) ClassifySite(nucSeq []int, site int, newChar int) MutationClass {
+	start := site - site%3
+	fromCodon := Codon(nucSeq[start], nucSeq[start+1], nucSeq[start+2])
+	codonNucs := []int{nucSeq[start], nucSeq[start+1], nucSeq[start+2]}
+	codonNucs[site%3] = newChar
+	toCodon := Codon(codonNucs[0], codonNucs[1], codonNucs[2])
+	return gc.Classify(fromCodon, toCodon)
+}
+
+// MutationCounter is a mesim.MutationObserver that classifies every
+// mutation of a population of nucleotide sequences in reading frame and
+// counts them by class. Sequences must not contain indels.
+type MutationCounter struct {
+	Code   *GeneticCode
+	Counts [3]int
+}
+
+// NewMutationCounter creates a mutation counter that uses the given
+// genetic code.
+func NewMutationCounter(gc *GeneticCode) *MutationCounter {
+	return &MutationCounter{Code: gc}
+}
+
+// ObserveMutation implements mesim.MutationObserver.
+func (mc *MutationCounter) ObserveMutation(pop *mesim.Population, i, site, oldChar, newChar int) {
+	mc.Counts[mc.Code.ClassifySite(pop.Sequences[i], site, newChar)]++
+}
+
+// Count returns the number of mutations of the given class.
+func (mc *MutationCounter) Count(class MutationClass) int {
+	return mc.Counts[class]
+}
+
+// Reset sets every count to zero.
+func (mc *MutationCounter) Reset() {
+	mc.Counts = [3]int{}
+}
+
+// Sites returns the numbers of synonymous and nonsynonymous sites of a
+// nucleotide sequence following Nei and Gojobori (1986). Each site of a
+// sense codon contributes the proportion of its possible single nucleotide
+// changes that are synonymous to the synonymous sites and the rest to the
+// nonsynonymous sites. Changes to stop codons are not counted.
+func (gc *GeneticCode) Sites(nucSeq []int) (synSites, nonsynSites float64) {
+	for _, c := range Codons(nucSeq) {
+		if gc.IsStop(c) {
+			continue
+		}
+		nucs := [3]int{}
+		nucs[0], nucs[1], nucs[2] = Nucleotides(c)
+		for pos := 0; pos < 3; pos++ {
+			syn, sense := 0, 0
+			for n := 0; n < 4; n++ {
+				if n == nucs[pos] {
+					continue
+				}
+				mutant := nucs
+				mutant[pos] = n
+				mutantCodon := Codon(mutant[0], mutant[1], mutant[2])
+				if gc.IsStop(mutantCodon) {
+					continue
+				}
+				sense++
+				if gc.Translate(mutantCodon) == gc.Translate(c) {
+					syn++
+				}
+			}
+			if sense > 0 {
+				synSites += float64(syn) / float64(sense)
+				nonsynSites += float64(sense-syn) / float64(sense)
+			}
+		}
+	}
+	return
+}
+
+// AminoAcidFitnessFunc returns a mesim.FitnessFunc that evaluates the
+// fitness of a nucleotide sequence at the amino acid level. The fitness
+// matrix passed to the returned function has one row per codon and one
+// column per amino acid in the order of AminoAcids, including stop; the
+// fitness of a sequence is the product of the entries of its translated
+// amino acids.
+func AminoAcidFitnessFunc(gc *GeneticCode) mesim.FitnessFunc {
+	return func(nucSeq []int, fitnessMatrix [][]float64) float64 {
+		fitness := 1.0
+		for i, aa := range gc.TranslateSeq(nucSeq) {
+			fitness *= fitnessMatrix[i][aa]
+		}
+		return fitness
+	}
+}
@@ -0,0 +1,385 @@
+package mesim
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mesim/sampler"
+	"mesim/substitution"
+	"mesim/utils"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Wildcard matches any character, including positions past the ends of a
+// sequence, when setting or scaling the rates of a ContextModel.
+const Wildcard = -1
+
+// ContextModel describes mutation rates that depend on the Left characters
+// before and the Right characters after the mutated site.
+//
+// Every context has its own rate of mutation per generation to each
+// character. Flanking positions past either end of a sequence form a
+// context character of their own, which only Wildcard matches.
+type ContextModel struct {
+	NumChars int
+	Left     int
+	Right    int
+
+	// rates[context][target] is the rate at which the center character of
+	// the context changes into target.
+	rates [][]float64
+}
+
+// NewContextModel creates a context model in which every site mutates as
+// in MutateSeqSpace: at rate mu per generation, into a character drawn
+// from the row of the zero-diagonal rateMatrix that corresponds to it,
+// whatever its flanking characters. Rates can then be changed for
+// particular contexts with Set and Scale.
+func NewContextModel(mu float64, rateMatrix [][]float64, left, right int) *ContextModel {
+	if mu < 0 {
+		panic("Mutation rate must not be negative")
+	}
+	if left < 0 || right < 0 {
+		panic("Context lengths must not be negative")
+	}
+	m := newContextModel(len(rateMatrix), left, right)
+	for ctx := range m.rates {
+		center := ctx % m.NumChars
+		for target := range m.rates[ctx] {
+			m.rates[ctx][target] = mu * rateMatrix[center][target]
+		}
+	}
+	return m
+}
+
+// maxContextRates bounds the number of rates in the table of a context
+// model read from a file, so that a long context cannot make
+// ReadContextModel allocate without limit.
+const maxContextRates = 1 << 24
+
+// contextTableSize returns the number of rates in the table of a context
+// model, or maxContextRates+1 if it is larger than maxContextRates.
+func contextTableSize(numChars, left, right int) int {
+	size := numChars * numChars
+	for k := 0; k < left+right; k++ {
+		size *= numChars + 1
+		if size > maxContextRates {
+			return maxContextRates + 1
+		}
+	}
+	return size
+}
+
+func newContextModel(numChars, left, right int) *ContextModel {
+	numContexts := numChars
+	for k := 0; k < left+right; k++ {
+		numContexts *= numChars + 1
+	}
+	rates := make([][]float64, numContexts)
+	for i := range rates {
+		rates[i] = make([]float64, numChars)
+	}
+	return &ContextModel{NumChars: numChars, Left: left, Right: right, rates: rates}
+}
+
+// CpGContextModel creates a nucleotide context model with one flanking
+// character on each side in which C->T transitions in CpG dinucleotides,
+// and the G->A transitions on the opposite strand, occur factor times
+// faster than elsewhere.
+func CpGContextModel(mu float64, rateMatrix [][]float64, factor float64) *ContextModel {
+	m := NewContextModel(mu, rateMatrix, 1, 1)
+	m.Scale([]int{Wildcard}, substitution.C, []int{substitution.G}, substitution.T, factor)
+	m.Scale([]int{substitution.C}, substitution.G, []int{Wildcard}, substitution.A, factor)
+	return m
+}
+
+// APOBECContextModel creates a nucleotide context model with one flanking
+// character on each side in which C->T and C->G changes in TC motifs, and
+// the G->A and G->C changes in GA motifs on the opposite strand, occur
+// factor times faster than elsewhere.
+func APOBECContextModel(mu float64, rateMatrix [][]float64, factor float64) *ContextModel {
+	m := NewContextModel(mu, rateMatrix, 1, 1)
+	for _, target := range []int{substitution.T, substitution.G} {
+		m.Scale([]int{substitution.T}, substitution.C, []int{Wildcard}, target, factor)
+	}
+	for _, target := range []int{substitution.A, substitution.C} {
+		m.Scale([]int{Wildcard}, substitution.G, []int{substitution.A}, target, factor)
+	}
+	return m
+}
+
+// Set sets the rate at which center changes into target in every context
+// that matches the given flanking characters. Flanks may contain Wildcard.
+func (m *ContextModel) Set(left []int, center int, right []int, target int, rate float64) {
+	if rate < 0 {
+		panic("Rate must not be negative")
+	}
+	for _, ctx := range m.matching(left, center, right, target) {
+		m.rates[ctx][target] = rate
+	}
+}
+
+// Scale multiplies the rate at which center changes into target in every
+// context that matches the given flanking characters by factor. Flanks
+// may contain Wildcard.
+func (m *ContextModel) Scale(left []int, center int, right []int, target int, factor float64) {
+	if factor < 0 {
+		panic("Factor must not be negative")
+	}
+	for _, ctx := range m.matching(left, center, right, target) {
+		m.rates[ctx][target] *= factor
+	}
+}
+
+// matching returns the indices of the contexts that match the given
+// center and flanking characters.
+func (m *ContextModel) matching(left []int, center int, right []int, target int) []int {
+	if len(left) != m.Left || len(right) != m.Right {
+		panic("Number of flanking characters must match the context lengths of the model")
+	}
+	if center < 0 || center >= m.NumChars || target < 0 || target >= m.NumChars {
+		panic("Character must be in the range [0, NumChars)")
+	}
+	if center == target {
+		panic("Center and target characters must be different")
+	}
+	flanks := append(append([]int{}, left...), right...)
+	for _, char := range flanks {
+		if char != Wildcard && (char < 0 || char >= m.NumChars) {
+			panic("Flanking character must be Wildcard or in the range [0, NumChars)")
+		}
+	}
+	var contexts []int
+	for ctx := center; ctx < len(m.rates); ctx += m.NumChars {
+		rest := ctx / m.NumChars
+		match := true
+		for k := len(flanks) - 1; k >= 0; k-- {
+			char := rest % (m.NumChars + 1)
+			rest /= m.NumChars + 1
+			if flanks[k] != Wildcard && flanks[k] != char {
+				match = false
+				break
+			}
+		}
+		if match {
+			contexts = append(contexts, ctx)
+		}
+	}
+	return contexts
+}
+
+// contextAt returns the index of the context of the j-th character of the
+// sequence.
+func (m *ContextModel) contextAt(seq []int, j int) int {
+	ctx := 0
+	for k := j - m.Left; k <= j+m.Right; k++ {
+		if k == j {
+			continue
+		}
+		char := m.NumChars // past the end
+		if k >= 0 && k < len(seq) {
+			char = seq[k]
+		}
+		ctx = ctx*(m.NumChars+1) + char
+	}
+	return ctx*m.NumChars + seq[j]
+}
+
+// Rate returns the rate at which the j-th character of the sequence
+// changes into target given its current context.
+func (m *ContextModel) Rate(seq []int, j, target int) float64 {
+	return m.rates[m.contextAt(seq, j)][target]
+}
+
+// SiteRate returns the total rate at which the j-th character of the
+// sequence changes into any other character given its current context.
+func (m *ContextModel) SiteRate(seq []int, j int) float64 {
+	return utils.Sum(m.rates[m.contextAt(seq, j)]...)
+}
+
+// MutateSeqSpaceContext mutates characters in the given sequence space
+// according to the context model, as in Population.MutateContext.
+func MutateSeqSpaceContext(seqSpacePtr *[][]int, model *ContextModel) {
+	MutateSeqSpaceContextWith(sampler.Default, seqSpacePtr, model)
+}
+
+// MutateSeqSpaceContextWith is like MutateSeqSpaceContext but draws from
+// the given sampler.
+func MutateSeqSpaceContextWith(s *sampler.Sampler, seqSpacePtr *[][]int, model *ContextModel) {
+	pop := newPopulation(*seqSpacePtr, model.NumChars)
+	pop.Sampler = s
+	pop.MutateContext(model)
+	*seqSpacePtr = pop.Sequences
+}
+
+// MutateContext mutates the sequences of the population in place under a
+// context-dependent model.
+//
+// The number of hits per sequence is drawn from a Poisson distribution
+// whose mean is the sum of the rates of its sites given their contexts,
+// and hits land on distinct sites with probability proportional to those
+// rates. Hit sites are then mutated one after another, each according to
+// its context at that moment, so earlier changes can affect later ones.
+// Site rates of the population multiply the context rates. The cached
+// fitness of every individual that changed is invalidated.
+func (pop *Population) MutateContext(model *ContextModel) {
+	if model.NumChars != pop.NumChars {
+		panic("Number of characters of the model must be equal to the number of characters")
+	}
+	s := pop.rng()
+	for i := range pop.Sequences {
+		pop.mutateContextSequence(s, model, i)
+	}
+}
+
+// mutateContextSequence mutates the i-th sequence on its own under the
+// context model, as in MutateContext.
+func (pop *Population) mutateContextSequence(s *sampler.Sampler, model *ContextModel, i int) {
+	seq := pop.Sequences[i]
+	weights := make([]float64, len(seq))
+	for j := range seq {
+		weights[j] = pop.siteRate(i, j) * model.SiteRate(seq, j)
+	}
+	total := utils.Sum(weights...)
+	if total <= 0 {
+		return
+	}
+	hits := s.PoissonSample(total)
+	if hits <= 0 {
+		return
+	}
+	changed := false
+	for _, j := range weightedSitesWithoutReplacement(s, weights, hits) {
+		if pop.mutateContextAt(s, model, i, j) {
+			changed = true
+		}
+	}
+	if changed {
+		pop.invalidateFitnessAt(i)
+	}
+}
+
+// mutateContextAt mutates the j-th character of the i-th sequence into a
+// character drawn in proportion to its rates in the current context, and
+// notifies the mutation observers. It reports whether the character
+// changed.
+func (pop *Population) mutateContextAt(s *sampler.Sampler, model *ContextModel, i, j int) bool {
+	seq := pop.Sequences[i]
+	rates := model.rates[model.contextAt(seq, j)]
+	total := utils.Sum(rates...)
+	if total <= 0 {
+		return false
+	}
+	p := make([]float64, len(rates))
+	for k, rate := range rates {
+		p[k] = rate / total
+	}
+	newChar := s.MultinomialWhere(1, p, 1)[0]
+	if newChar == seq[j] {
+		return false
+	}
+	pop.notifyMutation(i, j, seq[j], newChar)
+	seq[j] = newChar
+	return true
+}
+
+// ReadContextModel reads a table of context-dependent rates from r.
+//
+// Each line holds a context, a target character and a rate separated by
+// whitespace, for example "TCA T 2.5" for a C->T change between T and A.
+// Characters are letters of alphabet, and the letter N stands for
+// Wildcard in flanks unless it is part of the alphabet. Every context must
+// have the same odd length, and the mutated character is the middle one.
+// Later lines override earlier ones, so general wildcard entries should
+// come first. Rates not covered by any line are zero. Empty lines and
+// lines starting with # are ignored.
+func ReadContextModel(r io.Reader, alphabet string) (*ContextModel, error) {
+	index := make(map[rune]int)
+	for i, letter := range []rune(alphabet) {
+		if _, ok := index[letter]; ok {
+			return nil, fmt.Errorf("mesim: alphabet has character %q more than once", letter)
+		}
+		index[letter] = i
+	}
+	charOf := func(letter rune, flank bool) (int, error) {
+		if char, ok := index[letter]; ok {
+			return char, nil
+		}
+		if flank && letter == 'N' {
+			return Wildcard, nil
+		}
+		return 0, fmt.Errorf("unknown character %q", letter)
+	}
+
+	var m *ContextModel
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("mesim: line %d: expected context, target and rate, found %d fields", lineNum, len(fields))
+		}
+		context := []rune(fields[0])
+		if len(context)%2 == 0 {
+			return nil, fmt.Errorf("mesim: line %d: context %q must have an odd length", lineNum, fields[0])
+		}
+		flankLen := len(context) / 2
+		if m == nil {
+			if contextTableSize(len(index), flankLen, flankLen) > maxContextRates {
+				return nil, fmt.Errorf("mesim: line %d: context %q is too long for a table of at most %d rates", lineNum, fields[0], maxContextRates)
+			}
+			m = newContextModel(len(index), flankLen, flankLen)
+		} else if flankLen != m.Left {
+			return nil, fmt.Errorf("mesim: line %d: context %q must have length %d", lineNum, fields[0], 2*m.Left+1)
+		}
+		chars := make([]int, len(context))
+		for k, letter := range context {
+			char, err := charOf(letter, k != flankLen)
+			if err != nil {
+				return nil, fmt.Errorf("mesim: line %d: %v", lineNum, err)
+			}
+			chars[k] = char
+		}
+		targetLetters := []rune(fields[1])
+		if len(targetLetters) != 1 {
+			return nil, fmt.Errorf("mesim: line %d: target %q must be a single character", lineNum, fields[1])
+		}
+		target, err := charOf(targetLetters[0], false)
+		if err != nil {
+			return nil, fmt.Errorf("mesim: line %d: %v", lineNum, err)
+		}
+		if target == chars[flankLen] {
+			return nil, fmt.Errorf("mesim: line %d: target must differ from the center of the context", lineNum)
+		}
+		rate, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("mesim: line %d: invalid rate %q", lineNum, fields[2])
+		}
+		m.Set(chars[:flankLen], chars[flankLen], chars[flankLen+1:], target, rate)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("mesim: %v", err)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("mesim: no context rates found")
+	}
+	return m, nil
+}
+
+// LoadContextModel reads a table of context-dependent rates from the file
+// at path. See ReadContextModel for the format.
+func LoadContextModel(path string, alphabet string) (*ContextModel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadContextModel(f, alphabet)
+}
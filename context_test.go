@@ -0,0 +1,135 @@
+package mesim
+
+import (
+	"mesim/sampler"
+	"mesim/substitution"
+	"strings"
+	"testing"
+)
+
+func TestCpGContextModel(t *testing.T) {
+	m := CpGContextModel(0.01, substitution.K80(2).JumpMatrix(), 10)
+	// A C G T = 0 1 2 3
+	seq := []int{0, 1, 2, 1, 0, 2}
+	base := NewContextModel(0.01, substitution.K80(2).JumpMatrix(), 1, 1)
+	cases := []struct {
+		site, target int
+		factor       float64
+	}{
+		{1, substitution.T, 10}, // C in CpG
+		{2, substitution.A, 10}, // G in CpG
+		{1, substitution.A, 1},  // transversion in CpG
+		{3, substitution.T, 1},  // C followed by A
+		{5, substitution.A, 1},  // G at the end, preceded by A
+	}
+	for _, c := range cases {
+		expected := c.factor * base.Rate(seq, c.site, c.target)
+		if actual := m.Rate(seq, c.site, c.target); actual != expected {
+			t.Errorf("Rate(site %d, target %d): expected %v, actual %v", c.site, c.target, expected, actual)
+		}
+	}
+}
+
+func TestContextModelEnds(t *testing.T) {
+	m := NewContextModel(1, [][]float64{{0, 1}, {1, 0}}, 1, 1)
+	m.Set([]int{1}, 0, []int{1}, 1, 5)
+	seq := []int{0, 1, 0}
+	if actual := m.Rate(seq, 0, 1); actual != 1 {
+		t.Errorf("Rate(site 0): expected 1 at the start of the sequence, actual %v", actual)
+	}
+	if actual := m.Rate([]int{1, 0, 1}, 1, 1); actual != 5 {
+		t.Errorf("Rate(site 1): expected 5, actual %v", actual)
+	}
+	m.Set([]int{Wildcard}, 0, []int{Wildcard}, 1, 3)
+	if actual := m.Rate(seq, 0, 1); actual != 3 {
+		t.Errorf("Rate(site 0): expected wildcard to match past the end, actual %v", actual)
+	}
+}
+
+func TestMutateContext(t *testing.T) {
+	// Only C in CpG mutates, and only into T
+	m := NewContextModel(0, substitution.JC69().JumpMatrix(), 1, 1)
+	m.Set([]int{Wildcard}, substitution.C, []int{substitution.G}, substitution.T, 0.5)
+	seqSpace := make([][]int, 100)
+	for i := range seqSpace {
+		seqSpace[i] = []int{1, 2, 1, 0, 1, 2}
+	}
+	pop := NewPopulation(seqSpace, 4)
+	pop.Sampler = sampler.NewSampler(1)
+	pop.MutateContext(m)
+	numMutated := 0
+	for _, seq := range pop.Sequences {
+		for j, char := range seq {
+			if char == seqSpace[0][j] {
+				continue
+			}
+			if (j != 0 && j != 4) || char != substitution.T {
+				t.Fatalf("MutateContext: unexpected change to %d at site %d", char, j)
+			}
+			numMutated++
+		}
+	}
+	// Expected 100 sequences * 2 sites * 0.5
+	if numMutated < 70 || numMutated > 130 {
+		t.Errorf("MutateContext: expected about 100 mutations, actual %d", numMutated)
+	}
+}
+
+func TestReadContextModel(t *testing.T) {
+	table := `# context target rate
+NCN T 0.1
+TCA T 2.5
+ACG A 0.3
+`
+	m, err := ReadContextModel(strings.NewReader(table), "ACGT")
+	if err != nil {
+		t.Fatalf("ReadContextModel: unexpected error %v", err)
+	}
+	if m.Left != 1 || m.Right != 1 {
+		t.Errorf("ReadContextModel: expected flanks of 1, actual %d and %d", m.Left, m.Right)
+	}
+	cases := []struct {
+		seq      []int
+		target   int
+		expected float64
+	}{
+		{[]int{3, 1, 0}, 3, 2.5},
+		{[]int{0, 1, 0}, 3, 0.1},
+		{[]int{0, 1, 2}, 0, 0.3},
+		{[]int{0, 1, 2}, 2, 0},
+	}
+	for _, c := range cases {
+		if actual := m.Rate(c.seq, 1, c.target); actual != c.expected {
+			t.Errorf("Rate(%v, %d): expected %v, actual %v", c.seq, c.target, c.expected, actual)
+		}
+	}
+
+	invalid := []string{
+		"TC T 1\n",
+		"TCA C 1\n",
+		"TCA T -1\n",
+		"TXA T 1\n",
+		"TCA T 1\nATCAA T 1\n",
+		"",
+	}
+	for _, table := range invalid {
+		if _, err := ReadContextModel(strings.NewReader(table), "ACGT"); err == nil {
+			t.Errorf("ReadContextModel(%q): expected error", table)
+		}
+	}
+	if _, err := ReadContextModel(strings.NewReader("TCA T 1\n"), "ACGTA"); err == nil {
+		t.Errorf("ReadContextModel: expected error for an alphabet with a repeated letter")
+	}
+	longContext := strings.Repeat("A", 20) + "C" + strings.Repeat("A", 20) + " T 1\n"
+	if _, err := ReadContextModel(strings.NewReader(longContext), "ACGT"); err == nil {
+		t.Errorf("ReadContextModel: expected error for a context too long for the rate table")
+	}
+	// Letters are numbered by position, not by byte offset
+	greek, err := ReadContextModel(strings.NewReader("αβα γ 2\n"), "αβγ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := greek.Rate([]int{0, 1, 0}, 1, 2); actual != 2 {
+		t.Errorf("Rate: expected 2 for a multibyte alphabet, actual %v", actual)
+	}
+}
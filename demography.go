@@ -0,0 +1,161 @@
+package mesim
+
+import (
+	"math"
+)
+
+// Demography gives the size of the population at each generation.
+// Generation 0 is the initial population.
+type Demography interface {
+	PopSize(generation int) int
+}
+
+// ConstantDemography keeps the population at a fixed size.
+type ConstantDemography struct {
+	Size int
+}
+
+// NewConstantDemography creates a demography whose size never changes.
+func NewConstantDemography(size int) *ConstantDemography {
+	if size < 0 {
+		panic("Population size must not be negative")
+	}
+	return &ConstantDemography{Size: size}
+}
+
+// PopSize returns the population size at the given generation.
+func (d *ConstantDemography) PopSize(generation int) int {
+	return d.Size
+}
+
+// ExponentialDemography grows or shrinks the population exponentially
+// from InitialSize at a per-generation rate Rate, that is
+// N(t) = N(0) * exp(Rate * t). If MaxSize is greater than zero, the
+// population size is capped at MaxSize.
+type ExponentialDemography struct {
+	InitialSize int
+	Rate        float64
+	MaxSize     int
+}
+
+// NewExponentialDemography creates an exponential growth demography.
+// Negative rates describe exponential decline. A maxSize of zero means
+// that growth is unbounded.
+func NewExponentialDemography(initialSize int, rate float64, maxSize int) *ExponentialDemography {
+	if initialSize < 0 || maxSize < 0 {
+		panic("Population size must not be negative")
+	}
+	return &ExponentialDemography{InitialSize: initialSize, Rate: rate, MaxSize: maxSize}
+}
+
+// PopSize returns the population size at the given generation.
+func (d *ExponentialDemography) PopSize(generation int) int {
+	size := roundSize(float64(d.InitialSize) * math.Exp(d.Rate*float64(generation)))
+	if d.MaxSize > 0 && size > d.MaxSize {
+		return d.MaxSize
+	}
+	return size
+}
+
+// LogisticDemography grows the population from InitialSize towards the
+// carrying capacity CarryingCapacity at the intrinsic per-generation rate
+// Rate, following N(t) = K / (1 + ((K - N(0)) / N(0)) * exp(-Rate * t)).
+type LogisticDemography struct {
+	InitialSize      int
+	Rate             float64
+	CarryingCapacity int
+}
+
+// NewLogisticDemography creates a logistic growth demography.
+func NewLogisticDemography(initialSize int, rate float64, carryingCapacity int) *LogisticDemography {
+	if initialSize < 1 {
+		panic("Initial population size must be greater than zero")
+	}
+	if carryingCapacity < 1 {
+		panic("Carrying capacity must be greater than zero")
+	}
+	return &LogisticDemography{InitialSize: initialSize, Rate: rate, CarryingCapacity: carryingCapacity}
+}
+
+// PopSize returns the population size at the given generation.
+func (d *LogisticDemography) PopSize(generation int) int {
+	k := float64(d.CarryingCapacity)
+	n0 := float64(d.InitialSize)
+	return roundSize(k / (1 + ((k-n0)/n0)*math.Exp(-d.Rate*float64(generation))))
+}
+
+// StepDemography changes the population size abruptly at given
+// generations. The population has InitialSize individuals until
+// Generations[0], Sizes[0] individuals from Generations[0] until
+// Generations[1], and so on.
+type StepDemography struct {
+	InitialSize int
+	Generations []int
+	Sizes       []int
+}
+
+// NewStepDemography creates a demography that switches to sizes[i] at
+// generations[i]. Generations must be given in increasing order.
+func NewStepDemography(initialSize int, generations []int, sizes []int) *StepDemography {
+	if len(generations) != len(sizes) {
+		panic("Lengths of generations and sizes must be equal")
+	}
+	if initialSize < 0 {
+		panic("Population size must not be negative")
+	}
+	for i := range generations {
+		if i > 0 && generations[i] <= generations[i-1] {
+			panic("Generations must be in increasing order")
+		}
+		if sizes[i] < 0 {
+			panic("Population size must not be negative")
+		}
+	}
+	return &StepDemography{InitialSize: initialSize, Generations: generations, Sizes: sizes}
+}
+
+// PopSize returns the population size at the given generation.
+func (d *StepDemography) PopSize(generation int) int {
+	size := d.InitialSize
+	for i, g := range d.Generations {
+		if generation < g {
+			break
+		}
+		size = d.Sizes[i]
+	}
+	return size
+}
+
+// BottleneckDemography keeps the population at Size except for Duration
+// generations starting at Start, during which the population is reduced to
+// BottleneckSize.
+type BottleneckDemography struct {
+	Size           int
+	BottleneckSize int
+	Start          int
+	Duration       int
+}
+
+// NewBottleneckDemography creates a demography with a single bottleneck.
+func NewBottleneckDemography(size, bottleneckSize, start, duration int) *BottleneckDemography {
+	if size < 0 || bottleneckSize < 0 {
+		panic("Population size must not be negative")
+	}
+	if duration < 1 {
+		panic("Duration of the bottleneck must be greater than zero")
+	}
+	return &BottleneckDemography{Size: size, BottleneckSize: bottleneckSize, Start: start, Duration: duration}
+}
+
+// PopSize returns the population size at the given generation.
+func (d *BottleneckDemography) PopSize(generation int) int {
+	if generation >= d.Start && generation < d.Start+d.Duration {
+		return d.BottleneckSize
+	}
+	return d.Size
+}
+
+// roundSize rounds a continuous population size to the nearest integer.
+func roundSize(size float64) int {
+	return int(math.Floor(size + 0.5))
+}
@@ -0,0 +1,99 @@
+package mesim
+
+import (
+	"testing"
+)
+
+func TestConstantDemography(t *testing.T) {
+	d := NewConstantDemography(100)
+	for _, g := range []int{0, 1, 50, 1000} {
+		if d.PopSize(g) != 100 {
+			t.Errorf("ConstantDemography.PopSize(%d): expected 100, actual %d", g, d.PopSize(g))
+		}
+	}
+}
+
+func TestExponentialDemography(t *testing.T) {
+	d := NewExponentialDemography(10, 0.6931471805599453, 100) // Doubles every generation
+	expected := []int{10, 20, 40, 80, 100, 100}
+	for g, size := range expected {
+		if d.PopSize(g) != size {
+			t.Errorf("ExponentialDemography.PopSize(%d): expected %d, actual %d", g, size, d.PopSize(g))
+		}
+	}
+}
+
+func TestLogisticDemography(t *testing.T) {
+	d := NewLogisticDemography(10, 0.5, 1000)
+	if d.PopSize(0) != 10 {
+		t.Errorf("LogisticDemography.PopSize(0): expected 10, actual %d", d.PopSize(0))
+	}
+	prev := d.PopSize(0)
+	for g := 1; g < 100; g++ {
+		size := d.PopSize(g)
+		if size < prev || size > 1000 {
+			t.Errorf("LogisticDemography.PopSize(%d): expected value in [%d, 1000], actual %d", g, prev, size)
+		}
+		prev = size
+	}
+	if prev != 1000 {
+		t.Errorf("LogisticDemography.PopSize(99): expected 1000, actual %d", prev)
+	}
+}
+
+func TestStepDemography(t *testing.T) {
+	d := NewStepDemography(50, []int{5, 10}, []int{20, 80})
+	expected := map[int]int{0: 50, 4: 50, 5: 20, 9: 20, 10: 80, 100: 80}
+	for g, size := range expected {
+		if d.PopSize(g) != size {
+			t.Errorf("StepDemography.PopSize(%d): expected %d, actual %d", g, size, d.PopSize(g))
+		}
+	}
+}
+
+func TestBottleneckDemography(t *testing.T) {
+	d := NewBottleneckDemography(100, 2, 10, 3)
+	expected := map[int]int{9: 100, 10: 2, 12: 2, 13: 100}
+	for g, size := range expected {
+		if d.PopSize(g) != size {
+			t.Errorf("BottleneckDemography.PopSize(%d): expected %d, actual %d", g, size, d.PopSize(g))
+		}
+	}
+}
+
+func TestEvolveDemography(t *testing.T) {
+	seqSpace := [][]int{
+		[]int{0, 0, 0, 0},
+		[]int{1, 1, 1, 1},
+	}
+	rateMatrix := [][]float64{
+		[]float64{0.0, 1.0},
+		[]float64{1.0, 0.0},
+	}
+	fitnessMatrix := [][]float64{
+		[]float64{1.0, 1.0},
+		[]float64{1.0, 1.0},
+		[]float64{1.0, 1.0},
+		[]float64{1.0, 1.0},
+	}
+	fitnessFunc := func(seq []int, fitnessMatrix [][]float64) (multSum float64) {
+		multSum = float64(1)
+		for i, char := range seq {
+			multSum *= float64(fitnessMatrix[i][char])
+		}
+		return
+	}
+	d := NewStepDemography(2, []int{1, 2, 3}, []int{10, 3, 0})
+	pop := NewPopulation(seqSpace, 2)
+	for g, size := range []int{10, 3, 0} {
+		pop.Evolve(g, d, 0.1, 0.1, rateMatrix, fitnessMatrix, fitnessFunc)
+		if pop.Size() != size {
+			t.Errorf("Evolve(%d, d, ...): expected size %d, actual %d", g, size, pop.Size())
+		}
+		for _, seq := range pop.Sequences {
+			if seq == nil {
+				t.Errorf("Evolve(%d, d, ...): expected no nil sequences", g)
+			}
+		}
+	}
+}
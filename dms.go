@@ -0,0 +1,379 @@
+package mesim
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ScoreTransform converts a score from a deep mutational scanning (DMS)
+// experiment into a fitness relative to the wildtype.
+type ScoreTransform func(score float64) float64
+
+// LinearScores uses scores as relative fitness values directly.
+func LinearScores(score float64) float64 {
+	return score
+}
+
+// ExpScores converts natural log enrichment ratios, as reported by
+// Enrich2, into relative fitness values.
+func ExpScores(score float64) float64 {
+	return math.Exp(score)
+}
+
+// Exp2Scores converts log2 enrichment ratios, as reported by dms_tools,
+// into relative fitness values.
+func Exp2Scores(score float64) float64 {
+	return math.Exp2(score)
+}
+
+// ClampScores returns a transform that applies transform and then clamps
+// the result to the range [min, max].
+func ClampScores(transform ScoreTransform, min, max float64) ScoreTransform {
+	return func(score float64) float64 {
+		return math.Min(math.Max(transform(score), min), max)
+	}
+}
+
+// MissingPolicy decides the fitness of mutants without a score.
+type MissingPolicy int
+
+const (
+	// MissingNeutral gives missing mutants the fitness of the wildtype.
+	MissingNeutral MissingPolicy = iota
+	// MissingLethal gives missing mutants a fitness of zero.
+	MissingLethal
+	// MissingSiteMean gives missing mutants the mean fitness of the scored
+	// mutants at the same site, or the fitness of the wildtype if none
+	// was scored.
+	MissingSiteMean
+	// MissingFill gives missing mutants the fitness DMSOptions.FillValue.
+	MissingFill
+	// MissingError makes loading fail if any mutant is missing.
+	MissingError
+)
+
+// DMSOptions describes how a DMS table is read and converted.
+//
+// The table must have a header row. Each row gives the score of a single
+// mutant: the site, the wildtype character, the mutant character and the
+// score, in the columns named by SiteColumn, WildtypeColumn, MutantColumn
+// and ScoreColumn. If WildtypeColumn is empty or absent, the mutant column
+// may instead hold a mutation such as "A12G", giving the wildtype, site and
+// mutant at once. Characters are letters of Alphabet. Empty scores and
+// scores of NA or NaN are missing.
+//
+// Sites are numbered from SiteOffset, so that a SiteOffset of 1 reads
+// 1-based tables. NumSites sets the length of the sequence; if zero, it is
+// one more than the largest site found.
+//
+// The wildtype character of every site has a fitness of one, and scores
+// are converted into fitness values by Transform, or used as they are if
+// Transform is nil. Comma is the field separator; if zero, it is a tab
+// for files ending in .tsv or .tab and a comma otherwise.
+type DMSOptions struct {
+	Alphabet       string
+	SiteColumn     string
+	WildtypeColumn string
+	MutantColumn   string
+	ScoreColumn    string
+	SiteOffset     int
+	NumSites       int
+	Transform      ScoreTransform
+	Missing        MissingPolicy
+	FillValue      float64
+	Comma          rune
+}
+
+// NewDMSOptions returns options for tables with the columns site,
+// wildtype, mutant and score, 1-based sites, scores that are already
+// relative fitness values, and neutral missing mutants.
+func NewDMSOptions(alphabet string) *DMSOptions {
+	return &DMSOptions{
+		Alphabet:       alphabet,
+		SiteColumn:     "site",
+		WildtypeColumn: "wildtype",
+		MutantColumn:   "mutant",
+		ScoreColumn:    "score",
+		SiteOffset:     1,
+		Transform:      LinearScores,
+		Missing:        MissingNeutral,
+	}
+}
+
+// maxDMSSites bounds the number of sites of DMS tables, so that a corrupt
+// site number cannot make ReadDMS allocate without limit.
+const maxDMSSites = 1000000
+
+// ReadDMS reads a DMS table from r and converts it into a fitness matrix
+// with a row per site and a column per character of the alphabet, for use
+// with a multiplicative FitnessFunc. It also returns the wildtype
+// character of every site, or -1 for sites without data.
+func ReadDMS(r io.Reader, opts *DMSOptions) (fitnessMatrix [][]float64, wildtype []int, err error) {
+	index := make(map[rune]int)
+	for i, letter := range []rune(opts.Alphabet) {
+		if _, ok := index[unicode.ToUpper(letter)]; ok {
+			return nil, nil, fmt.Errorf("mesim: alphabet has character %q more than once, ignoring case", letter)
+		}
+		index[unicode.ToUpper(letter)] = i
+	}
+	numChars := len(index)
+	if numChars == 0 {
+		return nil, nil, fmt.Errorf("mesim: alphabet must not be empty")
+	}
+	charOf := func(s string) (int, error) {
+		letters := []rune(strings.TrimSpace(s))
+		if len(letters) != 1 {
+			return 0, fmt.Errorf("invalid character %q", s)
+		}
+		char, ok := index[unicode.ToUpper(letters[0])]
+		if !ok {
+			return 0, fmt.Errorf("character %q is not in the alphabet", s)
+		}
+		return char, nil
+	}
+
+	reader := csv.NewReader(r)
+	if opts.Comma != 0 {
+		reader.Comma = opts.Comma
+	}
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("mesim: reading header: %v", err)
+	}
+	columns := make(map[string]int)
+	for k, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = k
+	}
+	column := func(name string) int {
+		if name == "" {
+			return -1
+		}
+		if k, ok := columns[strings.ToLower(name)]; ok {
+			return k
+		}
+		return -1
+	}
+	siteCol, wtCol := column(opts.SiteColumn), column(opts.WildtypeColumn)
+	mutCol, scoreCol := column(opts.MutantColumn), column(opts.ScoreColumn)
+	if mutCol < 0 || scoreCol < 0 {
+		return nil, nil, fmt.Errorf("mesim: table must have columns %q and %q", opts.MutantColumn, opts.ScoreColumn)
+	}
+	combined := wtCol < 0
+	if !combined && siteCol < 0 {
+		return nil, nil, fmt.Errorf("mesim: table must have a column %q", opts.SiteColumn)
+	}
+
+	type entry struct {
+		site, mutant int
+		score        float64
+		missing      bool
+	}
+	var entries []entry
+	wildtypeAt := make(map[int]int)
+	maxSite := -1
+	for lineNum := 2; ; lineNum++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("mesim: row %d: %v", lineNum, err)
+		}
+		field := func(k int) string {
+			if k < len(record) {
+				return strings.TrimSpace(record[k])
+			}
+			return ""
+		}
+		var site, wt, mut int
+		if combined {
+			site, wt, mut, err = parseMutation(field(mutCol), opts.SiteOffset, charOf)
+		} else {
+			site, err = strconv.Atoi(field(siteCol))
+			site -= opts.SiteOffset
+			if err == nil {
+				wt, err = charOf(field(wtCol))
+			}
+			if err == nil {
+				mut, err = charOf(field(mutCol))
+			}
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("mesim: row %d: %v", lineNum, err)
+		}
+		if site < 0 {
+			return nil, nil, fmt.Errorf("mesim: row %d: site before the first site", lineNum)
+		}
+		if site >= maxDMSSites {
+			return nil, nil, fmt.Errorf("mesim: row %d: site %d exceeds the limit of %d sites", lineNum, site+opts.SiteOffset, maxDMSSites)
+		}
+		if prev, ok := wildtypeAt[site]; ok && prev != wt {
+			return nil, nil, fmt.Errorf("mesim: row %d: conflicting wildtype at site %d", lineNum, site+opts.SiteOffset)
+		}
+		wildtypeAt[site] = wt
+		if site > maxSite {
+			maxSite = site
+		}
+		if mut == wt {
+			continue
+		}
+		e := entry{site: site, mutant: mut}
+		scoreField := strings.ToLower(field(scoreCol))
+		if scoreField == "" || scoreField == "na" || scoreField == "nan" {
+			e.missing = true
+		} else {
+			e.score, err = strconv.ParseFloat(scoreField, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("mesim: row %d: invalid score %q", lineNum, field(scoreCol))
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	numSites := opts.NumSites
+	if numSites == 0 {
+		numSites = maxSite + 1
+	}
+	if numSites < 1 {
+		return nil, nil, fmt.Errorf("mesim: no scores found")
+	}
+	if numSites > maxDMSSites {
+		return nil, nil, fmt.Errorf("mesim: %d sites exceed the limit of %d sites", numSites, maxDMSSites)
+	}
+	if maxSite >= numSites {
+		return nil, nil, fmt.Errorf("mesim: site %d beyond the number of sites", maxSite+opts.SiteOffset)
+	}
+	transform := opts.Transform
+	if transform == nil {
+		transform = LinearScores
+	}
+
+	fitnessMatrix = make([][]float64, numSites)
+	scored := make([][]bool, numSites)
+	wildtype = make([]int, numSites)
+	for i := range fitnessMatrix {
+		fitnessMatrix[i] = make([]float64, numChars)
+		scored[i] = make([]bool, numChars)
+		wildtype[i] = -1
+		if wt, ok := wildtypeAt[i]; ok {
+			wildtype[i] = wt
+			fitnessMatrix[i][wt] = 1
+			scored[i][wt] = true
+		}
+	}
+	for _, e := range entries {
+		if e.missing {
+			continue
+		}
+		fitnessMatrix[e.site][e.mutant] = transform(e.score)
+		scored[e.site][e.mutant] = true
+	}
+	for i := range fitnessMatrix {
+		mean := 1.0
+		if opts.Missing == MissingSiteMean {
+			sum, cnt := 0.0, 0
+			for a, ok := range scored[i] {
+				if ok && a != wildtype[i] {
+					sum += fitnessMatrix[i][a]
+					cnt++
+				}
+			}
+			if cnt > 0 {
+				mean = sum / float64(cnt)
+			}
+		}
+		for a, ok := range scored[i] {
+			if ok {
+				continue
+			}
+			switch opts.Missing {
+			case MissingNeutral:
+				fitnessMatrix[i][a] = 1
+			case MissingLethal:
+				fitnessMatrix[i][a] = 0
+			case MissingSiteMean:
+				fitnessMatrix[i][a] = mean
+			case MissingFill:
+				fitnessMatrix[i][a] = opts.FillValue
+			default:
+				return nil, nil, fmt.Errorf("mesim: missing score for character %q at site %d", []rune(opts.Alphabet)[a], i+opts.SiteOffset)
+			}
+		}
+	}
+	if err := ValidateFitnessMatrix(fitnessMatrix, numChars); err != nil {
+		return nil, nil, err
+	}
+	return fitnessMatrix, wildtype, nil
+}
+
+// LoadDMS reads a DMS table from the file at path. See ReadDMS.
+func LoadDMS(path string, opts *DMSOptions) (fitnessMatrix [][]float64, wildtype []int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	if opts.Comma == 0 {
+		fileOpts := *opts
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".tsv", ".tab":
+			fileOpts.Comma = '\t'
+		default:
+			fileOpts.Comma = ','
+		}
+		opts = &fileOpts
+	}
+	return ReadDMS(f, opts)
+}
+
+// parseMutation parses a mutation such as "A12G" into its site, wildtype
+// and mutant characters.
+func parseMutation(s string, siteOffset int, charOf func(string) (int, error)) (site, wt, mut int, err error) {
+	letters := []rune(s)
+	if len(letters) < 3 {
+		return 0, 0, 0, fmt.Errorf("invalid mutation %q", s)
+	}
+	wt, err = charOf(string(letters[0]))
+	if err != nil {
+		return
+	}
+	mut, err = charOf(string(letters[len(letters)-1]))
+	if err != nil {
+		return
+	}
+	site, err = strconv.Atoi(string(letters[1 : len(letters)-1]))
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid mutation %q", s)
+	}
+	return site - siteOffset, wt, mut, nil
+}
+
+// ValidateFitnessMatrix returns an error unless the fitness matrix has at
+// least one row, every row has numChars values, and every value is a
+// finite, non-negative number.
+func ValidateFitnessMatrix(fitnessMatrix [][]float64, numChars int) error {
+	if len(fitnessMatrix) == 0 {
+		return fmt.Errorf("mesim: fitness matrix must have at least one row")
+	}
+	for i, row := range fitnessMatrix {
+		if len(row) != numChars {
+			return fmt.Errorf("mesim: row %d of the fitness matrix has %d values, expected %d", i, len(row), numChars)
+		}
+		for a, value := range row {
+			if value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+				return fmt.Errorf("mesim: fitness of character %d at site %d must be a finite non-negative number, found %v", a, i, value)
+			}
+		}
+	}
+	return nil
+}
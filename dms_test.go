@@ -0,0 +1,131 @@
+package mesim
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadDMS(t *testing.T) {
+	table := `site,wildtype,mutant,score
+1,A,C,0.5
+1,A,G,NA
+2,C,A,2.0
+2,C,T,1.5
+`
+	opts := NewDMSOptions("ACGT")
+	fitnessMatrix, wildtype, err := ReadDMS(strings.NewReader(table), opts)
+	if err != nil {
+		t.Fatalf("ReadDMS: unexpected error %v", err)
+	}
+	expected := [][]float64{
+		{1, 0.5, 1, 1},
+		{2, 1, 1, 1.5},
+	}
+	for i := range expected {
+		for a := range expected[i] {
+			if fitnessMatrix[i][a] != expected[i][a] {
+				t.Errorf("ReadDMS: expected fitness %v of %d at site %d, actual %v", expected[i][a], a, i, fitnessMatrix[i][a])
+			}
+		}
+	}
+	if wildtype[0] != 0 || wildtype[1] != 1 {
+		t.Errorf("ReadDMS: expected wildtype [0 1], actual %v", wildtype)
+	}
+
+	opts.Missing = MissingSiteMean
+	fitnessMatrix, _, _ = ReadDMS(strings.NewReader(table), opts)
+	if fitnessMatrix[1][2] != 1.75 || fitnessMatrix[0][2] != 0.5 {
+		t.Errorf("ReadDMS(MissingSiteMean): expected 0.5 and 1.75, actual %v and %v", fitnessMatrix[0][2], fitnessMatrix[1][2])
+	}
+	opts.Missing = MissingError
+	if _, _, err := ReadDMS(strings.NewReader(table), opts); err == nil {
+		t.Errorf("ReadDMS(MissingError): expected error")
+	}
+}
+
+func TestReadDMSMutationColumn(t *testing.T) {
+	table := "hgvs\tlog2 enrichment\n" +
+		"M1A\t-1\n" +
+		"k2R\t1\n" +
+		"K2*\t-10\n"
+	opts := &DMSOptions{
+		Alphabet:     "ACDEFGHIKLMNPQRSTVWY*",
+		MutantColumn: "hgvs",
+		ScoreColumn:  "log2 enrichment",
+		SiteOffset:   1,
+		NumSites:     3,
+		Transform:    Exp2Scores,
+		Missing:      MissingLethal,
+		Comma:        '\t',
+	}
+	fitnessMatrix, wildtype, err := ReadDMS(strings.NewReader(table), opts)
+	if err != nil {
+		t.Fatalf("ReadDMS: unexpected error %v", err)
+	}
+	if len(fitnessMatrix) != 3 || wildtype[2] != -1 {
+		t.Fatalf("ReadDMS: expected 3 sites with unknown wildtype at the last, actual %d and %v", len(fitnessMatrix), wildtype)
+	}
+	// A = 0, M = 10, K = 8, R = 14, * = 20
+	cases := []struct {
+		site, char int
+		expected   float64
+	}{
+		{0, 10, 1},
+		{0, 0, 0.5},
+		{1, 14, 2},
+		{1, 20, math.Exp2(-10)},
+		{1, 0, 0},
+		{2, 5, 0},
+	}
+	for _, c := range cases {
+		if actual := fitnessMatrix[c.site][c.char]; actual != c.expected {
+			t.Errorf("ReadDMS: expected fitness %v of %d at site %d, actual %v", c.expected, c.char, c.site, actual)
+		}
+	}
+}
+
+func TestReadDMSInvalid(t *testing.T) {
+	invalid := []string{
+		"site,wildtype,mutant,score\n1,A,X,1\n",
+		"site,wildtype,mutant,score\n1,A,C,1\n1,G,T,1\n",
+		"site,wildtype,mutant,score\n1,A,C,-1\n",
+		"site,wildtype,mutant,score\n1,A,C,abc\n",
+		"site,wildtype,mutant\n1,A,C\n",
+		"site,wildtype,mutant,score\n0,A,C,1\n",
+		"site,wildtype,mutant,score\n100000000000,A,C,1\n",
+		"site,wildtype,mutant,score\n1,A,C,\"1\n",
+	}
+	for _, table := range invalid {
+		if _, _, err := ReadDMS(strings.NewReader(table), NewDMSOptions("ACGT")); err == nil {
+			t.Errorf("ReadDMS(%q): expected error", table)
+		}
+	}
+	opts := NewDMSOptions("ACGT")
+	opts.Transform = ClampScores(LinearScores, 0, 10)
+	if _, _, err := ReadDMS(strings.NewReader(invalid[2]), opts); err != nil {
+		t.Errorf("ReadDMS: expected clamped negative score to be valid, actual %v", err)
+	}
+	if _, _, err := ReadDMS(strings.NewReader("site,wildtype,mutant,score\n1,A,C,1\n"), NewDMSOptions("ACGTacgt")); err == nil {
+		t.Errorf("ReadDMS: expected error for an alphabet with letters repeated in another case")
+	}
+	if _, _, err := ReadDMS(strings.NewReader("site,wildtype,mutant,score\n1,A,C,\"1\n"), NewDMSOptions("ACGT")); err == nil || !strings.HasPrefix(err.Error(), "mesim: row 2: ") {
+		t.Errorf("ReadDMS: expected a prefixed error with the row of a malformed record, actual %v", err)
+	}
+}
+
+func TestLoadDMS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores.tsv")
+	if err := os.WriteFile(path, []byte("site\twildtype\tmutant\tscore\n1\tA\tT\t0.25\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fitnessMatrix, _, err := LoadDMS(path, NewDMSOptions("ACGT"))
+	if err != nil {
+		t.Fatalf("LoadDMS: unexpected error %v", err)
+	}
+	if fitnessMatrix[0][3] != 0.25 {
+		t.Errorf("LoadDMS: expected 0.25, actual %v", fitnessMatrix[0][3])
+	}
+}
@@ -0,0 +1,276 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"mesim/utils"
+)
+
+// Engine advances the population of a simulation by one generation. Each
+// engine implements a different population-genetic model on top of the
+// same mutation and fitness functions.
+type Engine interface {
+	// Advance produces the given generation from the current one.
+	Advance(sim *Simulation, generation int)
+}
+
+// WrightFisherEngine is the default engine: generations are discrete and
+// non-overlapping. Every generation goes through selection, mutation and
+// recombination in turn, and observers are notified at every stage.
+type WrightFisherEngine struct{}
+
+// Advance implements Engine.
+func (WrightFisherEngine) Advance(sim *Simulation, generation int) {
+	pop := sim.Population
+	notify(sim.Observers, BeforeSelection, pop, generation)
+	sim.updateFitnessModel(generation)
+	if sim.Selector != nil {
+		pop.ReplicateSelectWith(sim.Demography.PopSize(generation), sim.fitnessModel(), sim.Selector)
+	} else {
+		pop.ReplicateSelectModel(sim.Demography.PopSize(generation), sim.fitnessModel())
+	}
+	notify(sim.Observers, AfterSelection, pop, generation)
+
+	notify(sim.Observers, BeforeMutation, pop, generation)
+	if sim.ContextMutation != nil {
+		pop.MutateContext(sim.ContextMutation)
+	} else {
+		pop.Mutate(sim.MutationRate, sim.RateMatrix)
+	}
+	if sim.Indels != nil {
+		pop.Indel(sim.Indels)
+	}
+	notify(sim.Observers, AfterMutation, pop, generation)
+
+	notify(sim.Observers, BeforeRecombination, pop, generation)
+	pop.Recombine(sim.RecombinationRate)
+	notify(sim.Observers, AfterRecombination, pop, generation)
+
+	notify(sim.Observers, EndOfGeneration, pop, generation)
+}
+
+// MoranEngine is a Moran process with overlapping generations. In each
+// event one individual reproduces and one individual dies, so the
+// population size stays constant and the demography is ignored. A
+// generation consists of as many events as there are individuals.
+//
+// By default the parent is chosen in proportion to fitness and the dying
+// individual uniformly at random, which may be the parent itself. If
+// DeathSelection is true, the parent is chosen uniformly at random and the
+// dying individual in proportion to the inverse of fitness instead, so
+// that individuals of zero fitness die first. Without DeathSelection, the
+// population goes extinct once no individual has a non-zero fitness.
+//
+// The offspring is mutated once at birth, with MutationRate being the
+// rate per site per birth. Recombination and indels are not applied.
+// Observers are only notified at the end of every generation, and a
+// PopulationFitnessModel is only updated at the start of every generation.
+type MoranEngine struct {
+	DeathSelection bool
+}
+
+// Advance implements Engine.
+func (e MoranEngine) Advance(sim *Simulation, generation int) {
+	pop := sim.Population
+	s := pop.rng()
+	sim.updateFitnessModel(generation)
+	model := sim.fitnessModel()
+	numEvents := pop.Size()
+	for k := 0; k < numEvents; k++ {
+		logFitness := pop.ModelLogFitness(model)
+		var parent, dead int
+		if e.DeathSelection {
+			parent = s.Intn(len(logFitness))
+			for i := range logFitness {
+				logFitness[i] = -logFitness[i]
+			}
+			dead = sampleLogWeighted(s, logFitness)
+		} else {
+			if !anyViable(logFitness) {
+				pop.extinguish()
+				break
+			}
+			parent = sampleLogWeighted(s, logFitness)
+			dead = s.Intn(len(logFitness))
+		}
+		pop.replaceWithOffspring(dead, parent)
+		sim.mutateOffspring(s, dead)
+	}
+	notify(sim.Observers, EndOfGeneration, pop, generation)
+}
+
+// GillespieEngine simulates births and deaths in continuous time with the
+// Gillespie algorithm. Every individual gives birth at rate BirthRate times
+// its fitness and dies at rate DeathRate times N / CarryingCapacity, where
+// N is the current population size, so the population fluctuates around
+// its carrying capacity and may go extinct. If CarryingCapacity is zero,
+// deaths are density independent. The demography is ignored.
+//
+// A generation is one unit of time, and Time holds the time reached so
+// far. The offspring is mutated once at birth, with MutationRate being the
+// rate per site per birth. Recombination and indels are not applied.
+// Observers are only notified at the end of every generation, and a
+// PopulationFitnessModel is only updated at the start of every generation.
+type GillespieEngine struct {
+	BirthRate        float64
+	DeathRate        float64
+	CarryingCapacity int
+	Time             float64
+}
+
+// NewGillespieEngine creates a Gillespie engine with the given per capita
+// birth and death rates and carrying capacity.
+func NewGillespieEngine(birthRate, deathRate float64, carryingCapacity int) *GillespieEngine {
+	if birthRate < 0 || deathRate < 0 {
+		panic("Rates must not be negative")
+	}
+	if carryingCapacity < 0 {
+		panic("Carrying capacity must not be negative")
+	}
+	return &GillespieEngine{BirthRate: birthRate, DeathRate: deathRate, CarryingCapacity: carryingCapacity}
+}
+
+// Advance implements Engine.
+func (e *GillespieEngine) Advance(sim *Simulation, generation int) {
+	pop := sim.Population
+	s := pop.rng()
+	sim.updateFitnessModel(generation)
+	model := sim.fitnessModel()
+	endTime := float64(generation)
+	if e.Time < endTime-1 {
+		e.Time = endTime - 1
+	}
+	for pop.Size() > 0 {
+		fitness := pop.ModelFitness(model)
+		birthRate := e.BirthRate * utils.Sum(fitness...)
+		deathRate := e.DeathRate * float64(pop.Size())
+		if e.CarryingCapacity > 0 {
+			deathRate *= float64(pop.Size()) / float64(e.CarryingCapacity)
+		}
+		totalRate := birthRate + deathRate
+		if totalRate <= 0 {
+			break
+		}
+		e.Time += s.ExpFloat64() / totalRate
+		if e.Time >= endTime {
+			break
+		}
+		if s.Float64()*totalRate < birthRate {
+			logFitness := make([]float64, len(fitness))
+			for i, f := range fitness {
+				logFitness[i] = math.Log(f)
+			}
+			child := pop.addOffspring(sampleLogWeighted(s, logFitness))
+			sim.mutateOffspring(s, child)
+		} else {
+			pop.removeAt(s.Intn(pop.Size()))
+		}
+	}
+	e.Time = endTime
+	notify(sim.Observers, EndOfGeneration, pop, generation)
+}
+
+// updateFitnessModel updates the fitness model of the simulation with the
+// current population if it depends on it, and clears the cached fitness
+// values that it invalidates.
+func (sim *Simulation) updateFitnessModel(generation int) {
+	if model, ok := sim.FitnessModel.(PopulationFitnessModel); ok {
+		model.Update(sim.Population, generation)
+		sim.Population.InvalidateFitness()
+	}
+}
+
+// mutateOffspring mutates the i-th individual of the population at birth
+// with the mutation settings of the simulation.
+func (sim *Simulation) mutateOffspring(s *sampler.Sampler, i int) {
+	if sim.ContextMutation != nil {
+		sim.Population.mutateContextSequence(s, sim.ContextMutation, i)
+		return
+	}
+	if len(sim.RateMatrix) != sim.Population.NumChars {
+		panic("Number of rows in rateMatrix must be equal to the number of characters")
+	}
+	sim.Population.mutateSequence(s, i, sim.MutationRate, sim.RateMatrix)
+}
+
+// replaceWithOffspring replaces the i-th individual with a new offspring of
+// the parent-th individual.
+func (pop *Population) replaceWithOffspring(i, parent int) {
+	pop.Sequences[i] = utils.DeepCopyInts(pop.Sequences[parent])
+	if pop.Columns != nil {
+		pop.Columns[i] = utils.DeepCopyInts(pop.Columns[parent])
+	}
+	pop.ParentIDs[i] = pop.IDs[parent]
+	pop.IDs[i] = pop.newID()
+	if pop.Genealogy != nil {
+		pop.Genealogy.addOffspring(pop.IDs[i], pop.ParentIDs[i])
+	}
+	pop.fitness[i] = pop.fitness[parent]
+	pop.fitnessValid[i] = pop.fitnessValid[parent]
+}
+
+// addOffspring appends a new offspring of the parent-th individual to the
+// population and returns its index.
+func (pop *Population) addOffspring(parent int) int {
+	pop.Sequences = append(pop.Sequences, nil)
+	pop.IDs = append(pop.IDs, 0)
+	pop.ParentIDs = append(pop.ParentIDs, 0)
+	pop.fitness = append(pop.fitness, 0)
+	pop.fitnessValid = append(pop.fitnessValid, false)
+	if pop.Columns != nil {
+		pop.Columns = append(pop.Columns, nil)
+	}
+	i := pop.Size() - 1
+	pop.replaceWithOffspring(i, parent)
+	return i
+}
+
+// removeAt removes the i-th individual from the population. The last
+// individual takes its place.
+func (pop *Population) removeAt(i int) {
+	last := pop.Size() - 1
+	pop.Sequences[i] = pop.Sequences[last]
+	pop.IDs[i] = pop.IDs[last]
+	pop.ParentIDs[i] = pop.ParentIDs[last]
+	pop.fitness[i] = pop.fitness[last]
+	pop.fitnessValid[i] = pop.fitnessValid[last]
+	pop.Sequences = pop.Sequences[:last]
+	pop.IDs = pop.IDs[:last]
+	pop.ParentIDs = pop.ParentIDs[:last]
+	pop.fitness = pop.fitness[:last]
+	pop.fitnessValid = pop.fitnessValid[:last]
+	if pop.Columns != nil {
+		pop.Columns[i] = pop.Columns[last]
+		pop.Columns = pop.Columns[:last]
+	}
+}
+
+// sampleLogWeighted returns an index drawn with probability proportional to
+// the exponential of its log weight. If some log weights are +Inf, one of
+// them is drawn uniformly at random.
+func sampleLogWeighted(s *sampler.Sampler, logWeights []float64) int {
+	var infinite []int
+	for i, w := range logWeights {
+		if math.IsInf(w, 1) {
+			infinite = append(infinite, i)
+		}
+	}
+	if len(infinite) > 0 {
+		return infinite[s.Intn(len(infinite))]
+	}
+	logSum := utils.LogSumExp(logWeights...)
+	x := s.Float64()
+	last := 0
+	for i, w := range logWeights {
+		if math.IsInf(w, -1) {
+			continue
+		}
+		x -= math.Exp(w - logSum)
+		if x < 0 {
+			return i
+		}
+		last = i
+	}
+	// Rounding left x just above zero
+	return last
+}
@@ -0,0 +1,118 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"testing"
+)
+
+func TestMoranEngine(t *testing.T) {
+	for _, deathSelection := range []bool{false, true} {
+		sim := newTestSimulation(50)
+		sim.Engine = MoranEngine{DeathSelection: deathSelection}
+		sim.AddObserver(ObserverFunc(func(stage Stage, pop *Population, generation int) {
+			if pop.Size() != 4 {
+				t.Fatalf("MoranEngine: expected constant population size 4, actual %d", pop.Size())
+			}
+			ids := make(map[int]bool)
+			for _, id := range pop.IDs {
+				if ids[id] {
+					t.Fatalf("MoranEngine: duplicate ID %d", id)
+				}
+				ids[id] = true
+			}
+		}))
+		sim.AddStopCondition(FixationCondition{Site: 0, Char: 1})
+		result := sim.Run()
+		if result.Reason != StopFixation {
+			t.Errorf("MoranEngine(DeathSelection: %v): expected the fitter allele to fix, actual %v", deathSelection, result.Reason)
+		}
+	}
+}
+
+func TestMoranEngineMutation(t *testing.T) {
+	sim := newTestSimulation(1)
+	sim.FitnessMatrix = [][]float64{{1, 1}, {1, 1}, {1, 1}, {1, 1}}
+	sim.MutationRate = 1
+	sim.Engine = MoranEngine{}
+	numMutations := 0
+	sim.Population.MutationObservers = append(sim.Population.MutationObservers, MutationObserverFunc(func(pop *Population, i, site, oldChar, newChar int) {
+		numMutations++
+	}))
+	sim.Run()
+	if numMutations == 0 {
+		t.Errorf("MoranEngine: expected offspring to be mutated at birth")
+	}
+}
+
+func TestGillespieEngine(t *testing.T) {
+	seqSpace := make([][]int, 50)
+	for i := range seqSpace {
+		seqSpace[i] = []int{0, 0}
+	}
+	pop := NewPopulation(seqSpace, 2)
+	pop.Sampler = sampler.NewSampler(1)
+	fitnessMatrix := [][]float64{{1, 1}, {1, 1}}
+	sim := NewSimulation(pop, 20, 0, 0, [][]float64{{0, 1}, {1, 0}}, fitnessMatrix, MultiplicativeFitness)
+	engine := NewGillespieEngine(2, 1, 200)
+	sim.Engine = engine
+	sizes := []int{}
+	sim.AddObserver(ObserverFunc(func(stage Stage, pop *Population, generation int) {
+		sizes = append(sizes, pop.Size())
+	}))
+	sim.Run()
+	if engine.Time != 20 {
+		t.Errorf("GillespieEngine: expected time 20 after 20 generations, actual %v", engine.Time)
+	}
+	// Equilibrium where 2 = N / 200, that is N = 400
+	last := sizes[len(sizes)-1]
+	if last < 300 || last > 500 {
+		t.Errorf("GillespieEngine: expected population size near 400, actual %d", last)
+	}
+	for i, id := range pop.IDs {
+		if i > 0 && id == pop.IDs[i-1] {
+			t.Fatalf("GillespieEngine: duplicate ID %d", id)
+		}
+	}
+
+	sim = newTestSimulation(100)
+	sim.Engine = NewGillespieEngine(0, 1, 0)
+	if result := sim.Run(); result.Reason != StopExtinction {
+		t.Errorf("GillespieEngine without births: expected extinction, actual %v", result.Reason)
+	}
+}
+
+func TestMoranEngineLethal(t *testing.T) {
+	s := sampler.NewSampler(1)
+	for k := 0; k < 10; k++ {
+		if i := sampleLogWeighted(s, []float64{0, math.Inf(1), 0, math.Inf(-1)}); i != 1 {
+			t.Fatalf("sampleLogWeighted: expected the infinite weight to be drawn, actual %d", i)
+		}
+	}
+
+	// The lethal individual comes first, where the old fallback to the
+	// last index missed it
+	seqSpace := [][]int{{1}}
+	for i := 0; i < 9; i++ {
+		seqSpace = append(seqSpace, []int{0})
+	}
+	pop := NewPopulation(seqSpace, 2)
+	pop.Sampler = sampler.NewSampler(1)
+	lethalID := pop.IDs[0]
+	sim := NewSimulation(pop, 1, 0, 0, [][]float64{{0, 1}, {1, 0}}, [][]float64{{1, 0}}, MultiplicativeFitness)
+	sim.Engine = MoranEngine{DeathSelection: true}
+	sim.Run()
+	for _, id := range pop.IDs {
+		if id == lethalID {
+			t.Errorf("MoranEngine(DeathSelection: true): expected the individual of zero fitness to die first")
+		}
+	}
+
+	pop = NewPopulation([][]int{{1}, {1}}, 2)
+	sim = NewSimulation(pop, 1, 0, 0, [][]float64{{0, 1}, {1, 0}}, [][]float64{{1, 0}}, MultiplicativeFitness)
+	sim.Engine = MoranEngine{}
+	sim.Run()
+	if pop.Size() != 0 {
+		t.Errorf("MoranEngine: expected extinction without individuals of non-zero fitness, actual size %d", pop.Size())
+	}
+}
@@ -0,0 +1,288 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"sync"
+)
+
+// Schedule decides which environments are active in every generation.
+// Weights returns one weight per environment; the weights of a generation
+// sum to one, and a single weight of one means that only that environment
+// is active. Schedules are queried with non-decreasing generations.
+type Schedule interface {
+	Weights(generation int) []float64
+}
+
+// EnvironmentFitness is a fitness model that changes with the environment.
+// Every generation the schedule weights the environments, and the log
+// fitness of a sequence is the weighted sum of its log fitness in every
+// environment, so that a switch of environment uses the fitness of the
+// new environment and intermediate weights interpolate between them.
+//
+// Environments that implement PopulationFitnessModel are updated along
+// with the schedule.
+type EnvironmentFitness struct {
+	Environments []FitnessModel
+	Schedule     Schedule
+
+	mu      sync.Mutex
+	weights []float64
+}
+
+// NewEnvironmentFitness creates a fitness model that follows the schedule
+// through the given environments.
+func NewEnvironmentFitness(schedule Schedule, environments ...FitnessModel) *EnvironmentFitness {
+	if len(environments) == 0 {
+		panic("There must be at least one environment")
+	}
+	return &EnvironmentFitness{Environments: environments, Schedule: schedule}
+}
+
+// NewMatrixEnvironments returns one environment per fitness matrix, all
+// evaluated with the same fitness function.
+func NewMatrixEnvironments(fitnessFunc FitnessFunc, fitnessMatrices ...[][]float64) []FitnessModel {
+	environments := make([]FitnessModel, len(fitnessMatrices))
+	for k, fitnessMatrix := range fitnessMatrices {
+		environments[k] = MatrixFitness{Matrix: fitnessMatrix, Func: fitnessFunc}
+	}
+	return environments
+}
+
+// Update implements PopulationFitnessModel.
+func (m *EnvironmentFitness) Update(pop *Population, generation int) {
+	weights := m.Schedule.Weights(generation)
+	if len(weights) != len(m.Environments) {
+		panic("Schedule must return a weight for every environment")
+	}
+	m.mu.Lock()
+	m.weights = weights
+	m.mu.Unlock()
+	for _, env := range m.Environments {
+		if popModel, ok := env.(PopulationFitnessModel); ok {
+			popModel.Update(pop, generation)
+		}
+	}
+}
+
+// Weights returns the weights of the environments in the current
+// generation.
+func (m *EnvironmentFitness) Weights() []float64 {
+	return copyFloats(m.currentWeights())
+}
+
+// currentWeights returns the weights of the current generation, which are
+// those of generation 0 until the first update.
+func (m *EnvironmentFitness) currentWeights() []float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.weights == nil {
+		m.weights = m.Schedule.Weights(0)
+	}
+	return m.weights
+}
+
+// Fitness implements FitnessModel.
+func (m *EnvironmentFitness) Fitness(seq []int) float64 {
+	return math.Exp(m.LogFitness(seq))
+}
+
+// LogFitness implements LogFitnessModel.
+func (m *EnvironmentFitness) LogFitness(seq []int) float64 {
+	logFitness := 0.0
+	for k, w := range m.currentWeights() {
+		if w == 0 {
+			continue
+		}
+		env := m.Environments[k]
+		if logModel, ok := env.(LogFitnessModel); ok {
+			logFitness += w * logModel.LogFitness(seq)
+		} else {
+			logFitness += w * math.Log(env.Fitness(seq))
+		}
+	}
+	return logFitness
+}
+
+// oneHot returns weights in which only environment k is active.
+func oneHot(numEnvironments, k int) []float64 {
+	weights := make([]float64, numEnvironments)
+	weights[k] = 1
+	return weights
+}
+
+// PeriodicSchedule cycles through the environments, staying in environment
+// k for Durations[k] generations, starting with environment 0 in
+// generation 0.
+type PeriodicSchedule struct {
+	Durations []int
+}
+
+// NewPeriodicSchedule creates a periodic schedule with the given durations.
+func NewPeriodicSchedule(durations ...int) *PeriodicSchedule {
+	if len(durations) == 0 {
+		panic("There must be at least one duration")
+	}
+	for _, d := range durations {
+		if d < 1 {
+			panic("Durations must be greater than zero")
+		}
+	}
+	return &PeriodicSchedule{Durations: durations}
+}
+
+// Weights implements Schedule.
+func (sch *PeriodicSchedule) Weights(generation int) []float64 {
+	period := 0
+	for _, d := range sch.Durations {
+		period += d
+	}
+	t := generation % period
+	if t < 0 {
+		t += period
+	}
+	for k, d := range sch.Durations {
+		if t < d {
+			return oneHot(len(sch.Durations), k)
+		}
+		t -= d
+	}
+	return oneHot(len(sch.Durations), len(sch.Durations)-1)
+}
+
+// SeasonalSchedule interpolates smoothly between two environments with the
+// given period in generations. The weight of environment 1 is
+// (1 - cos(2 pi (generation + Phase) / Period)) / 2, so generation 0 is
+// fully in environment 0 when Phase is zero and the population is fully
+// in environment 1 half a period later.
+type SeasonalSchedule struct {
+	Period float64
+	Phase  float64
+}
+
+// NewSeasonalSchedule creates a seasonal schedule with the given period.
+func NewSeasonalSchedule(period float64) *SeasonalSchedule {
+	if period <= 0 {
+		panic("Period must be greater than zero")
+	}
+	return &SeasonalSchedule{Period: period}
+}
+
+// Weights implements Schedule.
+func (sch *SeasonalSchedule) Weights(generation int) []float64 {
+	w := (1 - math.Cos(2*math.Pi*(float64(generation)+sch.Phase)/sch.Period)) / 2
+	return []float64{1 - w, w}
+}
+
+// DosingSchedule switches between a drug-free environment 0 and a treated
+// environment 1. Treatment starts in generation Start and alternates
+// between OnDuration generations with the drug and OffDuration generations
+// without it, for NumDoses courses or indefinitely if NumDoses is zero.
+// An OffDuration of zero means continuous treatment.
+type DosingSchedule struct {
+	Start       int
+	OnDuration  int
+	OffDuration int
+	NumDoses    int
+}
+
+// NewDosingSchedule creates a dosing schedule.
+func NewDosingSchedule(start, onDuration, offDuration, numDoses int) *DosingSchedule {
+	if onDuration < 1 {
+		panic("Treatment duration must be greater than zero")
+	}
+	if offDuration < 0 || numDoses < 0 {
+		panic("Interruption duration and number of doses must not be negative")
+	}
+	return &DosingSchedule{Start: start, OnDuration: onDuration, OffDuration: offDuration, NumDoses: numDoses}
+}
+
+// Treated reports whether the drug is given in the given generation.
+func (sch *DosingSchedule) Treated(generation int) bool {
+	if generation < sch.Start {
+		return false
+	}
+	t := generation - sch.Start
+	course := sch.OnDuration + sch.OffDuration
+	if sch.NumDoses > 0 && t >= sch.NumDoses*course {
+		return false
+	}
+	return t%course < sch.OnDuration
+}
+
+// Weights implements Schedule.
+func (sch *DosingSchedule) Weights(generation int) []float64 {
+	if sch.Treated(generation) {
+		return []float64{0, 1}
+	}
+	return []float64{1, 0}
+}
+
+// MarkovSchedule switches between environments at random following a
+// Markov chain. Transitions[k][l] is the probability of moving from
+// environment k to environment l from one generation to the next. The
+// chain starts in environment Initial in generation 0 and draws from
+// Sampler, or from sampler.Default if nil.
+type MarkovSchedule struct {
+	Transitions [][]float64
+	Initial     int
+	Sampler     *sampler.Sampler
+
+	state      int
+	generation int
+	history    []int
+}
+
+// NewMarkovSchedule creates a Markov schedule with the given transition
+// matrix and initial environment.
+func NewMarkovSchedule(s *sampler.Sampler, transitions [][]float64, initial int) *MarkovSchedule {
+	for _, row := range transitions {
+		if len(row) != len(transitions) {
+			panic("Transition matrix must be square")
+		}
+		sum := 0.0
+		for _, p := range row {
+			if p < 0 {
+				panic("Transition probabilities must not be negative")
+			}
+			sum += p
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			panic("Rows of the transition matrix must sum to one")
+		}
+	}
+	if initial < 0 || initial >= len(transitions) {
+		panic("Initial environment out of range")
+	}
+	return &MarkovSchedule{Transitions: transitions, Initial: initial, Sampler: s, state: initial, history: []int{initial}}
+}
+
+// Weights implements Schedule.
+func (sch *MarkovSchedule) Weights(generation int) []float64 {
+	return oneHot(len(sch.Transitions), sch.Environment(generation))
+}
+
+// Environment returns the environment of the given generation, advancing
+// the chain as needed.
+func (sch *MarkovSchedule) Environment(generation int) int {
+	if sch.history == nil {
+		sch.state = sch.Initial
+		sch.history = []int{sch.Initial}
+	}
+	if generation < sch.generation {
+		if generation < 0 {
+			return sch.Initial
+		}
+		return sch.history[generation]
+	}
+	s := sch.Sampler
+	if s == nil {
+		s = sampler.Default
+	}
+	for sch.generation < generation {
+		sch.state = s.MultinomialWhere(1, sch.Transitions[sch.state], 1)[0]
+		sch.history = append(sch.history, sch.state)
+		sch.generation++
+	}
+	return sch.state
+}
@@ -0,0 +1,95 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"testing"
+)
+
+func TestPeriodicSchedule(t *testing.T) {
+	sch := NewPeriodicSchedule(2, 3)
+	expected := []int{0, 0, 1, 1, 1, 0, 0, 1}
+	for g, env := range expected {
+		if w := sch.Weights(g); w[env] != 1 {
+			t.Errorf("Weights(%d): expected environment %d, actual %v", g, env, w)
+		}
+	}
+}
+
+func TestSeasonalSchedule(t *testing.T) {
+	sch := NewSeasonalSchedule(10)
+	cases := map[int]float64{0: 0, 5: 1, 10: 0, 15: 1}
+	for g, expected := range cases {
+		if w := sch.Weights(g); math.Abs(w[1]-expected) > 1e-12 || math.Abs(w[0]+w[1]-1) > 1e-12 {
+			t.Errorf("Weights(%d): expected weight %v of environment 1, actual %v", g, expected, w)
+		}
+	}
+}
+
+func TestDosingSchedule(t *testing.T) {
+	sch := NewDosingSchedule(2, 3, 2, 2)
+	expected := []bool{false, false, true, true, true, false, false, true, true, true, false, false, false}
+	for g, treated := range expected {
+		if sch.Treated(g) != treated {
+			t.Errorf("Treated(%d): expected %v", g, treated)
+		}
+	}
+}
+
+func TestMarkovSchedule(t *testing.T) {
+	sch := NewMarkovSchedule(sampler.NewSampler(1), [][]float64{{0.9, 0.1}, {0.2, 0.8}}, 0)
+	numIn1 := 0
+	envs := make([]int, 10000)
+	for g := range envs {
+		envs[g] = sch.Environment(g)
+		numIn1 += envs[g]
+	}
+	if envs[0] != 0 {
+		t.Errorf("Environment(0): expected initial environment 0, actual %d", envs[0])
+	}
+	// Stationary probability of environment 1 is 0.1 / (0.1 + 0.2)
+	if f := float64(numIn1) / 10000; math.Abs(f-1.0/3) > 0.05 {
+		t.Errorf("MarkovSchedule: expected a third of the time in environment 1, actual %v", f)
+	}
+	for _, g := range []int{5, 500} {
+		if sch.Environment(g) != envs[g] {
+			t.Errorf("Environment(%d): expected the same environment when queried again", g)
+		}
+	}
+}
+
+func TestEnvironmentFitness(t *testing.T) {
+	drugFree := [][]float64{{1, 0.5}}
+	drug := [][]float64{{0.1, 1}}
+	model := NewEnvironmentFitness(NewSeasonalSchedule(4), NewMatrixEnvironments(MultiplicativeFitness, drugFree, drug)...)
+	model.Update(nil, 1)
+	// Half way between the environments
+	if f := model.Fitness([]int{1}); math.Abs(f-math.Sqrt(0.5)) > 1e-12 {
+		t.Errorf("Fitness: expected geometric mean %v, actual %v", math.Sqrt(0.5), f)
+	}
+
+	// Resistance (1 at site 0) rises during treatment and falls once it is
+	// interrupted
+	seqSpace := make([][]int, 100)
+	for i := range seqSpace {
+		seqSpace[i] = []int{0}
+	}
+	seqSpace[0][0] = 1
+	pop := NewPopulation(seqSpace, 2)
+	pop.Sampler = sampler.NewSampler(1)
+	sim := NewSimulation(pop, 40, 0.01, 0, [][]float64{{0, 1}, {1, 0}}, nil, nil)
+	sim.FitnessModel = NewEnvironmentFitness(NewDosingSchedule(1, 20, 0, 1), NewMatrixEnvironments(MultiplicativeFitness, drugFree, drug)...)
+	frequencies := make(map[int]float64)
+	sim.AddObserver(ObserverFunc(func(stage Stage, pop *Population, generation int) {
+		if stage == EndOfGeneration {
+			frequencies[generation] = pop.AlleleFrequency(0, 1)
+		}
+	}))
+	sim.Run()
+	if frequencies[20] < 0.9 {
+		t.Errorf("Simulation under treatment: expected resistance to rise, actual frequency %v", frequencies[20])
+	}
+	if frequencies[40] > 0.1 {
+		t.Errorf("Simulation after treatment interruption: expected resistance to fall, actual frequency %v", frequencies[40])
+	}
+}
@@ -2,7 +2,6 @@ package mesim
 
 import (
 	"math"
-	"math/rand"
 	"mesim/sampler"
 	"mesim/utils"
 	"sort"
@@ -23,18 +22,61 @@ func SeqSpaceToFitSpace(seqSpace [][]int, fitnessMatrix [][]float64, totalFitnes
 	return fitnessSpace
 }
 
-// SeqSpaceToLogFitSpace
+// SeqSpaceToLogFitSpace is like SeqSpaceToFitSpace but totalFitnessFunc
+// returns log fitness, such as LogMultiplicativeFitness. If normalized is
+// true, the log-sum-exp of the values is subtracted so that their
+// exponentials sum to one.
 func SeqSpaceToLogFitSpace(seqSpace [][]int, fitnessMatrix [][]float64, totalFitnessFunc FitnessFunc, normalized bool) []float64 {
-	fitnessSpace := seqSpaceToFitSpace(seqSpace, fitnessMatrix, totalFitnessFunc)
+	logFitnessSpace := seqSpaceToFitSpace(seqSpace, fitnessMatrix, totalFitnessFunc)
+	if normalized == true {
+		logDenominator := utils.LogSumExp(logFitnessSpace...)
+		for i := range logFitnessSpace {
+			logFitnessSpace[i] = logFitnessSpace[i] - logDenominator
+		}
+	}
+	return logFitnessSpace
+}
+
+// SeqSpaceToFitSpaceModel is like SeqSpaceToFitSpace but evaluates the
+// fitness of every sequence with the given fitness model.
+func SeqSpaceToFitSpaceModel(seqSpace [][]int, model FitnessModel, normalized bool) []float64 {
+	validateSeqSpace(seqSpace)
+	fitnessSpace := make([]float64, len(seqSpace))
+	for i, seq := range seqSpace {
+		fitnessSpace[i] = model.Fitness(seq)
+	}
 	if normalized == true {
-		fitnessDenominator := math.Log(utils.Sum(fitnessSpace...))
+		fitnessDenominator := utils.Sum(fitnessSpace...)
 		for i := range fitnessSpace {
-			fitnessSpace[i] = fitnessSpace[i] - fitnessDenominator
+			fitnessSpace[i] = fitnessSpace[i] / fitnessDenominator
 		}
 	}
 	return fitnessSpace
 }
 
+// SeqSpaceToLogFitSpaceModel returns the log fitness of every sequence
+// under the given fitness model. If normalized is true, the values are
+// shifted so that their exponentials sum to one.
+func SeqSpaceToLogFitSpaceModel(seqSpace [][]int, model FitnessModel, normalized bool) []float64 {
+	validateSeqSpace(seqSpace)
+	logModel, isLog := model.(LogFitnessModel)
+	logFitnessSpace := make([]float64, len(seqSpace))
+	for i, seq := range seqSpace {
+		if isLog {
+			logFitnessSpace[i] = logModel.LogFitness(seq)
+		} else {
+			logFitnessSpace[i] = math.Log(model.Fitness(seq))
+		}
+	}
+	if normalized == true {
+		logDenominator := utils.LogSumExp(logFitnessSpace...)
+		for i := range logFitnessSpace {
+			logFitnessSpace[i] -= logDenominator
+		}
+	}
+	return logFitnessSpace
+}
+
 func seqSpaceToFitSpace(seqSpace [][]int, fitnessMatrix [][]float64, totalFitnessFunc FitnessFunc) []float64 {
 	if len(seqSpace) == 0 {
 		panic("Length of seqSpace must be greater than zero")
@@ -57,82 +99,391 @@ func seqSpaceToFitSpace(seqSpace [][]int, fitnessMatrix [][]float64, totalFitnes
 
 // ReplicateSelect
 func ReplicateSelect(ancSeqSpace [][]int, nextPopSize int, fitnessMatrix [][]float64, totalFitnessFunc FitnessFunc) [][]int {
-	normedFitSpace := SeqSpaceToFitSpace(ancSeqSpace, fitnessMatrix, totalFitnessFunc, true)
-	ancSeqSpaceCnts := sampler.MultinomialSample(nextPopSize, normedFitSpace)
+	return ReplicateSelectWith(sampler.Default, ancSeqSpace, nextPopSize, fitnessMatrix, totalFitnessFunc)
+}
+
+// ReplicateSelectWith is like ReplicateSelect but draws from the given
+// sampler.
+func ReplicateSelectWith(s *sampler.Sampler, ancSeqSpace [][]int, nextPopSize int, fitnessMatrix [][]float64, totalFitnessFunc FitnessFunc) [][]int {
+	if len(fitnessMatrix) == 0 {
+		panic("Length of fitnessMatrix must be greater than zero")
+	}
+	pop := newPopulation(ancSeqSpace, len(fitnessMatrix[0]))
+	pop.Sampler = s
+	pop.ReplicateSelect(nextPopSize, fitnessMatrix, totalFitnessFunc)
+	return pop.Sequences
+}
+
+// ReplicateSelectLog is like ReplicateSelect but totalFitnessFunc returns
+// log fitness.
+func ReplicateSelectLog(ancSeqSpace [][]int, nextPopSize int, fitnessMatrix [][]float64, totalFitnessFunc FitnessFunc) [][]int {
+	return ReplicateSelectLogWith(sampler.Default, ancSeqSpace, nextPopSize, fitnessMatrix, totalFitnessFunc)
+}
+
+// ReplicateSelectLogWith is like ReplicateSelectLog but draws from the
+// given sampler.
+func ReplicateSelectLogWith(s *sampler.Sampler, ancSeqSpace [][]int, nextPopSize int, fitnessMatrix [][]float64, totalFitnessFunc FitnessFunc) [][]int {
+	if len(fitnessMatrix) == 0 {
+		panic("Length of fitnessMatrix must be greater than zero")
+	}
+	pop := newPopulation(ancSeqSpace, len(fitnessMatrix[0]))
+	pop.Sampler = s
+	pop.ReplicateSelectLog(nextPopSize, fitnessMatrix, totalFitnessFunc)
+	return pop.Sequences
+}
+
+// ReplicateSelectModel is like ReplicateSelect but evaluates fitness with
+// the given fitness model.
+func ReplicateSelectModel(ancSeqSpace [][]int, nextPopSize int, model FitnessModel) [][]int {
+	return ReplicateSelectModelWith(sampler.Default, ancSeqSpace, nextPopSize, model)
+}
+
+// ReplicateSelectModelWith is like ReplicateSelectModel but draws from the
+// given sampler.
+func ReplicateSelectModelWith(s *sampler.Sampler, ancSeqSpace [][]int, nextPopSize int, model FitnessModel) [][]int {
+	pop := newPopulation(ancSeqSpace, 0)
+	pop.Sampler = s
+	pop.ReplicateSelectModel(nextPopSize, model)
+	return pop.Sequences
+}
+
+// ReplicateSelect replaces the population with nextPopSize offspring
+// sampled from the current individuals in proportion to their fitness.
+// nextPopSize may be larger or smaller than the current population size;
+// a size of zero leaves an extinct, empty population.
+// Each offspring is a copy of its parent with a new ID, and its parent ID
+// is set to the ID of the individual it was copied from. Offspring inherit
+// the cached fitness of their parent.
+func (pop *Population) ReplicateSelect(nextPopSize int, fitnessMatrix [][]float64, totalFitnessFunc FitnessFunc) {
+	if len(fitnessMatrix) == 0 {
+		panic("Length of fitnessMatrix must be greater than zero")
+	}
+	pop.ReplicateSelectModel(nextPopSize, MatrixFitness{Matrix: fitnessMatrix, Func: totalFitnessFunc})
+}
+
+// ReplicateSelectLog is like ReplicateSelect but totalFitnessFunc returns
+// log fitness. Selection stays in log space throughout, so fitness values
+// too small to represent as a float64, as with multiplicative fitness over
+// long genomes, are still told apart.
+func (pop *Population) ReplicateSelectLog(nextPopSize int, fitnessMatrix [][]float64, totalFitnessFunc FitnessFunc) {
+	if len(fitnessMatrix) == 0 {
+		panic("Length of fitnessMatrix must be greater than zero")
+	}
+	pop.ReplicateSelectModel(nextPopSize, LogMatrixFitness{Matrix: fitnessMatrix, Func: totalFitnessFunc})
+}
+
+// ReplicateSelectModel is like ReplicateSelect but evaluates fitness with
+// the given fitness model. If the model implements LogFitnessModel,
+// offspring are sampled with MultinomialLogSample from its log fitness
+// values. If every individual has zero fitness, the population goes
+// extinct.
+func (pop *Population) ReplicateSelectModel(nextPopSize int, model FitnessModel) {
+	pop.replicate(nextPopSize, func() []int {
+		var ancSeqSpaceCnts []int
+		if _, ok := model.(LogFitnessModel); ok {
+			logFitnessSpace := pop.ModelLogFitness(model)
+			if !anyViable(logFitnessSpace) {
+				return nil
+			}
+			ancSeqSpaceCnts = pop.rng().MultinomialLogSample(nextPopSize, logFitnessSpace)
+		} else {
+			fitnessSpace := pop.ModelFitness(model)
+			fitnessDenominator := utils.Sum(fitnessSpace...)
+			if fitnessDenominator == 0 {
+				return nil
+			}
+			for i := range fitnessSpace {
+				fitnessSpace[i] = fitnessSpace[i] / fitnessDenominator
+			}
+			ancSeqSpaceCnts = pop.rng().MultinomialSample(nextPopSize, fitnessSpace)
+		}
+		return ancSeqSpaceCnts
+	})
+}
+
+// ReplicateSelectWith is like ReplicateSelectModel but the number of
+// offspring of every individual is decided by the given selector from the
+// log fitness of the individuals. If every individual has zero fitness,
+// the population goes extinct.
+func (pop *Population) ReplicateSelectWith(nextPopSize int, model FitnessModel, selector Selector) {
+	pop.replicate(nextPopSize, func() []int {
+		logFitnessSpace := pop.ModelLogFitness(model)
+		if !anyViable(logFitnessSpace) {
+			return nil
+		}
+		ancSeqSpaceCnts := selector.Select(pop.rng(), logFitnessSpace, nextPopSize)
+		if len(ancSeqSpaceCnts) != pop.Size() {
+			panic("Selector must return a count for every individual")
+		}
+		return ancSeqSpaceCnts
+	})
+}
 
-	newSeqSpace := make([][]int, len(ancSeqSpace))
+// anyViable reports whether any of the given log fitness values belongs to
+// an individual that can have offspring.
+func anyViable(logFitnessSpace []float64) bool {
+	for _, logFitness := range logFitnessSpace {
+		if !math.IsInf(logFitness, -1) {
+			return true
+		}
+	}
+	return false
+}
+
+// replicate replaces the population with nextPopSize offspring. The number
+// of offspring of every individual is given by offspringCounts, which is
+// only called for a non-empty population and must sum to nextPopSize, or
+// return nil if no individual can have offspring, in which case the
+// population goes extinct.
+func (pop *Population) replicate(nextPopSize int, offspringCounts func() []int) {
+	if nextPopSize < 0 {
+		panic("Population size must not be negative")
+	}
+	if nextPopSize == 0 {
+		pop.extinguish()
+		return
+	}
+	if pop.Size() == 0 {
+		panic("Cannot replicate an extinct population")
+	}
+	ancSeqSpaceCnts := offspringCounts()
+	if ancSeqSpaceCnts == nil {
+		pop.extinguish()
+		return
+	}
+	total := 0
+	for _, cnt := range ancSeqSpaceCnts {
+		total += cnt
+	}
+	if total != nextPopSize {
+		panic("Offspring counts must sum to the population size")
+	}
+
+	newSeqSpace := make([][]int, nextPopSize)
+	newIDs := make([]int, nextPopSize)
+	newParentIDs := make([]int, nextPopSize)
+	newFitness := make([]float64, nextPopSize)
+	newFitnessValid := make([]bool, nextPopSize)
+	var newColumns [][]int
+	if pop.Columns != nil {
+		newColumns = make([][]int, nextPopSize)
+	}
 	idxOffset := 0
 	for ancPos, cnt := range ancSeqSpaceCnts {
 		for i := 0 + idxOffset; i < cnt+idxOffset; i++ {
-			newSeqSpace[i] = ancSeqSpace[ancPos]
+			newSeqSpace[i] = utils.DeepCopyInts(pop.Sequences[ancPos])
+			if newColumns != nil {
+				newColumns[i] = utils.DeepCopyInts(pop.Columns[ancPos])
+			}
+			newIDs[i] = pop.newID()
+			newParentIDs[i] = pop.IDs[ancPos]
+			if pop.Genealogy != nil {
+				pop.Genealogy.addOffspring(newIDs[i], pop.IDs[ancPos])
+			}
+			newFitness[i] = pop.fitness[ancPos]
+			newFitnessValid[i] = pop.fitnessValid[ancPos]
 		}
 		idxOffset += cnt
 	}
-	return newSeqSpace
+	pop.Sequences = newSeqSpace
+	pop.IDs = newIDs
+	pop.ParentIDs = newParentIDs
+	pop.fitness = newFitness
+	pop.fitnessValid = newFitnessValid
+	pop.Columns = newColumns
+}
+
+// extinguish removes every individual from the population.
+func (pop *Population) extinguish() {
+	pop.Sequences = [][]int{}
+	pop.IDs = []int{}
+	pop.ParentIDs = []int{}
+	if pop.Columns != nil {
+		pop.Columns = [][]int{}
+	}
+	pop.InvalidateFitness()
 }
 
 // RecombineSeqSpace
 func RecombineSeqSpace(seqSpace *[][]int, r float64) {
+	RecombineSeqSpaceWith(sampler.Default, seqSpace, r)
+}
+
+// RecombineSeqSpaceWith is like RecombineSeqSpace but draws from the given
+// sampler.
+func RecombineSeqSpaceWith(s *sampler.Sampler, seqSpace *[][]int, r float64) {
+	pop := newPopulation(*seqSpace, 0)
+	pop.Sampler = s
+	pop.Recombine(r)
+	*seqSpace = pop.Sequences
+}
+
+// Recombine exchanges segments between randomly paired sequences of the
+// population. The number of breakpoints per pair is binomially distributed
+// with r as the per-breakpoint recombination probability. If the alignment
+// is tracked, breakpoints are placed between alignment columns so that
+// homologous segments are exchanged. The cached fitness of recombined
+// individuals is invalidated. If the genealogy is recorded, recombinants
+// are recorded with both parents and the breakpoints.
+func (pop *Population) Recombine(r float64) {
+	s := pop.rng()
 	// Randomly pick (by permutation) sequence pairs
-	popSize := len(*seqSpace)
-	numSites := len((*seqSpace)[0]) - 1 // One less site because we are counting breakpoints
-	permSampleIndexes := rand.Perm(popSize)
+	popSize := pop.Size()
+	numSites := pop.NumColumns() - 1 // One less site because we are counting breakpoints
+	permSampleIndexes := s.Perm(popSize)
+	var ranks []int
+	if pop.Columns != nil {
+		ranks = pop.columnRanks()
+	}
 
 	// For each sequence pair, determine number of recombination events e
-	var numEvents, seqID1, seqID2, startPos int
-	var s1Ptr, s2Ptr *[]int
-	var newS1, newS2, permSites []int
-	orientation := true
+	var numEvents, seqID1, seqID2 int
+	var permSites []int
 	for i := 0; i < popSize-1; i += 2 {
 		// Processing each pair could be made into a goroutine
-		numEvents = sampler.BinomialSample(numSites, r)
+		numEvents = s.BinomialSample(numSites, r)
 
 		// For each sequence pair, randomly pick (by permutation) breakpoints
 		if numEvents > 0 {
 			seqID1 = permSampleIndexes[i]
 			seqID2 = permSampleIndexes[i+1]
-			startPos = 0
-			newS1 = []int{}
-			newS2 = []int{}
-			orientation = true
-
-			s1Ptr, s2Ptr = &(*seqSpace)[seqID1], &(*seqSpace)[seqID2]
 
-			permSites = rand.Perm(numSites)[:numEvents] // +1 so that lowest breakpoint is [0:1] and highest is [-1:]
+			permSites = s.Perm(numSites)[:numEvents]
 			sort.Ints(permSites)
+			for k := range permSites {
+				permSites[k]++ // Lowest pos == 1, highest pos == len - 1
+			}
 
-			for _, pos := range permSites {
-				pos++ // Lowest pos == 1, highest pos == len - 1
-				if orientation == true {
-					newS1 = append(newS1, (*s1Ptr)[startPos:pos]...)
-					newS2 = append(newS2, (*s2Ptr)[startPos:pos]...)
-					orientation = false
-				} else {
-					newS1 = append(newS1, (*s2Ptr)[startPos:pos]...)
-					newS2 = append(newS2, (*s1Ptr)[startPos:pos]...)
-					orientation = true
-				}
-				startPos = pos
+			splits1 := pop.splitPositions(seqID1, permSites, ranks)
+			splits2 := pop.splitPositions(seqID2, permSites, ranks)
+			pop.Sequences[seqID1], pop.Sequences[seqID2] = crossover(pop.Sequences[seqID1], pop.Sequences[seqID2], splits1, splits2)
+			if pop.Columns != nil {
+				pop.Columns[seqID1], pop.Columns[seqID2] = crossover(pop.Columns[seqID1], pop.Columns[seqID2], splits1, splits2)
 			}
-			if orientation == true {
-				newS1 = append(newS1, (*s1Ptr)[startPos:]...)
-				newS2 = append(newS2, (*s2Ptr)[startPos:]...)
-				orientation = false
-			} else {
-				newS1 = append(newS1, (*s2Ptr)[startPos:]...)
-				newS2 = append(newS2, (*s1Ptr)[startPos:]...)
-				orientation = true
+			if pop.Genealogy != nil {
+				pop.recordRecombination(seqID1, seqID2, permSites)
 			}
-			(*seqSpace)[seqID1] = newS1
-			(*seqSpace)[seqID2] = newS2
+			pop.invalidateFitnessAt(seqID1)
+			pop.invalidateFitnessAt(seqID2)
 		}
 	}
 }
 
+// recordRecombination records the recombination of the i1-th and i2-th
+// individuals at the given breakpoints in the genealogy of the population.
+// Recombinants that cannot be recorded as offspring of both parents get
+// new IDs, and their parent IDs are set to their IDs before recombination.
+func (pop *Population) recordRecombination(i1, i2 int, breakpoints []int) {
+	id1, id2 := pop.IDs[i1], pop.IDs[i2]
+	newID1, newID2 := pop.Genealogy.recombine(id1, id2, pop.newID, breakpoints)
+	if newID1 != id1 {
+		pop.IDs[i1], pop.ParentIDs[i1] = newID1, id1
+		pop.IDs[i2], pop.ParentIDs[i2] = newID2, id2
+	}
+}
+
+// splitPositions converts breakpoints into positions within the i-th
+// sequence. Without an alignment, breakpoints are positions. With an
+// alignment, a breakpoint b falls before the first character whose column
+// has rank b or more.
+func (pop *Population) splitPositions(i int, breakpoints []int, ranks []int) []int {
+	if ranks == nil {
+		return breakpoints
+	}
+	splits := make([]int, len(breakpoints))
+	pos := 0
+	cols := pop.Columns[i]
+	for k, b := range breakpoints {
+		for pos < len(cols) && ranks[cols[pos]] < b {
+			pos++
+		}
+		splits[k] = pos
+	}
+	return splits
+}
+
+// crossover returns the two recombinant products of s1 and s2 given the
+// positions at which each of them is split.
+func crossover(s1, s2 []int, splits1, splits2 []int) (newS1, newS2 []int) {
+	newS1 = []int{}
+	newS2 = []int{}
+	start1, start2 := 0, 0
+	orientation := true
+	for k := range splits1 {
+		if orientation == true {
+			newS1 = append(newS1, s1[start1:splits1[k]]...)
+			newS2 = append(newS2, s2[start2:splits2[k]]...)
+			orientation = false
+		} else {
+			newS1 = append(newS1, s2[start2:splits2[k]]...)
+			newS2 = append(newS2, s1[start1:splits1[k]]...)
+			orientation = true
+		}
+		start1, start2 = splits1[k], splits2[k]
+	}
+	if orientation == true {
+		newS1 = append(newS1, s1[start1:]...)
+		newS2 = append(newS2, s2[start2:]...)
+	} else {
+		newS1 = append(newS1, s2[start2:]...)
+		newS2 = append(newS2, s1[start1:]...)
+	}
+	return
+}
+
 // EvolveSeqSpaceConstPop
 func EvolveSeqSpaceConstPop(seqSpace *[][]int, mutationRate float64, recombinationRate float64, charTransitionMatrix [][]float64, fitnessMatrix [][]float64, fitnessFunc FitnessFunc) {
-	popSize := len(*seqSpace)
-	*seqSpace = ReplicateSelect(*seqSpace, popSize, fitnessMatrix, fitnessFunc)
-	MutateSeqSpace(seqSpace, mutationRate, charTransitionMatrix)
-	RecombineSeqSpace(seqSpace, recombinationRate)
+	EvolveSeqSpaceConstPopWith(sampler.Default, seqSpace, mutationRate, recombinationRate, charTransitionMatrix, fitnessMatrix, fitnessFunc)
+}
+
+// EvolveSeqSpaceConstPopWith is like EvolveSeqSpaceConstPop but draws from
+// the given sampler.
+func EvolveSeqSpaceConstPopWith(s *sampler.Sampler, seqSpace *[][]int, mutationRate float64, recombinationRate float64, charTransitionMatrix [][]float64, fitnessMatrix [][]float64, fitnessFunc FitnessFunc) {
+	pop := newPopulation(*seqSpace, len(charTransitionMatrix))
+	pop.Sampler = s
+	pop.EvolveConstPop(mutationRate, recombinationRate, charTransitionMatrix, fitnessMatrix, fitnessFunc)
+	*seqSpace = pop.Sequences
+}
+
+// EvolveSeqSpace advances the sequence space from the given generation to
+// the next one. The size of the next generation is given by the demography.
+func EvolveSeqSpace(seqSpace *[][]int, generation int, demography Demography, mutationRate float64, recombinationRate float64, charTransitionMatrix [][]float64, fitnessMatrix [][]float64, fitnessFunc FitnessFunc) {
+	EvolveSeqSpaceWith(sampler.Default, seqSpace, generation, demography, mutationRate, recombinationRate, charTransitionMatrix, fitnessMatrix, fitnessFunc)
+}
+
+// EvolveSeqSpaceWith is like EvolveSeqSpace but draws from the given
+// sampler.
+func EvolveSeqSpaceWith(s *sampler.Sampler, seqSpace *[][]int, generation int, demography Demography, mutationRate float64, recombinationRate float64, charTransitionMatrix [][]float64, fitnessMatrix [][]float64, fitnessFunc FitnessFunc) {
+	pop := newPopulation(*seqSpace, len(charTransitionMatrix))
+	pop.Sampler = s
+	pop.Evolve(generation, demography, mutationRate, recombinationRate, charTransitionMatrix, fitnessMatrix, fitnessFunc)
+	*seqSpace = pop.Sequences
+}
+
+// EvolveConstPop advances the population by one generation of selection,
+// mutation and recombination while keeping the population size constant.
+// The given observers are notified at every stage of the generation.
+func (pop *Population) EvolveConstPop(mutationRate float64, recombinationRate float64, charTransitionMatrix [][]float64, fitnessMatrix [][]float64, fitnessFunc FitnessFunc, observers ...Observer) {
+	pop.Evolve(0, NewConstantDemography(pop.Size()), mutationRate, recombinationRate, charTransitionMatrix, fitnessMatrix, fitnessFunc, observers...)
+}
+
+// Evolve advances the population from the given generation to the next one
+// by selection, mutation and recombination. The number of offspring
+// selected is the size of the next generation given by the demography.
+// The given observers are notified at every stage of the generation.
+func (pop *Population) Evolve(generation int, demography Demography, mutationRate float64, recombinationRate float64, charTransitionMatrix [][]float64, fitnessMatrix [][]float64, fitnessFunc FitnessFunc, observers ...Observer) {
+	nextGeneration := generation + 1
+	notify(observers, BeforeSelection, pop, nextGeneration)
+	pop.ReplicateSelect(demography.PopSize(nextGeneration), fitnessMatrix, fitnessFunc)
+	notify(observers, AfterSelection, pop, nextGeneration)
+
+	notify(observers, BeforeMutation, pop, nextGeneration)
+	pop.Mutate(mutationRate, charTransitionMatrix)
+	notify(observers, AfterMutation, pop, nextGeneration)
+
+	notify(observers, BeforeRecombination, pop, nextGeneration)
+	pop.Recombine(recombinationRate)
+	notify(observers, AfterRecombination, pop, nextGeneration)
+
+	notify(observers, EndOfGeneration, pop, nextGeneration)
 }
@@ -2,6 +2,9 @@ package mesim
 
 import (
 	"fmt"
+	"math"
+	"mesim/sampler"
+	"mesim/utils"
 	"testing"
 )
 
@@ -54,6 +57,37 @@ func TestSeqSpaceToFitSpace(t *testing.T) {
 
 }
 
+func TestSeqSpaceToLogFitSpace(t *testing.T) {
+	// Multiplicative fitness of 0.5^2000 underflows in linear space
+	numSites := 2000
+	seqSpace := [][]int{make([]int, numSites), make([]int, numSites)}
+	seqSpace[1][0] = 1
+	fitnessMatrix := make([][]float64, numSites)
+	for i := range fitnessMatrix {
+		fitnessMatrix[i] = []float64{0.5, 1.5}
+	}
+	if f := SeqSpaceToFitSpace(seqSpace, fitnessMatrix, MultiplicativeFitness, false); f[0] != 0 || f[1] != 0 {
+		t.Fatalf("SeqSpaceToFitSpace: expected linear fitness to underflow, actual %v", f)
+	}
+	actual := SeqSpaceToLogFitSpace(seqSpace, fitnessMatrix, LogMultiplicativeFitness, true)
+	// Relative fitness of 1 : 3
+	expected := []float64{math.Log(0.25), math.Log(0.75)}
+	for i := range expected {
+		if math.Abs(actual[i]-expected[i]) > 1e-9 {
+			t.Errorf("SeqSpaceToLogFitSpace(seqSpace, fitnessMatrix, LogMultiplicativeFitness, true): expected %v, actual %v", expected, actual)
+		}
+	}
+
+	seqSpace = ReplicateSelectLogWith(sampler.NewSampler(1), seqSpace, 1000, fitnessMatrix, LogMultiplicativeFitness)
+	cnt := 0
+	for _, seq := range seqSpace {
+		cnt += seq[0]
+	}
+	if cnt < 700 || cnt > 800 {
+		t.Errorf("ReplicateSelectLog: expected about 750 fitter offspring, actual %d", cnt)
+	}
+}
+
 func TestReplicateSelect(t *testing.T) {
 	seqSpace := [][]int{
 		[]int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
@@ -92,8 +126,9 @@ func TestReplicateSelect(t *testing.T) {
 		return
 	}
 
+	s := sampler.NewSampler(1)
 	for i := 0; i < 100; i++ {
-		newSeqSpace = ReplicateSelect(newSeqSpace, nextPopSize, fitnessMatrix, fitnessFunction)
+		newSeqSpace = ReplicateSelectWith(s, newSeqSpace, nextPopSize, fitnessMatrix, fitnessFunction)
 	}
 
 	diffCnt := 0
@@ -111,6 +146,65 @@ func TestReplicateSelect(t *testing.T) {
 
 }
 
+func TestReplicateSelectPopSize(t *testing.T) {
+	seqSpace := [][]int{
+		[]int{0, 0, 0, 0},
+		[]int{1, 0, 0, 0},
+		[]int{0, 1, 0, 0},
+	}
+	fitnessMatrix := [][]float64{
+		[]float64{1.0, 1.0},
+		[]float64{1.0, 1.0},
+		[]float64{1.0, 1.0},
+		[]float64{1.0, 1.0},
+	}
+	fitnessFunction := func(seq []int, fitnessMatrix [][]float64) (multSum float64) {
+		multSum = float64(1)
+		for i, char := range seq {
+			multSum *= float64(fitnessMatrix[i][char])
+		}
+		return
+	}
+
+	for _, nextPopSize := range []int{1, 3, 10} {
+		newSeqSpace := ReplicateSelect(seqSpace, nextPopSize, fitnessMatrix, fitnessFunction)
+		if len(newSeqSpace) != nextPopSize {
+			t.Errorf("ReplicateSelect(seqSpace, %d, fitnessMatrix, fitnessFunction): expected %d sequences, actual %d", nextPopSize, nextPopSize, len(newSeqSpace))
+		}
+		for _, seq := range newSeqSpace {
+			if len(seq) != 4 {
+				t.Errorf("ReplicateSelect(seqSpace, %d, fitnessMatrix, fitnessFunction): expected sequences of length 4, actual %v", nextPopSize, seq)
+			}
+		}
+	}
+}
+
+func TestReplicateSelectZeroFitness(t *testing.T) {
+	seqSpace := [][]int{{0}, {0}}
+	fitnessMatrix := [][]float64{{0, 1}}
+	if newSeqSpace := ReplicateSelect(seqSpace, 2, fitnessMatrix, MultiplicativeFitness); len(newSeqSpace) != 0 {
+		t.Errorf("ReplicateSelect: expected extinction when every fitness is zero, actual %v", newSeqSpace)
+	}
+	if newSeqSpace := ReplicateSelectLog(seqSpace, 2, fitnessMatrix, LogMultiplicativeFitness); len(newSeqSpace) != 0 {
+		t.Errorf("ReplicateSelectLog: expected extinction when every fitness is zero, actual %v", newSeqSpace)
+	}
+	pop := NewPopulation(seqSpace, 2)
+	pop.ReplicateSelectWith(2, MatrixFitness{Matrix: fitnessMatrix, Func: MultiplicativeFitness}, NewTournamentSelector(2))
+	if pop.Size() != 0 {
+		t.Errorf("ReplicateSelectWith: expected extinction when every fitness is zero, actual size %d", pop.Size())
+	}
+}
+
+func TestReplicateSelectBadCounts(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("replicate: expected a panic for offspring counts that do not sum to the population size")
+		}
+	}()
+	pop := NewPopulation([][]int{{0}, {1}}, 2)
+	pop.replicate(3, func() []int { return []int{1, 1} })
+}
+
 func TestRecombineSeqSpace(t *testing.T) {
 	ancSeqSpace := [][]int{
 		[]int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
@@ -128,7 +222,7 @@ func TestRecombineSeqSpace(t *testing.T) {
 		}
 	}
 	// fmt.Println("anc", ancSeqSpace)
-	RecombineSeqSpace(&evolvedSeqSpace, r)
+	RecombineSeqSpaceWith(sampler.NewSampler(1), &evolvedSeqSpace, r)
 	// fmt.Println("evolved", evolvedSeqSpace)
 
 	// TODO
@@ -181,7 +275,37 @@ func TestEvolveSeqSpaceConstPop(t *testing.T) {
 	}
 
 	fmt.Println(evolvedSeqSpace)
-	EvolveSeqSpaceConstPop(&evolvedSeqSpace, mutationRate, recombinationRate, rateMatrix, fitnessMatrix, fitnessFunc)
+	EvolveSeqSpaceConstPopWith(sampler.NewSampler(1), &evolvedSeqSpace, mutationRate, recombinationRate, rateMatrix, fitnessMatrix, fitnessFunc)
 	fmt.Println(evolvedSeqSpace)
 
 }
+
+func TestEvolveSeqSpaceReproducible(t *testing.T) {
+	rateMatrix := [][]float64{
+		[]float64{0.0, 0.5, 0.5},
+		[]float64{0.5, 0.0, 0.5},
+		[]float64{0.5, 0.5, 0.0},
+	}
+	fitnessMatrix := [][]float64{
+		[]float64{1.0, 1.5, 1.0},
+		[]float64{1.0, 1.0, 2.0},
+		[]float64{1.0, 1.0, 1.0},
+	}
+	evolve := func() [][]int {
+		seqSpace := make([][]int, 50)
+		for i := range seqSpace {
+			seqSpace[i] = []int{0, 0, 0}
+		}
+		s := sampler.NewSampler(7)
+		for generation := 0; generation < 20; generation++ {
+			EvolveSeqSpaceWith(s, &seqSpace, generation, NewConstantDemography(50), 0.1, 0.1, rateMatrix, fitnessMatrix, MultiplicativeFitness)
+		}
+		return seqSpace
+	}
+	expected, actual := evolve(), evolve()
+	for i := range expected {
+		if same, _ := utils.CompareIntSlices(expected[i], actual[i]); !same {
+			t.Fatalf("EvolveSeqSpaceWith: expected the same sequences with the same seed, actual %v and %v", expected, actual)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package mesim
+
+import (
+	"encoding/binary"
+	"math"
+	"mesim/sampler"
+)
+
+// FitnessModel computes the fitness of a sequence. Unlike a fitness matrix,
+// which only expresses independent effects of each site, a fitness model
+// may depend on any combination of sites.
+//
+// Fitness must return a non-negative value. When the alignment of a
+// population is tracked, models receive ungapped sequences.
+type FitnessModel interface {
+	Fitness(seq []int) float64
+}
+
+// LogFitnessModel is a FitnessModel that can compute the log fitness of a
+// sequence directly. Selection uses the log fitness of such models, so
+// that landscapes whose fitness values span more than the range of a
+// float64, such as Potts models of protein families, stay usable.
+type LogFitnessModel interface {
+	FitnessModel
+	LogFitness(seq []int) float64
+}
+
+// MatrixFitness adapts a fitness matrix and a fitness function to the
+// FitnessModel interface.
+type MatrixFitness struct {
+	Matrix [][]float64
+	Func   FitnessFunc
+}
+
+// Fitness implements FitnessModel.
+func (m MatrixFitness) Fitness(seq []int) float64 {
+	return m.Func(seq, m.Matrix)
+}
+
+// LogMatrixFitness adapts a fitness matrix and a fitness function that
+// returns log fitness to the LogFitnessModel interface.
+type LogMatrixFitness struct {
+	Matrix [][]float64
+	Func   FitnessFunc
+}
+
+// Fitness implements FitnessModel. It returns exp(LogFitness(seq)).
+func (m LogMatrixFitness) Fitness(seq []int) float64 {
+	return math.Exp(m.Func(seq, m.Matrix))
+}
+
+// LogFitness implements LogFitnessModel.
+func (m LogMatrixFitness) LogFitness(seq []int) float64 {
+	return m.Func(seq, m.Matrix)
+}
+
+// MultiplicativeFitness is a FitnessFunc that returns the product of the
+// fitness values of the characters of the sequence at every site.
+func MultiplicativeFitness(seq []int, fitnessMatrix [][]float64) float64 {
+	fitness := 1.0
+	for i, char := range seq {
+		fitness *= fitnessMatrix[i][char]
+	}
+	return fitness
+}
+
+// LogMultiplicativeFitness is a FitnessFunc that returns the log of
+// MultiplicativeFitness as a sum of logs, which does not underflow for long
+// sequences. Use it with SeqSpaceToLogFitSpace and ReplicateSelectLog.
+func LogMultiplicativeFitness(seq []int, fitnessMatrix [][]float64) float64 {
+	logFitness := 0.0
+	for i, char := range seq {
+		logFitness += math.Log(fitnessMatrix[i][char])
+	}
+	return logFitness
+}
+
+// PottsFitness is a pairwise epistatic landscape in which the log fitness
+// of a sequence s is its energy
+//
+//	E(s) = sum_i H[i][s_i] + sum_{i<j} J[i][j][s_i][s_j]
+//
+// H[i] holds the field of every character at site i. J[i][j] holds the
+// coupling between sites i < j, or is nil if the sites do not interact.
+// J[i] is nil if site i does not interact with any later site.
+type PottsFitness struct {
+	H [][]float64
+	J [][][][]float64
+}
+
+// NewPottsFitness creates a Potts landscape with the given fields and
+// couplings. j may be nil for a landscape without couplings.
+func NewPottsFitness(h [][]float64, j [][][][]float64) *PottsFitness {
+	if len(h) == 0 {
+		panic("Length of h must be greater than zero")
+	}
+	numChars := len(h[0])
+	for _, field := range h {
+		if len(field) != numChars {
+			panic("Rows in h must have equal lengths")
+		}
+	}
+	m := &PottsFitness{H: h, J: j}
+	if m.J == nil {
+		m.J = make([][][][]float64, len(h))
+	}
+	if len(m.J) != len(h) {
+		panic("Length of j must be equal to the number of sites")
+	}
+	for i := range m.J {
+		if m.J[i] != nil && len(m.J[i]) != len(h) {
+			panic("Length of rows in j must be equal to the number of sites")
+		}
+		for k := range m.J[i] {
+			if m.J[i][k] != nil {
+				validateCoupling(m.J[i][k], numChars)
+			}
+		}
+	}
+	return m
+}
+
+// SetCoupling sets the coupling between sites i and j. coupling[a][b] is
+// the contribution to the energy of character a at site i together with
+// character b at site j.
+func (m *PottsFitness) SetCoupling(i, j int, coupling [][]float64) {
+	if i == j {
+		panic("Sites of a coupling must be different")
+	}
+	validateCoupling(coupling, len(m.H[0]))
+	if i > j {
+		transposed := make([][]float64, len(coupling))
+		for a := range transposed {
+			transposed[a] = make([]float64, len(coupling))
+			for b := range transposed[a] {
+				transposed[a][b] = coupling[b][a]
+			}
+		}
+		i, j, coupling = j, i, transposed
+	}
+	m.setCoupling(i, j, coupling)
+}
+
+// coupling returns the coupling between sites i < j, or nil if they do not
+// interact.
+func (m *PottsFitness) coupling(i, j int) [][]float64 {
+	if m.J[i] == nil {
+		return nil
+	}
+	return m.J[i][j]
+}
+
+// setCoupling sets the coupling between sites i < j without checking it.
+func (m *PottsFitness) setCoupling(i, j int, coupling [][]float64) {
+	if m.J[i] == nil {
+		m.J[i] = make([][][]float64, len(m.H))
+	}
+	m.J[i][j] = coupling
+}
+
+func validateCoupling(coupling [][]float64, numChars int) {
+	if len(coupling) != numChars {
+		panic("Coupling must be a square matrix over the characters")
+	}
+	for _, row := range coupling {
+		if len(row) != numChars {
+			panic("Coupling must be a square matrix over the characters")
+		}
+	}
+}
+
+// Energy returns the energy of the sequence, which is its log fitness.
+func (m *PottsFitness) Energy(seq []int) float64 {
+	if len(seq) != len(m.H) {
+		panic("Length of seq must be equal to the number of sites of the model")
+	}
+	energy := 0.0
+	for i, a := range seq {
+		energy += m.H[i][a]
+		if m.J[i] == nil {
+			continue
+		}
+		for j := i + 1; j < len(seq); j++ {
+			if coupling := m.J[i][j]; coupling != nil {
+				energy += coupling[a][seq[j]]
+			}
+		}
+	}
+	return energy
+}
+
+// Fitness implements FitnessModel. It returns exp(Energy(seq)).
+func (m *PottsFitness) Fitness(seq []int) float64 {
+	return math.Exp(m.Energy(seq))
+}
+
+// LogFitness implements LogFitnessModel. It returns Energy(seq).
+func (m *PottsFitness) LogFitness(seq []int) float64 {
+	return m.Energy(seq)
+}
+
+// NKFitness is Kauffman's NK landscape. The fitness of a sequence is the
+// mean of the contributions of its N sites, and the contribution of site i
+// depends on the characters at the sites in Neighbors[i], which starts with
+// i itself followed by its K epistatic partners.
+//
+// Contributions[i] is indexed by the characters at Neighbors[i] read as a
+// number in base NumChars, most significant first.
+type NKFitness struct {
+	N             int
+	K             int
+	NumChars      int
+	Neighbors     [][]int
+	Contributions [][]float64
+}
+
+// NewNKFitness creates an NK landscape over n sites with numChars
+// characters in which every site interacts with k other sites.
+// Contributions are drawn uniformly from [0, 1). If randomNeighbors is
+// false, the partners of a site are the k sites that follow it, wrapping
+// around at the end; otherwise they are drawn at random.
+func NewNKFitness(s *sampler.Sampler, n, k, numChars int, randomNeighbors bool) *NKFitness {
+	if n < 1 {
+		panic("Number of sites must be greater than zero")
+	}
+	if k < 0 || k >= n {
+		panic("K must be in the range [0, n)")
+	}
+	if numChars < 1 {
+		panic("Number of characters must be greater than zero")
+	}
+	neighbors := make([][]int, n)
+	contributions := make([][]float64, n)
+	numContexts := 1
+	for j := 0; j <= k; j++ {
+		numContexts *= numChars
+	}
+	for i := range neighbors {
+		neighbors[i] = []int{i}
+		if randomNeighbors {
+			for _, j := range s.Perm(n - 1)[:k] {
+				if j >= i {
+					j++
+				}
+				neighbors[i] = append(neighbors[i], j)
+			}
+		} else {
+			for j := 1; j <= k; j++ {
+				neighbors[i] = append(neighbors[i], (i+j)%n)
+			}
+		}
+		contributions[i] = make([]float64, numContexts)
+		for c := range contributions[i] {
+			contributions[i][c] = s.Float64()
+		}
+	}
+	return &NKFitness{N: n, K: k, NumChars: numChars, Neighbors: neighbors, Contributions: contributions}
+}
+
+// Fitness implements FitnessModel.
+func (m *NKFitness) Fitness(seq []int) float64 {
+	if len(seq) != m.N {
+		panic("Length of seq must be equal to the number of sites of the model")
+	}
+	sum := 0.0
+	for i, neighbors := range m.Neighbors {
+		idx := 0
+		for _, j := range neighbors {
+			idx = idx*m.NumChars + seq[j]
+		}
+		sum += m.Contributions[i][idx]
+	}
+	return sum / float64(m.N)
+}
+
+// RoughMountFujiFitness is a Rough Mount Fuji landscape, in which the log
+// fitness of a sequence decreases by Slope for every site at which it
+// differs from Reference, plus a random term drawn from a normal
+// distribution with standard deviation Sigma.
+//
+// The random term of a sequence is derived from Seed and the sequence
+// itself, so the landscape is fixed without being stored, and it does not
+// depend on the order in which sequences are evaluated. The landscape may
+// therefore be shared by populations that evolve in parallel, such as the
+// demes of a Metapopulation.
+type RoughMountFujiFitness struct {
+	Reference []int
+	Slope     float64
+	Sigma     float64
+	Seed      uint64
+}
+
+// NewRoughMountFujiFitness creates a Rough Mount Fuji landscape centered on
+// the reference sequence. Its seed is drawn from s; if s is nil,
+// sampler.Default is used.
+func NewRoughMountFujiFitness(s *sampler.Sampler, reference []int, slope, sigma float64) *RoughMountFujiFitness {
+	if slope < 0 {
+		panic("Slope must not be negative")
+	}
+	if sigma < 0 {
+		panic("Sigma must not be negative")
+	}
+	if s == nil {
+		s = sampler.Default
+	}
+	ref := make([]int, len(reference))
+	copy(ref, reference)
+	return &RoughMountFujiFitness{Reference: ref, Slope: slope, Sigma: sigma, Seed: s.Uint64()}
+}
+
+// NewHouseOfCardsFitness creates a House-of-Cards landscape, in which the
+// log fitness of every sequence is independently drawn from a normal
+// distribution with standard deviation sigma. It is the Rough Mount Fuji
+// landscape without a reference.
+func NewHouseOfCardsFitness(s *sampler.Sampler, sigma float64) *RoughMountFujiFitness {
+	return NewRoughMountFujiFitness(s, nil, 0, sigma)
+}
+
+// Fitness implements FitnessModel. It returns exp(LogFitness(seq)).
+func (m *RoughMountFujiFitness) Fitness(seq []int) float64 {
+	return math.Exp(m.LogFitness(seq))
+}
+
+// LogFitness implements LogFitnessModel.
+func (m *RoughMountFujiFitness) LogFitness(seq []int) float64 {
+	logFitness := 0.0
+	if m.Slope != 0 {
+		if len(seq) != len(m.Reference) {
+			panic("Length of seq must be equal to the length of the reference")
+		}
+		for i, char := range seq {
+			if char != m.Reference[i] {
+				logFitness -= m.Slope
+			}
+		}
+	}
+	if m.Sigma > 0 {
+		logFitness += sampler.HashNormFloat64(m.Seed, []byte(seqKey(seq))) * m.Sigma
+	}
+	return logFitness
+}
+
+// seqKey returns a compact string that identifies the sequence.
+func seqKey(seq []int) string {
+	buf := make([]byte, len(seq)*binary.MaxVarintLen64)
+	n := 0
+	for _, char := range seq {
+		n += binary.PutUvarint(buf[n:], uint64(char))
+	}
+	return string(buf[:n])
+}
@@ -0,0 +1,114 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"testing"
+)
+
+func TestPottsFitness(t *testing.T) {
+	h := [][]float64{
+		{0, 0.5},
+		{0, 0.5},
+		{0, 0},
+	}
+	m := NewPottsFitness(h, nil)
+	// Sites 0 and 2 only work well together
+	m.SetCoupling(2, 0, [][]float64{
+		{0, -1},
+		{-1, 1},
+	})
+	cases := []struct {
+		seq    []int
+		energy float64
+	}{
+		{[]int{0, 0, 0}, 0},
+		{[]int{1, 0, 0}, -0.5},
+		{[]int{1, 1, 1}, 2},
+		{[]int{0, 1, 1}, -0.5},
+	}
+	for _, c := range cases {
+		if actual := m.Energy(c.seq); math.Abs(actual-c.energy) > 1e-12 {
+			t.Errorf("Energy(%v): expected %v, actual %v", c.seq, c.energy, actual)
+		}
+		if actual := m.Fitness(c.seq); math.Abs(actual-math.Exp(c.energy)) > 1e-12 {
+			t.Errorf("Fitness(%v): expected %v, actual %v", c.seq, math.Exp(c.energy), actual)
+		}
+	}
+}
+
+func TestNKFitness(t *testing.T) {
+	s := sampler.NewSampler(1)
+	m := NewNKFitness(s, 6, 2, 2, false)
+	for i, neighbors := range m.Neighbors {
+		if len(neighbors) != 3 || neighbors[0] != i {
+			t.Fatalf("NewNKFitness: unexpected neighbors %v of site %d", neighbors, i)
+		}
+	}
+	if m.Neighbors[5][1] != 0 || m.Neighbors[5][2] != 1 {
+		t.Errorf("NewNKFitness: expected neighbors to wrap around, actual %v", m.Neighbors[5])
+	}
+	// With K = 0 the landscape is additive
+	m = NewNKFitness(s, 3, 0, 2, true)
+	seq := []int{1, 0, 1}
+	expected := (m.Contributions[0][1] + m.Contributions[1][0] + m.Contributions[2][1]) / 3
+	if actual := m.Fitness(seq); math.Abs(actual-expected) > 1e-12 {
+		t.Errorf("Fitness(%v): expected %v, actual %v", seq, expected, actual)
+	}
+	m = NewNKFitness(s, 5, 4, 2, true)
+	for i, neighbors := range m.Neighbors {
+		seen := make(map[int]bool)
+		for _, j := range neighbors {
+			if seen[j] {
+				t.Errorf("NewNKFitness: repeated neighbor %d of site %d", j, i)
+			}
+			seen[j] = true
+		}
+	}
+}
+
+func TestRoughMountFujiFitness(t *testing.T) {
+	m := NewRoughMountFujiFitness(sampler.NewSampler(1), []int{0, 0, 0}, 1, 0)
+	if actual := m.Fitness([]int{0, 1, 1}); math.Abs(actual-math.Exp(-2)) > 1e-12 {
+		t.Errorf("Fitness: expected %v, actual %v", math.Exp(-2), actual)
+	}
+	m = NewHouseOfCardsFitness(sampler.NewSampler(1), 1)
+	f1 := m.Fitness([]int{0, 1, 1})
+	f2 := m.Fitness([]int{1, 1, 1})
+	if f1 == f2 {
+		t.Errorf("Fitness: expected independent values for different sequences")
+	}
+	if actual := m.Fitness([]int{0, 1, 1}); actual != f1 {
+		t.Errorf("Fitness: expected the same value on revisiting a sequence, actual %v and %v", f1, actual)
+	}
+	if actual := m.LogFitness([]int{1, 1, 1}); math.Abs(actual-math.Log(f2)) > 1e-12 {
+		t.Errorf("LogFitness: expected %v, actual %v", math.Log(f2), actual)
+	}
+	// The landscape does not depend on the order in which it is visited
+	other := NewHouseOfCardsFitness(sampler.NewSampler(1), 1)
+	if actual := other.Fitness([]int{1, 1, 1}); actual != f2 {
+		t.Errorf("Fitness: expected %v regardless of evaluation order, actual %v", f2, actual)
+	}
+	if actual := other.Fitness([]int{0, 1, 1}); actual != f1 {
+		t.Errorf("Fitness: expected %v regardless of evaluation order, actual %v", f1, actual)
+	}
+}
+
+func TestReplicateSelectModel(t *testing.T) {
+	// Only sequences carrying 1 at sites 0 and 1 together are fit
+	m := NewPottsFitness([][]float64{{0, -10}, {0, -10}}, nil)
+	m.SetCoupling(0, 1, [][]float64{{0, 0}, {0, 30}})
+	seqSpace := [][]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}}
+	fitnessSpace := SeqSpaceToFitSpaceModel(seqSpace, m, true)
+	if fitnessSpace[3] < 0.99 {
+		t.Errorf("SeqSpaceToFitSpaceModel: expected most weight on {1, 1}, actual %v", fitnessSpace)
+	}
+	pop := NewPopulation(seqSpace, 2)
+	pop.Sampler = sampler.NewSampler(1)
+	pop.ReplicateSelectModel(20, m)
+	for _, seq := range pop.Sequences {
+		if seq[0] != 1 || seq[1] != 1 {
+			t.Fatalf("ReplicateSelectModel: expected only {1, 1}, actual %v", seq)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package mesim
+
+import (
+	"math"
+	"sync"
+)
+
+// PopulationFitnessModel is a FitnessModel whose values depend on the
+// current state of the population, for example on the frequencies of
+// alleles or haplotypes.
+//
+// A simulation calls Update once per generation, before selection, and
+// then evaluates individuals with Fitness as usual. Callers that select
+// with ReplicateSelectModel directly must call Update and
+// Population.InvalidateFitness themselves.
+type PopulationFitnessModel interface {
+	FitnessModel
+	Update(pop *Population, generation int)
+}
+
+// AlleleFrequencies returns the frequency of every character at every
+// site. If the alignment is tracked, sites are alignment columns and gaps
+// are not counted as characters.
+func (pop *Population) AlleleFrequencies() [][]float64 {
+	numChars := pop.NumChars
+	for _, seq := range pop.Sequences {
+		for _, char := range seq {
+			if char >= numChars {
+				numChars = char + 1
+			}
+		}
+	}
+	freqs := make([][]float64, pop.NumColumns())
+	for i := range freqs {
+		freqs[i] = make([]float64, numChars)
+	}
+	for i, seq := range pop.Sequences {
+		for j, char := range seq {
+			site := j
+			if pop.Columns != nil {
+				site = pop.Columns[i][j]
+			}
+			freqs[site][char]++
+		}
+	}
+	if pop.Size() > 0 {
+		for i := range freqs {
+			for j := range freqs[i] {
+				freqs[i][j] /= float64(pop.Size())
+			}
+		}
+	}
+	return freqs
+}
+
+// Haplotypes returns the distinct sequences of the population, in order
+// of first appearance, together with their frequencies.
+func (pop *Population) Haplotypes() (haplotypes [][]int, frequencies []float64) {
+	index := make(map[string]int)
+	for _, seq := range pop.Sequences {
+		key := seqKey(seq)
+		k, ok := index[key]
+		if !ok {
+			k = len(haplotypes)
+			index[key] = k
+			haplotype := make([]int, len(seq))
+			copy(haplotype, seq)
+			haplotypes = append(haplotypes, haplotype)
+			frequencies = append(frequencies, 0)
+		}
+		frequencies[k]++
+	}
+	for k := range frequencies {
+		frequencies[k] /= float64(pop.Size())
+	}
+	return
+}
+
+// variantAt returns the characters of the sequence at the given sites, or
+// the whole sequence if sites is nil.
+//
+// Sites index ungapped sequences, which is what fitness models receive.
+// With indels, a site no longer refers to the same alignment column in
+// every sequence, so variants at sites cannot be compared; see
+// checkVariantSites.
+func variantAt(seq []int, sites []int) []int {
+	if sites == nil {
+		return seq
+	}
+	variant := make([]int, len(sites))
+	for k, site := range sites {
+		variant[k] = seq[site]
+	}
+	return variant
+}
+
+// checkVariantSites panics if the population tracks its alignment and
+// variants are read at sites rather than from the whole sequence.
+func checkVariantSites(pop *Population, sites []int) {
+	if pop.Columns != nil && sites != nil {
+		panic("Variants at sites are not supported with tracked alignments")
+	}
+}
+
+// variantFrequencies returns the frequency of every variant at the given
+// sites in the population, keyed by seqKey.
+func variantFrequencies(pop *Population, sites []int) map[string]float64 {
+	checkVariantSites(pop, sites)
+	freqs := make(map[string]float64)
+	for _, seq := range pop.Sequences {
+		freqs[seqKey(variantAt(seq, sites))] += 1 / float64(pop.Size())
+	}
+	return freqs
+}
+
+// NegativeFrequencyDependentFitness makes common variants less fit. The
+// fitness of a sequence is the fitness under Base, or 1 if Base is nil,
+// times exp(-Strength * p), where p is the frequency in the population of
+// the variant the sequence carries at Sites. If Sites is nil, the variant
+// is the whole sequence. Sites cannot be given for populations with a
+// tracked alignment.
+type NegativeFrequencyDependentFitness struct {
+	Base     FitnessModel
+	Sites    []int
+	Strength float64
+
+	freqs map[string]float64
+}
+
+// NewNegativeFrequencyDependentFitness creates a negative
+// frequency-dependent fitness model on top of base.
+func NewNegativeFrequencyDependentFitness(base FitnessModel, sites []int, strength float64) *NegativeFrequencyDependentFitness {
+	if strength < 0 {
+		panic("Strength must not be negative")
+	}
+	return &NegativeFrequencyDependentFitness{Base: base, Sites: sites, Strength: strength}
+}
+
+// Update implements PopulationFitnessModel.
+func (m *NegativeFrequencyDependentFitness) Update(pop *Population, generation int) {
+	m.freqs = variantFrequencies(pop, m.Sites)
+}
+
+// Fitness implements FitnessModel.
+func (m *NegativeFrequencyDependentFitness) Fitness(seq []int) float64 {
+	fitness := 1.0
+	if m.Base != nil {
+		fitness = m.Base.Fitness(seq)
+	}
+	return fitness * math.Exp(-m.Strength*m.freqs[seqKey(variantAt(seq, m.Sites))])
+}
+
+// ImmuneMemoryFitness models host immunity against epitopes, the cause of
+// antigenic drift. The immune memory of every epitope variant grows with
+// its frequency and fades over time: each generation,
+//
+//	memory(v) = (1 - Decay) * memory(v) + frequency(v)
+//
+// A variant v is met with an immunity of sum_u memory(u) *
+// CrossImmunity^d(u, v), where d is the number of epitope sites at which u
+// and v differ, so that a CrossImmunity of zero only protects against the
+// remembered variant itself. The fitness of a sequence is the fitness
+// under Base, or 1 if Base is nil, times exp(-Strength * immunity) for
+// every epitope.
+//
+// Epitopes[e] holds the sites of epitope e. Since sites shift with
+// indels, the model does not support populations with a tracked
+// alignment.
+type ImmuneMemoryFitness struct {
+	Base          FitnessModel
+	Epitopes      [][]int
+	Strength      float64
+	Decay         float64
+	CrossImmunity float64
+
+	mu       sync.Mutex
+	memory   []map[string]float64
+	variants []map[string][]int
+	immunity []map[string]float64
+}
+
+// NewImmuneMemoryFitness creates an immune memory fitness model over the
+// given epitopes on top of base.
+func NewImmuneMemoryFitness(base FitnessModel, epitopes [][]int, strength, decay, crossImmunity float64) *ImmuneMemoryFitness {
+	if strength < 0 {
+		panic("Strength must not be negative")
+	}
+	if decay < 0 || decay > 1 {
+		panic("Decay must be in the range [0, 1]")
+	}
+	if crossImmunity < 0 || crossImmunity > 1 {
+		panic("Cross immunity must be in the range [0, 1]")
+	}
+	m := &ImmuneMemoryFitness{
+		Base:          base,
+		Epitopes:      epitopes,
+		Strength:      strength,
+		Decay:         decay,
+		CrossImmunity: crossImmunity,
+		memory:        make([]map[string]float64, len(epitopes)),
+		variants:      make([]map[string][]int, len(epitopes)),
+		immunity:      make([]map[string]float64, len(epitopes)),
+	}
+	for e := range epitopes {
+		m.memory[e] = make(map[string]float64)
+		m.variants[e] = make(map[string][]int)
+		m.immunity[e] = make(map[string]float64)
+	}
+	return m
+}
+
+// Update implements PopulationFitnessModel. It adds the current epitope
+// variants of the population to the immune memory.
+func (m *ImmuneMemoryFitness) Update(pop *Population, generation int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for e, sites := range m.Epitopes {
+		checkVariantSites(pop, sites)
+		for key := range m.memory[e] {
+			m.memory[e][key] *= 1 - m.Decay
+			// Forget variants whose memory has faded away
+			if m.memory[e][key] < 1e-9 {
+				delete(m.memory[e], key)
+				delete(m.variants[e], key)
+			}
+		}
+		for _, seq := range pop.Sequences {
+			variant := variantAt(seq, sites)
+			key := seqKey(variant)
+			if _, ok := m.variants[e][key]; !ok {
+				m.variants[e][key] = variant
+			}
+			m.memory[e][key] += 1 / float64(pop.Size())
+		}
+		m.immunity[e] = make(map[string]float64)
+	}
+}
+
+// Immunity returns the immunity against the variant of the sequence at
+// epitope e.
+func (m *ImmuneMemoryFitness) Immunity(seq []int, e int) float64 {
+	variant := variantAt(seq, m.Epitopes[e])
+	key := seqKey(variant)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if immunity, ok := m.immunity[e][key]; ok {
+		return immunity
+	}
+	immunity := 0.0
+	for otherKey, memory := range m.memory[e] {
+		if otherKey == key {
+			immunity += memory
+			continue
+		}
+		if m.CrossImmunity == 0 {
+			continue
+		}
+		d := 0
+		for k, char := range m.variants[e][otherKey] {
+			if char != variant[k] {
+				d++
+			}
+		}
+		immunity += memory * math.Pow(m.CrossImmunity, float64(d))
+	}
+	m.immunity[e][key] = immunity
+	return immunity
+}
+
+// Fitness implements FitnessModel.
+func (m *ImmuneMemoryFitness) Fitness(seq []int) float64 {
+	fitness := 1.0
+	if m.Base != nil {
+		fitness = m.Base.Fitness(seq)
+	}
+	immunity := 0.0
+	for e := range m.Epitopes {
+		immunity += m.Immunity(seq, e)
+	}
+	return fitness * math.Exp(-m.Strength*immunity)
+}
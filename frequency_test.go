@@ -0,0 +1,108 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"testing"
+)
+
+func TestHaplotypes(t *testing.T) {
+	pop := NewPopulation([][]int{{0, 1}, {1, 1}, {0, 1}, {0, 0}}, 2)
+	haplotypes, freqs := pop.Haplotypes()
+	expected := [][]int{{0, 1}, {1, 1}, {0, 0}}
+	expectedFreqs := []float64{0.5, 0.25, 0.25}
+	if len(haplotypes) != len(expected) {
+		t.Fatalf("Haplotypes: expected %v, actual %v", expected, haplotypes)
+	}
+	for k := range expected {
+		if haplotypes[k][0] != expected[k][0] || haplotypes[k][1] != expected[k][1] || freqs[k] != expectedFreqs[k] {
+			t.Errorf("Haplotypes: expected %v with %v, actual %v with %v", expected[k], expectedFreqs[k], haplotypes[k], freqs[k])
+		}
+	}
+	alleleFreqs := pop.AlleleFrequencies()
+	if alleleFreqs[0][0] != 0.75 || alleleFreqs[1][1] != 0.75 {
+		t.Errorf("AlleleFrequencies: expected 0.75 and 0.75, actual %v", alleleFreqs)
+	}
+}
+
+func TestNegativeFrequencyDependentFitness(t *testing.T) {
+	seqSpace := make([][]int, 200)
+	for i := range seqSpace {
+		seqSpace[i] = []int{0, 0}
+		if i < 20 {
+			seqSpace[i][0] = 1
+		}
+	}
+	pop := NewPopulation(seqSpace, 2)
+	pop.Sampler = sampler.NewSampler(1)
+	model := NewNegativeFrequencyDependentFitness(nil, []int{0}, 1)
+	model.Update(pop, 0)
+	if rare, common := model.Fitness([]int{1, 0}), model.Fitness([]int{0, 0}); rare <= common {
+		t.Errorf("Fitness: expected the rare variant to be fitter, actual %v and %v", rare, common)
+	}
+	sim := NewSimulation(pop, 100, 0, 0, [][]float64{{0, 1}, {1, 0}}, nil, nil)
+	sim.FitnessModel = model
+	sim.Run()
+	// Balancing selection keeps both variants near one half
+	if f := pop.AlleleFrequency(0, 1); f < 0.3 || f > 0.7 {
+		t.Errorf("Simulation with negative frequency-dependent selection: expected frequency near 0.5, actual %v", f)
+	}
+}
+
+func TestFrequencyDependentIndels(t *testing.T) {
+	pop := NewPopulation([][]int{{0, 1, 1}, {0, 1, 1}, {1, 1, 1}, {1, 1, 1}}, 2)
+	pop.TrackAlignment()
+	pop.delete(0, 0, 1)
+	// Whole sequences are compared ungapped
+	model := NewNegativeFrequencyDependentFitness(nil, nil, 1)
+	model.Update(pop, 0)
+	if actual, expected := model.Fitness([]int{1, 1}), math.Exp(-0.25); math.Abs(actual-expected) > 1e-12 {
+		t.Errorf("Fitness: expected %v for a sequence with a deletion, actual %v", expected, actual)
+	}
+	for _, update := range []func(){
+		func() { NewNegativeFrequencyDependentFitness(nil, []int{0}, 1).Update(pop, 0) },
+		func() { NewImmuneMemoryFitness(nil, [][]int{{0}}, 1, 0.5, 0).Update(pop, 0) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Update: expected a panic for variants at sites of a population with indels")
+				}
+			}()
+			update()
+		}()
+	}
+}
+
+func TestImmuneMemoryFitness(t *testing.T) {
+	seqSpace := make([][]int, 10)
+	for i := range seqSpace {
+		seqSpace[i] = []int{0, 0, 0, 0}
+	}
+	pop := NewPopulation(seqSpace, 2)
+	model := NewImmuneMemoryFitness(nil, [][]int{{0, 1}}, 1, 0.5, 0.5)
+	model.Update(pop, 0)
+
+	seen := model.Fitness([]int{0, 0, 1, 1})
+	oneAway := model.Fitness([]int{1, 0, 0, 0})
+	twoAway := model.Fitness([]int{1, 1, 0, 0})
+	if math.Abs(seen-math.Exp(-1)) > 1e-12 {
+		t.Errorf("Fitness: expected exp(-1) for the remembered variant, actual %v", seen)
+	}
+	if math.Abs(oneAway-math.Exp(-0.5)) > 1e-12 || math.Abs(twoAway-math.Exp(-0.25)) > 1e-12 {
+		t.Errorf("Fitness: expected cross immunity to fall off with distance, actual %v and %v", oneAway, twoAway)
+	}
+
+	// Memory of the first variant fades once the population has moved on
+	for i := range pop.Sequences {
+		pop.Sequences[i][0] = 1
+	}
+	model.Update(pop, 1)
+	immunity := model.Immunity([]int{0, 0, 0, 0}, 0)
+	if math.Abs(immunity-(0.5+0.5)) > 1e-12 {
+		t.Errorf("Immunity: expected 0.5 from fading memory and 0.5 from cross immunity, actual %v", immunity)
+	}
+	if model.Fitness([]int{1, 0, 0, 0}) >= model.Fitness([]int{1, 1, 0, 0}) {
+		t.Errorf("Fitness: expected the current variant to be less fit than a new one")
+	}
+}
@@ -0,0 +1,324 @@
+package mesim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// GenealogyNode is an individual in a genealogy.
+//
+// Parents holds the IDs of the parents of the individual: none for a
+// founder, one for a clonal offspring and two for a recombinant. A
+// recombinant inherits the sites before Breakpoints[0] from Parents[0],
+// the sites from Breakpoints[0] up to Breakpoints[1] from Parents[1], and
+// so on, alternating between the two parents. If the alignment is
+// tracked, breakpoints refer to ranks of alignment columns.
+//
+// Generation is zero for founders and one more than that of the first
+// parent otherwise. With overlapping generations it therefore counts
+// births along the lineage rather than time.
+type GenealogyNode struct {
+	ID          int
+	Parents     []int
+	Breakpoints []int
+	Generation  int
+
+	// reproduced is true once the individual has offspring in the
+	// genealogy.
+	reproduced bool
+}
+
+// Genealogy records the ancestry of the individuals of one or more
+// populations, keyed by individual ID. Populations that share a genealogy,
+// such as the demes of a metapopulation, must have unique IDs; the demes
+// of a Metapopulation do.
+//
+// Genealogies grow with every generation. Simplify them periodically to
+// the individuals still alive to keep their size in check.
+type Genealogy struct {
+	Nodes map[int]*GenealogyNode
+
+	mu sync.Mutex
+}
+
+// NewGenealogy creates an empty genealogy.
+func NewGenealogy() *Genealogy {
+	return &Genealogy{Nodes: make(map[int]*GenealogyNode)}
+}
+
+// RecordGenealogy starts recording the ancestry of the population in g.
+// Individuals of the population that g does not know yet are added as
+// founders.
+func (pop *Population) RecordGenealogy(g *Genealogy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, id := range pop.IDs {
+		if _, ok := g.Nodes[id]; !ok {
+			g.Nodes[id] = &GenealogyNode{ID: id}
+		}
+	}
+	pop.Genealogy = g
+}
+
+// Node returns the node of the individual with the given ID, or nil if it
+// is not in the genealogy.
+func (g *Genealogy) Node(id int) *GenealogyNode {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.Nodes[id]
+}
+
+// addOffspring records a clonal offspring of parent.
+func (g *Genealogy) addOffspring(id, parent int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	generation := 1
+	if node, ok := g.Nodes[parent]; ok {
+		generation = node.Generation + 1
+		node.reproduced = true
+	}
+	g.Nodes[id] = &GenealogyNode{ID: id, Parents: []int{parent}, Generation: generation}
+}
+
+// recombine records the recombination of the individuals id1 and id2 at
+// the given breakpoints. If both individuals were born clonally, have
+// different parents and have no offspring yet, the second parent and the
+// breakpoints are added to their nodes, so that they become the
+// recombinant offspring of both parents, and recombine returns the same
+// IDs. Otherwise, the recombinants are recorded as new individuals,
+// descending from id1 and id2, whose IDs are drawn from newID and
+// returned.
+func (g *Genealogy) recombine(id1, id2 int, newID func() int, breakpoints []int) (int, int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	node1, ok1 := g.Nodes[id1]
+	node2, ok2 := g.Nodes[id2]
+	if ok1 && ok2 && len(node1.Parents) == 1 && len(node2.Parents) == 1 && !node1.reproduced && !node2.reproduced {
+		p1, p2 := node1.Parents[0], node2.Parents[0]
+		if p1 != p2 {
+			node1.Parents = []int{p1, p2}
+			node2.Parents = []int{p2, p1}
+			node1.Breakpoints = append([]int{}, breakpoints...)
+			node2.Breakpoints = append([]int{}, breakpoints...)
+		}
+		return id1, id2
+	}
+	// Each recombinant is one generation after its first parent
+	generations := [2]int{1, 1}
+	for k, node := range []*GenealogyNode{node1, node2} {
+		if node != nil {
+			node.reproduced = true
+			generations[k] = node.Generation + 1
+		}
+	}
+	newID1, newID2 := newID(), newID()
+	g.Nodes[newID1] = &GenealogyNode{ID: newID1, Parents: []int{id1, id2}, Breakpoints: append([]int{}, breakpoints...), Generation: generations[0]}
+	g.Nodes[newID2] = &GenealogyNode{ID: newID2, Parents: []int{id2, id1}, Breakpoints: append([]int{}, breakpoints...), Generation: generations[1]}
+	return newID1, newID2
+}
+
+// parentAt returns the parent from which the node inherited the given
+// site, or -1 for a founder. Like the breakpoints, site is a column rank
+// if the alignment is tracked.
+func (node *GenealogyNode) parentAt(site int) int {
+	if len(node.Parents) == 0 {
+		return -1
+	}
+	k := sort.SearchInts(node.Breakpoints, site+1) // breakpoints at or before site
+	return node.Parents[k%len(node.Parents)]
+}
+
+// Copy returns a deep copy of the genealogy.
+func (g *Genealogy) Copy() *Genealogy {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	newG := NewGenealogy()
+	for id, node := range g.Nodes {
+		newNode := *node
+		newNode.Parents = append([]int(nil), node.Parents...)
+		newNode.Breakpoints = append([]int(nil), node.Breakpoints...)
+		newG.Nodes[id] = &newNode
+	}
+	return newG
+}
+
+// renumber changes the ID of every individual in the genealogy, and in
+// the parents of every node, from id to f(id).
+func (g *Genealogy) renumber(f func(id int) int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	nodes := make(map[int]*GenealogyNode, len(g.Nodes))
+	for _, node := range g.Nodes {
+		node.ID = f(node.ID)
+		for k, parent := range node.Parents {
+			node.Parents[k] = f(parent)
+		}
+		nodes[node.ID] = node
+	}
+	g.Nodes = nodes
+}
+
+// Simplify returns the genealogy of the given samples. It keeps only the
+// ancestors of the samples, and removes every ancestor that is neither a
+// sample nor a recombinant and has exactly one parent and one child, so
+// that its child descends directly from its parent. What remains are the
+// samples, founders, recombinants and the ancestors in which sampled
+// lineages coalesce.
+func (g *Genealogy) Simplify(samples []int) *Genealogy {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	isSample := make(map[int]bool)
+	retained := make(map[int]bool)
+	stack := []int{}
+	for _, id := range samples {
+		if _, ok := g.Nodes[id]; !ok {
+			panic(fmt.Sprintf("Sample %d is not in the genealogy", id))
+		}
+		isSample[id] = true
+		stack = append(stack, id)
+	}
+	numChildren := make(map[int]int)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if retained[id] {
+			continue
+		}
+		retained[id] = true
+		node, ok := g.Nodes[id]
+		if !ok {
+			continue
+		}
+		for _, parent := range uniqueParents(node.Parents) {
+			numChildren[parent]++
+			stack = append(stack, parent)
+		}
+	}
+
+	removable := func(id int) bool {
+		node, ok := g.Nodes[id]
+		return ok && !isSample[id] && len(node.Parents) == 1 && numChildren[id] == 1
+	}
+	resolve := func(id int) int {
+		for removable(id) {
+			id = g.Nodes[id].Parents[0]
+		}
+		return id
+	}
+	newG := NewGenealogy()
+	for id := range retained {
+		node, ok := g.Nodes[id]
+		if !ok || removable(id) {
+			continue
+		}
+		newNode := &GenealogyNode{ID: id, Generation: node.Generation, reproduced: numChildren[id] > 0}
+		for _, parent := range node.Parents {
+			newNode.Parents = append(newNode.Parents, resolve(parent))
+		}
+		if len(newNode.Parents) == 2 && newNode.Parents[0] != newNode.Parents[1] {
+			newNode.Breakpoints = append([]int{}, node.Breakpoints...)
+		} else if len(newNode.Parents) == 2 {
+			newNode.Parents = newNode.Parents[:1]
+		}
+		newG.Nodes[id] = newNode
+	}
+	return newG
+}
+
+// uniqueParents returns the parents without the second parent of a
+// recombinant if both parents are the same.
+func uniqueParents(parents []int) []int {
+	if len(parents) == 2 && parents[0] == parents[1] {
+		return parents[:1]
+	}
+	return parents
+}
+
+// LocalTree returns the genealogy of the samples at the given site in
+// Newick format. Lineages are traced back through the parent each
+// individual inherited the site from, nodes are labelled with individual
+// IDs, and branch lengths are differences in Generation. Ancestors in
+// which no lineages coalesce are left out, and lineages that do not
+// coalesce are joined at an unlabelled root.
+//
+// If the alignment is tracked, site is the rank of an alignment column,
+// that is, a column of Population.Alignment, rather than a position in the
+// ungapped sequences. Since insertions shift the ranks of the columns
+// after them, breakpoints recorded before an insertion may no longer match
+// the current alignment.
+func (g *Genealogy) LocalTree(site int, samples []int) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	isSample := make(map[int]bool)
+	children := make(map[int][]int)
+	visited := make(map[int]bool)
+	var roots []int
+	for _, id := range samples {
+		isSample[id] = true
+	}
+	for _, id := range samples {
+		for !visited[id] {
+			visited[id] = true
+			node, ok := g.Nodes[id]
+			parent := -1
+			if ok {
+				parent = node.parentAt(site)
+			}
+			if parent < 0 {
+				roots = append(roots, id)
+				break
+			}
+			children[parent] = append(children[parent], id)
+			id = parent
+		}
+	}
+	generation := func(id int) int {
+		if node, ok := g.Nodes[id]; ok {
+			return node.Generation
+		}
+		return 0
+	}
+	// skip follows a lineage down past ancestors without coalescence.
+	skip := func(id int) int {
+		for !isSample[id] && len(children[id]) == 1 {
+			id = children[id][0]
+		}
+		return id
+	}
+
+	var b strings.Builder
+	var write func(id int)
+	write = func(id int) {
+		if kids := children[id]; len(kids) > 0 {
+			sort.Ints(kids)
+			b.WriteString("(")
+			for k, child := range kids {
+				if k > 0 {
+					b.WriteString(",")
+				}
+				child = skip(child)
+				write(child)
+				fmt.Fprintf(&b, ":%d", generation(child)-generation(id))
+			}
+			b.WriteString(")")
+		}
+		fmt.Fprintf(&b, "%d", id)
+	}
+	sort.Ints(roots)
+	if len(roots) == 1 {
+		write(skip(roots[0]))
+	} else {
+		b.WriteString("(")
+		for k, root := range roots {
+			if k > 0 {
+				b.WriteString(",")
+			}
+			write(skip(root))
+		}
+		b.WriteString(")")
+	}
+	b.WriteString(";")
+	return b.String()
+}
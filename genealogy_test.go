@@ -0,0 +1,123 @@
+package mesim
+
+import (
+	"mesim/sampler"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// traceFounder follows the lineage of the given site back to a founder.
+func traceFounder(g *Genealogy, id, site int) int {
+	for {
+		parent := g.Node(id).parentAt(site)
+		if parent < 0 {
+			return id
+		}
+		id = parent
+	}
+}
+
+func TestGenealogy(t *testing.T) {
+	seqSpace := make([][]int, 20)
+	for i := range seqSpace {
+		seqSpace[i] = []int{i % 2, i % 2, i % 2, i % 2, i % 2, i % 2}
+	}
+	pop := NewPopulation(seqSpace, 2)
+	pop.Sampler = sampler.NewSampler(1)
+	pop.RecordGenealogy(NewGenealogy())
+	founders := make(map[int][]int)
+	for i, id := range pop.IDs {
+		founders[id] = seqSpace[i]
+	}
+	fitnessMatrix := [][]float64{{1, 1}, {1, 1}, {1, 1}, {1, 1}, {1, 1}, {1, 1}}
+	for g := 1; g <= 10; g++ {
+		pop.ReplicateSelect(20, fitnessMatrix, MultiplicativeFitness)
+		pop.Recombine(0.2)
+	}
+
+	numRecombinants := 0
+	for i, id := range pop.IDs {
+		node := pop.Genealogy.Node(id)
+		if node == nil || node.Generation != 10 {
+			t.Fatalf("Genealogy: expected a node of generation 10 for individual %d", id)
+		}
+		if node.Parents[0] != pop.ParentIDs[i] {
+			t.Errorf("Genealogy: expected the first parent of %d to be %d, actual %v", id, pop.ParentIDs[i], node.Parents)
+		}
+		if len(node.Parents) == 2 {
+			numRecombinants++
+		}
+		// Without mutation, every site is inherited unchanged from a founder
+		for site, char := range pop.Sequences[i] {
+			if founder := traceFounder(pop.Genealogy, id, site); founders[founder][site] != char {
+				t.Errorf("Genealogy: site %d of individual %d traced to founder %d with a different character", site, id, founder)
+			}
+		}
+	}
+	if numRecombinants == 0 {
+		t.Errorf("Genealogy: expected recombinants in the last generation")
+	}
+
+	simple := pop.Genealogy.Simplify(pop.IDs)
+	if len(simple.Nodes) >= len(pop.Genealogy.Nodes) {
+		t.Errorf("Simplify: expected fewer nodes, actual %d of %d", len(simple.Nodes), len(pop.Genealogy.Nodes))
+	}
+	for i, id := range pop.IDs {
+		for site := range pop.Sequences[i] {
+			if traceFounder(simple, id, site) != traceFounder(pop.Genealogy, id, site) {
+				t.Errorf("Simplify: expected site %d of individual %d to trace to the same founder", site, id)
+			}
+		}
+	}
+	tree := simple.LocalTree(0, pop.IDs[:5])
+	for _, id := range pop.IDs[:5] {
+		if !strings.Contains(tree, strconv.Itoa(id)+":") {
+			t.Errorf("LocalTree: expected sample %d in %s", id, tree)
+		}
+	}
+	if tree != pop.Genealogy.LocalTree(0, pop.IDs[:5]) {
+		t.Errorf("LocalTree: expected the same tree after simplification")
+	}
+}
+
+func TestLocalTree(t *testing.T) {
+	g := NewGenealogy()
+	g.Nodes[0] = &GenealogyNode{ID: 0}
+	g.addOffspring(1, 0)
+	g.addOffspring(2, 1)
+	g.addOffspring(3, 1)
+	g.addOffspring(4, 2)
+	if tree := g.LocalTree(0, []int{3, 4}); tree != "(4:2,3:1)1;" {
+		t.Errorf("LocalTree: expected (4:2,3:1)1;, actual %s", tree)
+	}
+	simple := g.Simplify([]int{3, 4})
+	if _, ok := simple.Nodes[2]; ok || simple.Nodes[4].Parents[0] != 1 {
+		t.Errorf("Simplify: expected node 2 to be removed")
+	}
+}
+
+func TestRecombinantGeneration(t *testing.T) {
+	g := NewGenealogy()
+	g.Nodes[0] = &GenealogyNode{ID: 0}
+	g.addOffspring(1, 0)
+	g.addOffspring(2, 1)
+	g.addOffspring(3, 2)
+	nextID := 10
+	newID := func() int {
+		nextID++
+		return nextID
+	}
+	// 1 of generation 1 already has offspring, so the recombinants of 1
+	// and 3 of generation 3 are new individuals
+	id1, id2 := g.recombine(1, 3, newID, []int{2})
+	if id1 == 1 || id2 == 3 {
+		t.Fatalf("recombine: expected new recombinants, actual %d and %d", id1, id2)
+	}
+	if generation := g.Node(id1).Generation; generation != 2 {
+		t.Errorf("recombine: expected generation 2, one after parent 1, actual %d", generation)
+	}
+	if generation := g.Node(id2).Generation; generation != 4 {
+		t.Errorf("recombine: expected generation 4, one after parent 3, actual %d", generation)
+	}
+}
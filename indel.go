@@ -0,0 +1,330 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+)
+
+// Gap is the character used for gaps in alignments.
+const Gap = -1
+
+// LengthDistribution is a distribution of indel lengths.
+type LengthDistribution interface {
+	SampleLength(s *sampler.Sampler) int
+}
+
+// GeometricLength is a geometric distribution of lengths on 1, 2, 3, ...
+// with P(L = k) = (1 - P)^(k-1) * P. The mean length is 1 / P.
+type GeometricLength struct {
+	P float64
+}
+
+// NewGeometricLength creates a geometric length distribution with success
+// probability p.
+func NewGeometricLength(p float64) *GeometricLength {
+	if p <= 0 || p > 1 {
+		panic("Probability must be in the range (0, 1]")
+	}
+	return &GeometricLength{P: p}
+}
+
+// SampleLength implements LengthDistribution.
+func (d *GeometricLength) SampleLength(s *sampler.Sampler) int {
+	if d.P == 1 {
+		return 1
+	}
+	// Inverse transform sampling
+	u := 1 - s.Float64()
+	return 1 + int(math.Floor(math.Log(u)/math.Log(1-d.P)))
+}
+
+// ZipfLength is a truncated Zipfian distribution of lengths on 1, ..., Max
+// with P(L = k) proportional to k^-A.
+type ZipfLength struct {
+	A   float64
+	Max int
+
+	cumP []float64
+}
+
+// NewZipfLength creates a Zipfian length distribution with exponent a and
+// maximum length max.
+func NewZipfLength(a float64, max int) *ZipfLength {
+	if a <= 0 {
+		panic("Exponent must be greater than zero")
+	}
+	if max < 1 {
+		panic("Maximum length must be greater than zero")
+	}
+	cumP := make([]float64, max)
+	sum := 0.0
+	for k := 1; k <= max; k++ {
+		sum += math.Pow(float64(k), -a)
+		cumP[k-1] = sum
+	}
+	for i := range cumP {
+		cumP[i] /= sum
+	}
+	return &ZipfLength{A: a, Max: max, cumP: cumP}
+}
+
+// SampleLength implements LengthDistribution.
+func (d *ZipfLength) SampleLength(s *sampler.Sampler) int {
+	x := s.Float64()
+	for i, p := range d.cumP {
+		if x < p {
+			return i + 1
+		}
+	}
+	return d.Max
+}
+
+// IndelModel describes insertion and deletion events.
+//
+// InsertionRate is the rate of insertions per position (including the
+// position after the last character) per generation, and DeletionRate the
+// rate of deletions per character per generation. Inserted characters are
+// drawn from InsertionFrequencies, or uniformly from the alphabet if nil.
+// A deletion never removes the last character of a sequence.
+type IndelModel struct {
+	InsertionRate        float64
+	DeletionRate         float64
+	InsertionLength      LengthDistribution
+	DeletionLength       LengthDistribution
+	InsertionFrequencies []float64
+}
+
+// NewIndelModel creates an indel model with the given rates and length
+// distributions and uniform inserted characters.
+func NewIndelModel(insertionRate, deletionRate float64, insertionLength, deletionLength LengthDistribution) *IndelModel {
+	if insertionRate < 0 || deletionRate < 0 {
+		panic("Indel rates must not be negative")
+	}
+	return &IndelModel{
+		InsertionRate:   insertionRate,
+		DeletionRate:    deletionRate,
+		InsertionLength: insertionLength,
+		DeletionLength:  deletionLength,
+	}
+}
+
+// TrackAlignment starts recording the true alignment of the population.
+// Every character is assigned to an alignment column; initially character
+// i of every sequence belongs to column i. Columns added by insertions are
+// numbered in the order they are created.
+//
+// While the alignment is tracked, site indices used by SiteRates refer to
+// alignment columns, and sites inserted later mutate at a relative rate of
+// one.
+func (pop *Population) TrackAlignment() {
+	if pop.Columns != nil {
+		return
+	}
+	pop.Columns = make([][]int, pop.Size())
+	for i, seq := range pop.Sequences {
+		pop.Columns[i] = make([]int, len(seq))
+		for j := range seq {
+			pop.Columns[i][j] = j
+		}
+	}
+	pop.columnOrder = make([]int, pop.NumSites)
+	for j := range pop.columnOrder {
+		pop.columnOrder[j] = j
+	}
+}
+
+// NumColumns returns the number of alignment columns created so far, or
+// the number of sites if the alignment is not tracked.
+func (pop *Population) NumColumns() int {
+	if pop.Columns == nil {
+		return pop.NumSites
+	}
+	return len(pop.columnOrder)
+}
+
+// Alignment returns the true alignment of the sequences at the given
+// indices, or of every sequence if no index is given. Columns are in
+// alignment order, gaps are marked with Gap, and columns that are gaps in
+// every returned sequence are omitted.
+func (pop *Population) Alignment(indices ...int) [][]int {
+	if indices == nil {
+		indices = make([]int, pop.Size())
+		for i := range indices {
+			indices[i] = i
+		}
+	}
+	if pop.Columns == nil {
+		alignment := make([][]int, len(indices))
+		for k, i := range indices {
+			alignment[k] = make([]int, len(pop.Sequences[i]))
+			copy(alignment[k], pop.Sequences[i])
+		}
+		return alignment
+	}
+
+	// Keep only occupied columns, in alignment order
+	occupied := make(map[int]bool)
+	for _, i := range indices {
+		for _, col := range pop.Columns[i] {
+			occupied[col] = true
+		}
+	}
+	position := make(map[int]int)
+	for _, col := range pop.columnOrder {
+		if occupied[col] {
+			position[col] = len(position)
+		}
+	}
+	alignment := make([][]int, len(indices))
+	for k, i := range indices {
+		alignment[k] = make([]int, len(position))
+		for j := range alignment[k] {
+			alignment[k][j] = Gap
+		}
+		for j, col := range pop.Columns[i] {
+			alignment[k][position[col]] = pop.Sequences[i][j]
+		}
+	}
+	return alignment
+}
+
+// Indel applies insertions and deletions to every sequence of the
+// population according to the model. The true alignment is tracked from
+// the first call on. The cached fitness of every individual that changed
+// is invalidated.
+func (pop *Population) Indel(model *IndelModel) {
+	pop.TrackAlignment()
+	s := pop.rng()
+	for i := range pop.Sequences {
+		length := len(pop.Sequences[i])
+		numInsertions := 0
+		if model.InsertionRate > 0 {
+			numInsertions = s.PoissonSample(model.InsertionRate * float64(length+1))
+		}
+		numDeletions := 0
+		if model.DeletionRate > 0 {
+			numDeletions = s.PoissonSample(model.DeletionRate * float64(length))
+		}
+		if numInsertions <= 0 && numDeletions <= 0 {
+			continue
+		}
+		// Apply events in random order
+		for _, isInsertion := range shuffledEvents(s, numInsertions, numDeletions) {
+			if isInsertion {
+				pop.insert(i, s.Intn(len(pop.Sequences[i])+1), model.InsertionLength.SampleLength(s), model.InsertionFrequencies)
+			} else {
+				pop.delete(i, s.Intn(len(pop.Sequences[i])), model.DeletionLength.SampleLength(s))
+			}
+		}
+		pop.invalidateFitnessAt(i)
+	}
+}
+
+// shuffledEvents returns a random ordering of insertion (true) and
+// deletion (false) events.
+func shuffledEvents(s *sampler.Sampler, numInsertions, numDeletions int) []bool {
+	if numInsertions < 0 {
+		numInsertions = 0
+	}
+	if numDeletions < 0 {
+		numDeletions = 0
+	}
+	events := make([]bool, numInsertions+numDeletions)
+	for k, idx := range s.Perm(len(events)) {
+		events[idx] = k < numInsertions
+	}
+	return events
+}
+
+// insert inserts length random characters before position pos of the i-th
+// sequence and creates the corresponding alignment columns.
+func (pop *Population) insert(i, pos, length int, freqs []float64) {
+	s := pop.rng()
+	seq := pop.Sequences[i]
+	cols := pop.Columns[i]
+
+	// New columns go right after the column of the preceding character
+	orderIdx := 0
+	if pos > 0 {
+		prevCol := cols[pos-1]
+		for k, col := range pop.columnOrder {
+			if col == prevCol {
+				orderIdx = k + 1
+				break
+			}
+		}
+	}
+	newChars := make([]int, length)
+	newCols := make([]int, length)
+	for k := range newChars {
+		if freqs != nil {
+			newChars[k] = s.MultinomialWhere(1, freqs, 1)[0]
+		} else {
+			newChars[k] = s.Intn(pop.NumChars)
+		}
+		newCols[k] = len(pop.columnOrder) + k
+	}
+	if pop.SiteRates != nil {
+		for range newCols {
+			pop.SiteRates = append(pop.SiteRates, 1)
+		}
+	}
+	pop.columnOrder = append(pop.columnOrder[:orderIdx], append(newCols, pop.columnOrder[orderIdx:]...)...)
+	pop.Sequences[i] = append(seq[:pos:pos], append(newChars, seq[pos:]...)...)
+	pop.Columns[i] = append(cols[:pos:pos], append(newCols, cols[pos:]...)...)
+}
+
+// delete removes up to length characters starting at position pos of the
+// i-th sequence, always leaving at least one character.
+func (pop *Population) delete(i, pos, length int) {
+	seq := pop.Sequences[i]
+	end := pos + length
+	if end > len(seq) {
+		end = len(seq)
+	}
+	if end-pos >= len(seq) {
+		end = pos + len(seq) - 1
+	}
+	if end <= pos {
+		return
+	}
+	pop.Sequences[i] = append(seq[:pos:pos], seq[end:]...)
+	pop.Columns[i] = append(pop.Columns[i][:pos:pos], pop.Columns[i][end:]...)
+}
+
+// columnRanks returns the position of every alignment column in
+// alignment order.
+func (pop *Population) columnRanks() []int {
+	ranks := make([]int, len(pop.columnOrder))
+	for k, col := range pop.columnOrder {
+		ranks[col] = k
+	}
+	return ranks
+}
+
+// siteRate returns the relative mutation rate of the j-th character of
+// the i-th sequence.
+func (pop *Population) siteRate(i, j int) float64 {
+	if pop.SiteRates == nil {
+		return 1
+	}
+	if pop.Columns == nil {
+		return pop.SiteRates[j]
+	}
+	return pop.SiteRates[pop.Columns[i][j]]
+}
+
+// charAt returns the character of the i-th sequence at the given site, or
+// false if the sequence has a gap there. Sites refer to alignment columns
+// when the alignment is tracked.
+func (pop *Population) charAt(i, site int) (int, bool) {
+	if pop.Columns == nil {
+		return pop.Sequences[i][site], true
+	}
+	for j, col := range pop.Columns[i] {
+		if col == site {
+			return pop.Sequences[i][j], true
+		}
+	}
+	return 0, false
+}
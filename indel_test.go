@@ -0,0 +1,115 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"testing"
+)
+
+func TestGeometricLength(t *testing.T) {
+	s := sampler.NewSampler(1)
+	d := NewGeometricLength(0.25)
+	sum := 0
+	for i := 0; i < 10000; i++ {
+		length := d.SampleLength(s)
+		if length < 1 {
+			t.Fatalf("GeometricLength.SampleLength(s): expected length >= 1, actual %d", length)
+		}
+		sum += length
+	}
+	if math.Abs(float64(sum)/10000-4) > 0.2 {
+		t.Errorf("GeometricLength.SampleLength(s): expected mean length about 4, actual %v", float64(sum)/10000)
+	}
+}
+
+func TestZipfLength(t *testing.T) {
+	s := sampler.NewSampler(1)
+	d := NewZipfLength(2, 5)
+	cnts := make([]int, 6)
+	for i := 0; i < 10000; i++ {
+		length := d.SampleLength(s)
+		if length < 1 || length > 5 {
+			t.Fatalf("ZipfLength.SampleLength(s): expected length in [1, 5], actual %d", length)
+		}
+		cnts[length]++
+	}
+	if cnts[1] < cnts[2] || cnts[2] < cnts[5] {
+		t.Errorf("ZipfLength.SampleLength(s): expected decreasing counts, actual %v", cnts[1:])
+	}
+}
+
+func TestIndelAlignment(t *testing.T) {
+	seqSpace := make([][]int, 20)
+	for i := range seqSpace {
+		seqSpace[i] = []int{0, 1, 2, 3, 0, 1, 2, 3, 0, 1}
+	}
+	pop := NewPopulation(seqSpace, 4)
+	pop.Sampler = sampler.NewSampler(5)
+	model := NewIndelModel(0.05, 0.05, NewGeometricLength(0.5), NewZipfLength(1.5, 4))
+	for i := 0; i < 5; i++ {
+		pop.Indel(model)
+		pop.Recombine(0.1)
+	}
+
+	lengthsDiffer := false
+	alignment := pop.Alignment()
+	for i, row := range alignment {
+		if len(row) != len(alignment[0]) {
+			t.Fatalf("Alignment(): expected rows of equal length, actual %d and %d", len(row), len(alignment[0]))
+		}
+		// Removing gaps must give back the sequence
+		var ungapped []int
+		for _, char := range row {
+			if char != Gap {
+				ungapped = append(ungapped, char)
+			}
+		}
+		if len(ungapped) != len(pop.Sequences[i]) {
+			t.Fatalf("Alignment(): expected row %d to contain %v, actual %v", i, pop.Sequences[i], row)
+		}
+		for j := range ungapped {
+			if ungapped[j] != pop.Sequences[i][j] {
+				t.Errorf("Alignment(): expected row %d to contain %v, actual %v", i, pop.Sequences[i], row)
+				break
+			}
+		}
+		if len(pop.Sequences[i]) != 10 {
+			lengthsDiffer = true
+		}
+	}
+	if !lengthsDiffer {
+		t.Errorf("Indel(model): expected some sequences to change length")
+	}
+}
+
+func TestIndelAlignmentHomology(t *testing.T) {
+	// Every original character is unique to its column, so homologous
+	// characters must stay in the same alignment column.
+	seqSpace := [][]int{
+		[]int{0, 1, 2, 3, 4, 5, 6, 7},
+		[]int{0, 1, 2, 3, 4, 5, 6, 7},
+		[]int{0, 1, 2, 3, 4, 5, 6, 7},
+		[]int{0, 1, 2, 3, 4, 5, 6, 7},
+	}
+	pop := NewPopulation(seqSpace, 9)
+	pop.Sampler = sampler.NewSampler(11)
+	// Inserted characters are always 8
+	freqs := []float64{0, 0, 0, 0, 0, 0, 0, 0, 1}
+	model := &IndelModel{InsertionRate: 0.1, DeletionRate: 0.1, InsertionLength: NewGeometricLength(0.5), DeletionLength: NewGeometricLength(0.5), InsertionFrequencies: freqs}
+	for i := 0; i < 3; i++ {
+		pop.Indel(model)
+	}
+	alignment := pop.Alignment()
+	for j := range alignment[0] {
+		char := Gap
+		for _, row := range alignment {
+			if row[j] == Gap || row[j] == 8 {
+				continue
+			}
+			if char != Gap && row[j] != char {
+				t.Errorf("Alignment(): expected homologous characters in column %d, actual %v", j, alignment)
+			}
+			char = row[j]
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package mesim
+
+import (
+	"math"
+)
+
+// DispersalKernel gives the probability with which offspring disperse
+// from the cell of their parent to other cells of a lattice.
+type DispersalKernel interface {
+	// Radius returns the largest distance, in cells along either axis,
+	// that offspring can disperse.
+	Radius() int
+	// Weight returns the unnormalised probability of dispersing by dr rows
+	// and dc columns.
+	Weight(dr, dc int) float64
+}
+
+// NearestNeighbourKernel keeps offspring in the cell of their parent with
+// probability 1 - Migration and sends them to each of the four
+// neighbouring cells with probability Migration / 4.
+type NearestNeighbourKernel struct {
+	Migration float64
+}
+
+// NewNearestNeighbourKernel creates a nearest neighbour kernel.
+func NewNearestNeighbourKernel(migration float64) *NearestNeighbourKernel {
+	if migration < 0 || migration > 1 {
+		panic("Migration must be in the range [0, 1]")
+	}
+	return &NearestNeighbourKernel{Migration: migration}
+}
+
+// Radius implements DispersalKernel.
+func (k *NearestNeighbourKernel) Radius() int {
+	return 1
+}
+
+// Weight implements DispersalKernel.
+func (k *NearestNeighbourKernel) Weight(dr, dc int) float64 {
+	switch absInt(dr) + absInt(dc) {
+	case 0:
+		return 1 - k.Migration
+	case 1:
+		return k.Migration / 4
+	}
+	return 0
+}
+
+// GaussianKernel disperses offspring by a distance d, in cells, with
+// probability proportional to exp(-d^2 / (2 Sigma^2)), up to four standard
+// deviations away.
+type GaussianKernel struct {
+	Sigma float64
+}
+
+// NewGaussianKernel creates a Gaussian kernel with the given standard
+// deviation in cells.
+func NewGaussianKernel(sigma float64) *GaussianKernel {
+	if sigma <= 0 {
+		panic("Sigma must be greater than zero")
+	}
+	return &GaussianKernel{Sigma: sigma}
+}
+
+// Radius implements DispersalKernel.
+func (k *GaussianKernel) Radius() int {
+	return int(math.Ceil(4 * k.Sigma))
+}
+
+// Weight implements DispersalKernel.
+func (k *GaussianKernel) Weight(dr, dc int) float64 {
+	d2 := float64(dr*dr + dc*dc)
+	return math.Exp(-d2 / (2 * k.Sigma * k.Sigma))
+}
+
+// FatTailedKernel disperses offspring by a distance d, in cells, with
+// probability proportional to (1 + d / Scale)^-Exponent, up to MaxDistance
+// cells away along either axis. Small exponents give the rare long-range
+// jumps that speed up range expansions.
+type FatTailedKernel struct {
+	Scale       float64
+	Exponent    float64
+	MaxDistance int
+}
+
+// NewFatTailedKernel creates a fat-tailed kernel.
+func NewFatTailedKernel(scale, exponent float64, maxDistance int) *FatTailedKernel {
+	if scale <= 0 || exponent <= 0 {
+		panic("Scale and exponent must be greater than zero")
+	}
+	if maxDistance < 0 {
+		panic("Maximum distance must not be negative")
+	}
+	return &FatTailedKernel{Scale: scale, Exponent: exponent, MaxDistance: maxDistance}
+}
+
+// Radius implements DispersalKernel.
+func (k *FatTailedKernel) Radius() int {
+	return k.MaxDistance
+}
+
+// Weight implements DispersalKernel.
+func (k *FatTailedKernel) Weight(dr, dc int) float64 {
+	d := math.Sqrt(float64(dr*dr + dc*dc))
+	return math.Pow(1+d/k.Scale, -k.Exponent)
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Lattice is a spatially explicit population on a grid of Rows by Cols
+// cells. Population holds all individuals, and Cells[i] is the cell of the
+// i-th individual; cell r*Cols+c lies in row r and column c.
+//
+// Every generation, each cell expects Fecundity times the number of
+// individuals dispersing into it from its own and other cells under
+// Kernel, and receives a Poisson number of offspring with that mean, up to
+// Capacity. The parents of the offspring of a cell are drawn in proportion
+// to their fitness times their probability of dispersing into the cell, so
+// selection is local. Offspring are then mutated as in Population.Mutate,
+// or as in Population.MutateContext if ContextMutation is not nil.
+// Recombination and indels are not applied.
+//
+// Dispersal off the edges of the grid is not possible; the kernel is
+// renormalised over the cells within reach. If Torus is true, the grid
+// wraps around at its edges instead.
+type Lattice struct {
+	Population      *Population
+	Cells           []int
+	Rows            int
+	Cols            int
+	Capacity        int
+	Fecundity       float64
+	Kernel          DispersalKernel
+	Torus           bool
+	MutationRate    float64
+	RateMatrix      [][]float64
+	ContextMutation *ContextModel
+	FitnessModel    FitnessModel
+
+	// Generation is the current generation of the lattice.
+	Generation int
+}
+
+// dispersal is a cell together with a dispersal probability.
+type dispersal struct {
+	cell int
+	p    float64
+}
+
+// NewLattice creates a lattice of rows by cols cells in which the
+// i-th individual of pop lives in cells[i]. Cells hold at most capacity
+// individuals, and every individual has fecundity 2.
+func NewLattice(pop *Population, cells []int, rows, cols, capacity int, kernel DispersalKernel, mutationRate float64, rateMatrix [][]float64, model FitnessModel) *Lattice {
+	if rows < 1 || cols < 1 {
+		panic("Number of rows and columns must be greater than zero")
+	}
+	if capacity < 1 {
+		panic("Capacity must be greater than zero")
+	}
+	if model == nil {
+		panic("Fitness model must not be nil")
+	}
+	if len(cells) != pop.Size() {
+		panic("There must be one cell for every individual")
+	}
+	for _, cell := range cells {
+		if cell < 0 || cell >= rows*cols {
+			panic("Cells must be in the range [0, rows*cols)")
+		}
+	}
+	return &Lattice{
+		Population:   pop,
+		Cells:        cells,
+		Rows:         rows,
+		Cols:         cols,
+		Capacity:     capacity,
+		Fecundity:    2,
+		Kernel:       kernel,
+		MutationRate: mutationRate,
+		RateMatrix:   rateMatrix,
+		FitnessModel: model,
+	}
+}
+
+// Cell returns the index of the cell in the given row and column.
+func (l *Lattice) Cell(row, col int) int {
+	return row*l.Cols + col
+}
+
+// CellSizes returns the number of individuals in every cell.
+func (l *Lattice) CellSizes() []int {
+	sizes := make([]int, l.Rows*l.Cols)
+	for _, cell := range l.Cells {
+		sizes[cell]++
+	}
+	return sizes
+}
+
+// Occupied returns the number of cells that hold at least one individual.
+func (l *Lattice) Occupied() int {
+	occupied := 0
+	for _, size := range l.CellSizes() {
+		if size > 0 {
+			occupied++
+		}
+	}
+	return occupied
+}
+
+// AlleleFrequencies returns the frequency of char at site in every cell,
+// or NaN for empty cells. As in Population.AlleleFrequency, site is an
+// alignment column if the alignment is tracked, and individuals with a gap
+// at that column do not carry char.
+func (l *Lattice) AlleleFrequencies(site, char int) []float64 {
+	counts := make([]float64, l.Rows*l.Cols)
+	sizes := l.CellSizes()
+	for i := range l.Population.Sequences {
+		if c, ok := l.Population.charAt(i, site); ok && c == char {
+			counts[l.Cells[i]]++
+		}
+	}
+	for cell := range counts {
+		if sizes[cell] == 0 {
+			counts[cell] = math.NaN()
+		} else {
+			counts[cell] /= float64(sizes[cell])
+		}
+	}
+	return counts
+}
+
+// dispersal returns, for every cell, the cells that offspring can disperse
+// into it from together with their probabilities.
+func (l *Lattice) dispersal() [][]dispersal {
+	radius := l.Kernel.Radius()
+	into := make([][]dispersal, l.Rows*l.Cols)
+	for r := 0; r < l.Rows; r++ {
+		for c := 0; c < l.Cols; c++ {
+			source := l.Cell(r, c)
+			var targets []dispersal
+			total := 0.0
+			for dr := -radius; dr <= radius; dr++ {
+				for dc := -radius; dc <= radius; dc++ {
+					nr, nc := r+dr, c+dc
+					if l.Torus {
+						nr, nc = ((nr%l.Rows)+l.Rows)%l.Rows, ((nc%l.Cols)+l.Cols)%l.Cols
+					} else if nr < 0 || nr >= l.Rows || nc < 0 || nc >= l.Cols {
+						continue
+					}
+					if w := l.Kernel.Weight(dr, dc); w > 0 {
+						targets = append(targets, dispersal{l.Cell(nr, nc), w})
+						total += w
+					}
+				}
+			}
+			for _, target := range targets {
+				into[target.cell] = append(into[target.cell], dispersal{source, target.p / total})
+			}
+		}
+	}
+	return into
+}
+
+// Step advances the lattice by one generation.
+func (l *Lattice) Step() {
+	pop := l.Population
+	s := pop.rng()
+	l.Generation++
+	if pop.Size() == 0 {
+		return
+	}
+	if model, ok := l.FitnessModel.(PopulationFitnessModel); ok {
+		model.Update(pop, l.Generation)
+		pop.InvalidateFitness()
+	}
+	logFitness := pop.ModelLogFitness(l.FitnessModel)
+	maxLogFitness := math.Inf(-1)
+	for _, w := range logFitness {
+		maxLogFitness = math.Max(maxLogFitness, w)
+	}
+	members := make([][]int, l.Rows*l.Cols)
+	for i, cell := range l.Cells {
+		members[cell] = append(members[cell], i)
+	}
+
+	offspringCells := make([][]int, pop.Size())
+	total := 0
+	for target, sources := range l.dispersal() {
+		expected := 0.0
+		var candidates []int
+		var weights []float64
+		for _, src := range sources {
+			expected += l.Fecundity * src.p * float64(len(members[src.cell]))
+			for _, i := range members[src.cell] {
+				w := src.p * math.Exp(logFitness[i]-maxLogFitness)
+				if w > 0 {
+					candidates = append(candidates, i)
+					weights = append(weights, w)
+				}
+			}
+		}
+		if expected <= 0 || len(candidates) == 0 {
+			continue
+		}
+		n := s.PoissonSample(expected)
+		if n > l.Capacity {
+			n = l.Capacity
+		}
+		if n <= 0 {
+			continue
+		}
+		sum := 0.0
+		for _, w := range weights {
+			sum += w
+		}
+		for k := range weights {
+			weights[k] /= sum
+		}
+		for k, cnt := range s.MultinomialSample(n, weights) {
+			for ; cnt > 0; cnt-- {
+				offspringCells[candidates[k]] = append(offspringCells[candidates[k]], target)
+			}
+		}
+		total += n
+	}
+
+	counts := make([]int, pop.Size())
+	newCells := make([]int, 0, total)
+	for i, targets := range offspringCells {
+		counts[i] = len(targets)
+		newCells = append(newCells, targets...)
+	}
+	pop.replicate(total, func() []int { return counts })
+	l.Cells = newCells
+	if pop.Size() == 0 {
+		return
+	}
+	if l.ContextMutation != nil {
+		pop.MutateContext(l.ContextMutation)
+	} else {
+		pop.Mutate(l.MutationRate, l.RateMatrix)
+	}
+}
+
+// Run advances the lattice by the given number of generations, or until
+// the population goes extinct. It returns the number of generations run.
+func (l *Lattice) Run(numGenerations int) int {
+	for k := 0; k < numGenerations; k++ {
+		if l.Population.Size() == 0 {
+			return k
+		}
+		l.Step()
+	}
+	return numGenerations
+}
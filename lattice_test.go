@@ -0,0 +1,96 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"testing"
+)
+
+func TestDispersalKernels(t *testing.T) {
+	kernels := []DispersalKernel{
+		NewNearestNeighbourKernel(0.4),
+		NewGaussianKernel(1.5),
+		NewFatTailedKernel(1, 2, 5),
+	}
+	for _, kernel := range kernels {
+		pop := NewPopulation([][]int{{0}}, 2)
+		l := NewLattice(pop, []int{0}, 5, 5, 10, kernel, 0, [][]float64{{0, 1}, {1, 0}}, MatrixFitness{Matrix: [][]float64{{1, 1}}, Func: MultiplicativeFitness})
+		l.Torus = true
+		// On a torus every cell keeps all of its offspring on the grid
+		out := make([]float64, 25)
+		for _, sources := range l.dispersal() {
+			for _, src := range sources {
+				out[src.cell] += src.p
+			}
+		}
+		for cell, p := range out {
+			if math.Abs(p-1) > 1e-12 {
+				t.Errorf("%T: expected dispersal from cell %d to sum to one, actual %v", kernel, cell, p)
+			}
+		}
+	}
+	if k := NewNearestNeighbourKernel(0.4); k.Weight(0, 0) != 0.6 || k.Weight(1, 0) != 0.1 || k.Weight(1, 1) != 0 {
+		t.Errorf("NearestNeighbourKernel: unexpected weights")
+	}
+}
+
+func TestLatticeRangeExpansion(t *testing.T) {
+	seqSpace := make([][]int, 20)
+	for i := range seqSpace {
+		seqSpace[i] = []int{i % 2}
+	}
+	pop := NewPopulation(seqSpace, 2)
+	pop.Sampler = sampler.NewSampler(1)
+	l := NewLattice(pop, make([]int, 20), 1, 100, 20, NewNearestNeighbourKernel(0.5), 0, [][]float64{{0, 1}, {1, 0}}, MatrixFitness{Matrix: [][]float64{{1, 1}}, Func: MultiplicativeFitness})
+	for g := 1; g <= 40; g++ {
+		l.Step()
+		sizes := l.CellSizes()
+		front := 0
+		for cell, size := range sizes {
+			if size > l.Capacity {
+				t.Fatalf("Step: expected at most %d individuals per cell, actual %d", l.Capacity, size)
+			}
+			if size > 0 {
+				front = cell
+			}
+		}
+		if front > g {
+			t.Fatalf("Step: expected nearest neighbour dispersal to advance at most one cell per generation, front at %d after %d generations", front, g)
+		}
+	}
+	if l.Occupied() < 10 {
+		t.Errorf("Run: expected the population to expand, actual %d occupied cells", l.Occupied())
+	}
+	if len(l.Cells) != pop.Size() {
+		t.Errorf("Run: expected one cell per individual, actual %d cells for %d individuals", len(l.Cells), pop.Size())
+	}
+
+	// Selection is local: a beneficial allele takes over its cell
+	pop = NewPopulation(seqSpace, 2)
+	pop.Sampler = sampler.NewSampler(1)
+	l = NewLattice(pop, make([]int, 20), 1, 3, 20, NewNearestNeighbourKernel(0), 0, [][]float64{{0, 1}, {1, 0}}, MatrixFitness{Matrix: [][]float64{{1, 2}}, Func: MultiplicativeFitness})
+	l.Run(20)
+	if f := l.AlleleFrequencies(0, 1); f[0] != 1 || !math.IsNaN(f[1]) {
+		t.Errorf("Run: expected the beneficial allele to fix in the occupied cell only, actual %v", f)
+	}
+}
+
+func TestLatticeTrackedAlignment(t *testing.T) {
+	pop := NewPopulation([][]int{{0, 1}, {1, 1}}, 2)
+	pop.TrackAlignment()
+	pop.delete(1, 0, 1)
+	l := NewLattice(pop, []int{0, 0}, 1, 1, 10, NewNearestNeighbourKernel(0), 0, [][]float64{{0, 1}, {1, 0}}, MatrixFitness{Matrix: [][]float64{{1, 1}, {1, 1}}, Func: MultiplicativeFitness})
+	if f := l.AlleleFrequencies(0, 1); f[0] != 0 {
+		t.Errorf("AlleleFrequencies: expected a gap not to count at column 0, actual %v", f)
+	}
+	if f := l.AlleleFrequencies(1, 1); f[0] != 1 {
+		t.Errorf("AlleleFrequencies: expected both individuals to carry 1 at column 1, actual %v", f)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewLattice: expected a panic for a nil fitness model")
+		}
+	}()
+	NewLattice(pop, []int{0, 0}, 1, 1, 10, NewNearestNeighbourKernel(0), 0, [][]float64{{0, 1}, {1, 0}}, nil)
+}
@@ -0,0 +1,340 @@
+package mesim
+
+import (
+	"mesim/sampler"
+	"sort"
+	"sync"
+)
+
+// Metapopulation is a structured population made of demes that exchange
+// migrants. Every deme is a simulation of its own, with its own
+// population, demography, rates and fitness model.
+//
+// Migration[a][b] is the probability that an individual of deme a moves
+// to deme b in one generation; the diagonal is ignored and individuals
+// stay in their deme with the remaining probability. Every generation,
+// migrants move first and then the demes advance one generation each, in
+// parallel. Demes are therefore soft-selected: a deme that receives more
+// migrants than it loses is brought back to the size given by its
+// demography by selection. Empty demes stay empty until they receive
+// migrants. Demes must not have indels, since migrants cannot take their
+// alignment columns from one deme to another.
+//
+// Because demes advance in parallel, they must not share samplers,
+// observers, engines with state such as GillespieEngine, or
+// population-dependent fitness models, which every deme would update with
+// its own population. Other fitness models may be shared. Migration draws
+// from Sampler, or from sampler.Default if nil.
+type Metapopulation struct {
+	Demes     []*Simulation
+	Migration [][]float64
+	Sampler   *sampler.Sampler
+
+	// Generation is the current generation of the metapopulation.
+	Generation int
+}
+
+// NewMetapopulation creates a metapopulation of the given demes with the
+// given migration matrix.
+//
+// All demes must have sequences of the same length over the same
+// alphabet. Demes without a sampler get one split off s, and demes without
+// a demography keep their initial size. Individual IDs are renumbered so
+// that they are unique across demes: ID x of deme d becomes
+// x * len(demes) + d, in IDs and ParentIDs alike, and in the genealogy
+// that the deme records, if any. Demes must therefore not share a
+// genealogy before the metapopulation is created; to record a single
+// genealogy of all demes, call RecordGenealogy on each deme afterwards.
+func NewMetapopulation(s *sampler.Sampler, migration [][]float64, demes ...*Simulation) *Metapopulation {
+	if len(demes) == 0 {
+		panic("There must be at least one deme")
+	}
+	validateMigration(migration, len(demes))
+	m := &Metapopulation{Demes: demes, Migration: migration, Sampler: s}
+	genealogies := make(map[*Genealogy]bool)
+	for d, deme := range demes {
+		pop := deme.Population
+		if pop.Columns != nil || deme.Indels != nil {
+			panic("Migration does not support indels or tracked alignments")
+		}
+		if pop.NumSites != demes[0].Population.NumSites || pop.NumChars != demes[0].Population.NumChars {
+			panic("Demes must have the same number of sites and characters")
+		}
+		if g := pop.Genealogy; g != nil {
+			if genealogies[g] {
+				panic("Demes must not share a genealogy before the metapopulation is created")
+			}
+			genealogies[g] = true
+		}
+		if pop.Sampler == nil {
+			pop.Sampler = m.rng().Split()
+		}
+		if deme.Demography == nil {
+			deme.Demography = NewConstantDemography(pop.Size())
+		}
+		renumber := func(id int) int {
+			if id < 0 {
+				return id
+			}
+			return id*len(demes) + d
+		}
+		for i := range pop.IDs {
+			pop.IDs[i] = renumber(pop.IDs[i])
+			pop.ParentIDs[i] = renumber(pop.ParentIDs[i])
+		}
+		if pop.Genealogy != nil {
+			pop.Genealogy.renumber(renumber)
+		}
+		pop.nextID = renumber(pop.nextID)
+		pop.idStride = len(demes)
+	}
+	return m
+}
+
+// validateMigration panics if migration is not a valid migration matrix
+// between numDemes demes.
+func validateMigration(migration [][]float64, numDemes int) {
+	if len(migration) != numDemes {
+		panic("Migration matrix must have one row per deme")
+	}
+	for a, row := range migration {
+		if len(row) != numDemes {
+			panic("Migration matrix must be square")
+		}
+		total := 0.0
+		for b, p := range row {
+			if p < 0 {
+				panic("Migration rates must not be negative")
+			}
+			if a != b {
+				total += p
+			}
+		}
+		if total > 1+1e-9 {
+			panic("Migration rates out of a deme must not sum to more than one")
+		}
+	}
+}
+
+// IslandMigration returns the migration matrix of the island model, in
+// which every individual migrates with probability m to one of the other
+// demes chosen uniformly at random.
+func IslandMigration(numDemes int, m float64) [][]float64 {
+	if numDemes < 1 {
+		panic("Number of demes must be greater than zero")
+	}
+	migration := newMigration(numDemes)
+	for a := range migration {
+		for b := range migration[a] {
+			if a != b {
+				migration[a][b] = m / float64(numDemes-1)
+			}
+		}
+	}
+	return stayRest(migration)
+}
+
+// SteppingStoneMigration returns the migration matrix of the
+// one-dimensional stepping-stone model, in which demes lie on a line and
+// every individual migrates with probability m/2 to each neighbouring
+// deme. If circular is true, the first and the last deme are neighbours.
+func SteppingStoneMigration(numDemes int, m float64, circular bool) [][]float64 {
+	if numDemes < 1 {
+		panic("Number of demes must be greater than zero")
+	}
+	migration := newMigration(numDemes)
+	for a := range migration {
+		for _, b := range []int{a - 1, a + 1} {
+			if circular {
+				b = (b + numDemes) % numDemes
+			}
+			if b >= 0 && b < numDemes && b != a {
+				migration[a][b] += m / 2
+			}
+		}
+	}
+	return stayRest(migration)
+}
+
+// SteppingStone2DMigration returns the migration matrix of the
+// two-dimensional stepping-stone model, in which demes lie on a grid of
+// the given number of rows and columns and every individual migrates with
+// probability m/4 to each of its four neighbouring demes. Deme r*cols+c
+// lies in row r and column c. If torus is true, the grid wraps around at
+// its edges.
+func SteppingStone2DMigration(rows, cols int, m float64, torus bool) [][]float64 {
+	if rows < 1 || cols < 1 {
+		panic("Number of rows and columns must be greater than zero")
+	}
+	migration := newMigration(rows * cols)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			for _, step := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+				nr, nc := r+step[0], c+step[1]
+				if torus {
+					nr, nc = (nr+rows)%rows, (nc+cols)%cols
+				}
+				if nr < 0 || nr >= rows || nc < 0 || nc >= cols || (nr == r && nc == c) {
+					continue
+				}
+				migration[r*cols+c][nr*cols+nc] += m / 4
+			}
+		}
+	}
+	return stayRest(migration)
+}
+
+func newMigration(numDemes int) [][]float64 {
+	migration := make([][]float64, numDemes)
+	for a := range migration {
+		migration[a] = make([]float64, numDemes)
+	}
+	return migration
+}
+
+// stayRest sets the diagonal of the migration matrix to the probability
+// of staying, so that every row sums to one.
+func stayRest(migration [][]float64) [][]float64 {
+	validateMigration(migration, len(migration))
+	for a, row := range migration {
+		row[a] = 0
+		total := 0.0
+		for _, p := range row {
+			total += p
+		}
+		row[a] = 1 - total
+	}
+	return migration
+}
+
+// rng returns the sampler used for migration.
+func (m *Metapopulation) rng() *sampler.Sampler {
+	if m.Sampler == nil {
+		return sampler.Default
+	}
+	return m.Sampler
+}
+
+// Size returns the total number of individuals in all demes.
+func (m *Metapopulation) Size() int {
+	size := 0
+	for _, deme := range m.Demes {
+		size += deme.Population.Size()
+	}
+	return size
+}
+
+// Sizes returns the number of individuals in every deme.
+func (m *Metapopulation) Sizes() []int {
+	sizes := make([]int, len(m.Demes))
+	for d, deme := range m.Demes {
+		sizes[d] = deme.Population.Size()
+	}
+	return sizes
+}
+
+// Step advances the metapopulation by one generation: migrants move
+// between demes, and then every deme advances one generation in parallel.
+func (m *Metapopulation) Step() {
+	m.Migrate()
+	var wg sync.WaitGroup
+	for _, deme := range m.Demes {
+		if deme.Population.Size() == 0 {
+			deme.Generation++
+			continue
+		}
+		wg.Add(1)
+		go func(deme *Simulation) {
+			defer wg.Done()
+			deme.Step()
+		}(deme)
+	}
+	wg.Wait()
+	m.Generation++
+}
+
+// Run advances the metapopulation by the given number of generations, or
+// until all demes are extinct. It returns the number of generations run.
+func (m *Metapopulation) Run(numGenerations int) int {
+	for k := 0; k < numGenerations; k++ {
+		if m.Size() == 0 {
+			return k
+		}
+		m.Step()
+	}
+	return numGenerations
+}
+
+// migrant is an individual on its way to another deme.
+type migrant struct {
+	seq      []int
+	id       int
+	parentID int
+}
+
+// Migrate moves individuals between demes according to the migration
+// matrix. Migrants keep their sequences and IDs, and their fitness is
+// evaluated anew in the deme they arrive in.
+func (m *Metapopulation) Migrate() {
+	validateMigration(m.Migration, len(m.Demes))
+	for _, deme := range m.Demes {
+		if deme.Population.Columns != nil {
+			panic("Migration does not support indels or tracked alignments")
+		}
+	}
+	s := m.rng()
+	arrivals := make([][]migrant, len(m.Demes))
+	departures := make([][]int, len(m.Demes))
+	for a, deme := range m.Demes {
+		pop := deme.Population
+		if pop.Size() == 0 {
+			continue
+		}
+		p := make([]float64, len(m.Demes))
+		copy(p, m.Migration[a])
+		p[a] = 0
+		total := 0.0
+		for _, rate := range p {
+			total += rate
+		}
+		if total <= 0 {
+			continue
+		}
+		p[a] = 1 - total
+		if p[a] < 0 {
+			p[a] = 0
+		}
+		counts := s.MultinomialSample(pop.Size(), p)
+		order := s.Perm(pop.Size())
+		k := 0
+		for b, cnt := range counts {
+			if b == a {
+				continue
+			}
+			for ; cnt > 0; cnt-- {
+				i := order[k]
+				k++
+				arrivals[b] = append(arrivals[b], migrant{pop.Sequences[i], pop.IDs[i], pop.ParentIDs[i]})
+				departures[a] = append(departures[a], i)
+			}
+		}
+	}
+	for a, deme := range m.Demes {
+		// Remove from the back so that swapped-in individuals have already
+		// been looked at
+		sort.Sort(sort.Reverse(sort.IntSlice(departures[a])))
+		for _, i := range departures[a] {
+			deme.Population.removeAt(i)
+		}
+	}
+	for b, deme := range m.Demes {
+		pop := deme.Population
+		for _, mig := range arrivals[b] {
+			pop.Sequences = append(pop.Sequences, mig.seq)
+			pop.IDs = append(pop.IDs, mig.id)
+			pop.ParentIDs = append(pop.ParentIDs, mig.parentID)
+			pop.fitness = append(pop.fitness, 0)
+			pop.fitnessValid = append(pop.fitnessValid, false)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"testing"
+)
+
+func TestMigrationMatrices(t *testing.T) {
+	island := IslandMigration(5, 0.2)
+	if island[0][0] != 0.8 || island[0][3] != 0.05 {
+		t.Errorf("IslandMigration: expected 0.8 to stay and 0.05 to each other deme, actual %v", island[0])
+	}
+	line := SteppingStoneMigration(4, 0.2, false)
+	if line[0][1] != 0.1 || line[0][3] != 0 || math.Abs(line[0][0]-0.9) > 1e-12 || math.Abs(line[1][1]-0.8) > 1e-12 {
+		t.Errorf("SteppingStoneMigration: unexpected matrix %v", line)
+	}
+	ring := SteppingStoneMigration(4, 0.2, true)
+	if ring[0][3] != 0.1 {
+		t.Errorf("SteppingStoneMigration: expected the ends to be neighbours, actual %v", ring[0])
+	}
+	grid := SteppingStone2DMigration(3, 3, 0.4, false)
+	if grid[4][1] != 0.1 || grid[4][0] != 0 || math.Abs(grid[4][4]-0.6) > 1e-12 || math.Abs(grid[0][0]-0.8) > 1e-12 {
+		t.Errorf("SteppingStone2DMigration: unexpected rows %v and %v", grid[4], grid[0])
+	}
+}
+
+func newTestMetapopulation(seed int64, m float64) *Metapopulation {
+	demes := make([]*Simulation, 2)
+	for d := range demes {
+		seqSpace := make([][]int, 100)
+		for i := range seqSpace {
+			seqSpace[i] = []int{d}
+		}
+		pop := NewPopulation(seqSpace, 2)
+		demes[d] = NewSimulation(pop, 0, 0, 0, [][]float64{{0, 1}, {1, 0}}, [][]float64{{1, 1}}, MultiplicativeFitness)
+	}
+	return NewMetapopulation(sampler.NewSampler(seed), IslandMigration(2, m), demes...)
+}
+
+func TestMetapopulation(t *testing.T) {
+	isolated := newTestMetapopulation(1, 0)
+	isolated.Run(20)
+	for d, deme := range isolated.Demes {
+		if f := deme.Population.AlleleFrequency(0, d); f != 1 {
+			t.Errorf("Metapopulation without migration: expected deme %d to stay fixed, actual frequency %v", d, f)
+		}
+	}
+
+	meta := newTestMetapopulation(1, 0.1)
+	meta.Migrate()
+	if sizes := meta.Sizes(); sizes[0]+sizes[1] != 200 || sizes[0] == 100 {
+		t.Errorf("Migrate: expected migrants to change deme sizes but not the total, actual %v", sizes)
+	}
+	seen := make(map[int]bool)
+	for _, deme := range meta.Demes {
+		for _, id := range deme.Population.IDs {
+			if seen[id] {
+				t.Fatalf("Migrate: expected unique IDs across demes, found %d twice", id)
+			}
+			seen[id] = true
+		}
+	}
+	meta.Run(20)
+	for d, deme := range meta.Demes {
+		if deme.Population.Size() != 100 {
+			t.Errorf("Run: expected deme %d to keep its size, actual %d", d, deme.Population.Size())
+		}
+		if f := deme.Population.AlleleFrequency(0, 1-d); f == 0 {
+			t.Errorf("Run: expected migrants from the other deme in deme %d", d)
+		}
+	}
+
+	// Parallel demes draw from their own samplers
+	other := newTestMetapopulation(1, 0.1)
+	other.Migrate()
+	other.Run(20)
+	for d := range meta.Demes {
+		for i, seq := range meta.Demes[d].Population.Sequences {
+			if seq[0] != other.Demes[d].Population.Sequences[i][0] || meta.Demes[d].Population.IDs[i] != other.Demes[d].Population.IDs[i] {
+				t.Fatalf("Run: expected the same result with the same seed")
+			}
+		}
+	}
+}
+
+func TestMetapopulationRejectsIndels(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewMetapopulation: expected a panic for demes with indels")
+		}
+	}()
+	demes := newTestMetapopulation(1, 0.1).Demes
+	demes[0].Indels = NewIndelModel(0.1, 0.1, NewGeometricLength(0.5), NewGeometricLength(0.5))
+	NewMetapopulation(sampler.NewSampler(1), IslandMigration(2, 0.1), demes...)
+}
+
+func TestMetapopulationRejectsMismatchedDemes(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewMetapopulation: expected a panic for demes of different lengths")
+		}
+	}()
+	demes := newTestMetapopulation(1, 0.1).Demes
+	pop := NewPopulation([][]int{{0, 0}, {1, 1}}, 2)
+	demes[1] = NewSimulation(pop, 0, 0, 0, [][]float64{{0, 1}, {1, 0}}, [][]float64{{1, 1}, {1, 1}}, MultiplicativeFitness)
+	NewMetapopulation(sampler.NewSampler(1), IslandMigration(2, 0.1), demes...)
+}
+
+func TestMetapopulationGenealogy(t *testing.T) {
+	demes := make([]*Simulation, 2)
+	for d := range demes {
+		pop := NewPopulation([][]int{{d}, {d}, {d}}, 2)
+		pop.Sampler = sampler.NewSampler(int64(d))
+		pop.RecordGenealogy(NewGenealogy())
+		demes[d] = NewSimulation(pop, 0, 0, 0, [][]float64{{0, 1}, {1, 0}}, [][]float64{{1, 1}}, MultiplicativeFitness)
+		demes[d].Demography = NewConstantDemography(pop.Size())
+		demes[d].Step()
+	}
+	// Without migration, every lineage stays in the genealogy of its deme
+	meta := NewMetapopulation(sampler.NewSampler(1), IslandMigration(2, 0), demes...)
+	meta.Run(2)
+	for d, deme := range meta.Demes {
+		pop := deme.Population
+		for _, id := range pop.IDs {
+			// Walk back to a founder through renumbered and new nodes alike
+			node := pop.Genealogy.Node(id)
+			for node != nil && len(node.Parents) > 0 {
+				node = pop.Genealogy.Node(node.Parents[0])
+			}
+			if node == nil {
+				t.Fatalf("Genealogy: expected the ancestry of %d in deme %d to reach a founder", id, d)
+			}
+			if node.Generation != 0 || node.ID%2 != d {
+				t.Errorf("Genealogy: expected individual %d of deme %d to descend from a founder of that deme, actual %d", id, d, node.ID)
+			}
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewMetapopulation: expected a panic for demes that share a genealogy")
+		}
+	}()
+	g := NewGenealogy()
+	for d := range demes {
+		pop := NewPopulation([][]int{{d}}, 2)
+		pop.RecordGenealogy(g)
+		demes[d] = NewSimulation(pop, 0, 0, 0, [][]float64{{0, 1}, {1, 0}}, [][]float64{{1, 1}}, MultiplicativeFitness)
+	}
+	NewMetapopulation(sampler.NewSampler(1), IslandMigration(2, 0.1), demes...)
+}
+
+func TestMetapopulationSharedLandscape(t *testing.T) {
+	landscape := NewHouseOfCardsFitness(sampler.NewSampler(2), 1)
+	meta := newTestMetapopulation(1, 0.1)
+	for _, deme := range meta.Demes {
+		deme.MutationRate = 0.1
+		deme.FitnessModel = landscape
+	}
+	meta.Run(10)
+	for d, deme := range meta.Demes {
+		pop := deme.Population
+		for i, f := range pop.ModelFitness(landscape) {
+			if expected := landscape.Fitness(pop.Sequences[i]); f != expected {
+				t.Fatalf("Metapopulation with a shared landscape: expected fitness %v in deme %d, actual %v", expected, d, f)
+			}
+		}
+	}
+}
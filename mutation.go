@@ -1,15 +1,21 @@
 package mesim
 
 import (
-	"math/rand"
 	"mesim/sampler"
+	"mesim/substitution"
+	"mesim/utils"
 )
 
 // MutateChar mutates the character into another based on a given rate
 // matrix. The passed character is expected to correspond to the row index
 // of the given rate matrix.
 func MutateChar(charPtr *int, rateMatrix [][]float64) {
-	*charPtr = sampler.MultinomialWhere(1, rateMatrix[*charPtr], 1)[0]
+	MutateCharWith(sampler.Default, charPtr, rateMatrix)
+}
+
+// MutateCharWith is like MutateChar but draws from the given sampler.
+func MutateCharWith(s *sampler.Sampler, charPtr *int, rateMatrix [][]float64) {
+	*charPtr = s.MultinomialWhere(1, rateMatrix[*charPtr], 1)[0]
 }
 
 // MutateSeqExplicitly mutates characters in the sequence probabilistically
@@ -17,8 +23,14 @@ func MutateChar(charPtr *int, rateMatrix [][]float64) {
 // character in the sequence and uses the given rate matrix to determine
 // whether the character changes into another or stays the same.
 func MutateSeqExplicitly(seqArrayPtr *[]int, rateMatrix [][]float64) {
+	MutateSeqExplicitlyWith(sampler.Default, seqArrayPtr, rateMatrix)
+}
+
+// MutateSeqExplicitlyWith is like MutateSeqExplicitly but draws from the
+// given sampler.
+func MutateSeqExplicitlyWith(s *sampler.Sampler, seqArrayPtr *[]int, rateMatrix [][]float64) {
 	for i, char := range *seqArrayPtr {
-		(*seqArrayPtr)[i] = sampler.MultinomialWhere(1, rateMatrix[char], 1)[0]
+		(*seqArrayPtr)[i] = s.MultinomialWhere(1, rateMatrix[char], 1)[0]
 	}
 }
 
@@ -32,19 +44,24 @@ func MutateSeqExplicitly(seqArrayPtr *[]int, rateMatrix [][]float64) {
 // generated coordinates will be mutated. In this case, transition to another
 // character is guaranteed.
 func MutateSeqFast(seqArrayPtr *[]int, mu float64, zeroedRateMatrix [][]float64) {
+	MutateSeqFastWith(sampler.Default, seqArrayPtr, mu, zeroedRateMatrix)
+}
+
+// MutateSeqFastWith is like MutateSeqFast but draws from the given sampler.
+func MutateSeqFastWith(s *sampler.Sampler, seqArrayPtr *[]int, mu float64, zeroedRateMatrix [][]float64) {
 	// Returns three arrays of equal lengths.
 	// array[0] is always 0, array[1] is column coords, and
 	// array[2] is number of hits
 	var mutCoords [][]int
 	if mu > 0.1 {
-		mutCoords = sampler.BinomialMutCoords(mu, len(*seqArrayPtr), 1)
+		mutCoords = s.BinomialMutCoords(mu, len(*seqArrayPtr), 1)
 	} else {
-		mutCoords = sampler.PoissonMutCoords(mu, len(*seqArrayPtr), 1)
+		mutCoords = s.PoissonMutCoords(mu, len(*seqArrayPtr), 1)
 	}
 
 	if len(mutCoords[2]) > 0 {
 		for _, yPos := range mutCoords[1] {
-			MutateChar(&(*seqArrayPtr)[yPos], zeroedRateMatrix)
+			MutateCharWith(s, &(*seqArrayPtr)[yPos], zeroedRateMatrix)
 		}
 	}
 }
@@ -62,34 +79,194 @@ func MutateSeqFast(seqArrayPtr *[]int, mu float64, zeroedRateMatrix [][]float64)
 // Then characters at the randomly sampled positions are mutated based on
 // the given transition rate matrix.
 func MutateSeqSpace(seqSpacePtr *[][]int, mu float64, rateMatrix [][]float64) {
-	if len(*seqSpacePtr) == 0 {
-		panic("Length of seqSpace must be greater than zero")
-	} else {
-		if len((*seqSpacePtr)[0]) == 0 {
-			panic("Length of rows in seqSpace must be greater than zero")
-		}
+	MutateSeqSpaceWith(sampler.Default, seqSpacePtr, mu, rateMatrix)
+}
+
+// MutateSeqSpaceWith is like MutateSeqSpace but draws from the given
+// sampler.
+func MutateSeqSpaceWith(s *sampler.Sampler, seqSpacePtr *[][]int, mu float64, rateMatrix [][]float64) {
+	pop := newPopulation(*seqSpacePtr, len(rateMatrix))
+	pop.Sampler = s
+	pop.Mutate(mu, rateMatrix)
+	*seqSpacePtr = pop.Sequences
+}
+
+// MutateSeqSpaceSiteRates is like MutateSeqSpace but sites mutate at
+// different relative rates. The expected number of hits per sequence is
+// mu times the sum of the site rates, and hits land on sites with
+// probability proportional to their rates. Sites with a rate of zero are
+// invariant.
+func MutateSeqSpaceSiteRates(seqSpacePtr *[][]int, mu float64, rateMatrix [][]float64, siteRates []float64) {
+	MutateSeqSpaceSiteRatesWith(sampler.Default, seqSpacePtr, mu, rateMatrix, siteRates)
+}
+
+// MutateSeqSpaceSiteRatesWith is like MutateSeqSpaceSiteRates but draws
+// from the given sampler.
+func MutateSeqSpaceSiteRatesWith(s *sampler.Sampler, seqSpacePtr *[][]int, mu float64, rateMatrix [][]float64, siteRates []float64) {
+	pop := newPopulation(*seqSpacePtr, len(rateMatrix))
+	pop.Sampler = s
+	pop.SetSiteRates(siteRates)
+	pop.Mutate(mu, rateMatrix)
+	*seqSpacePtr = pop.Sequences
+}
+
+// Mutate mutates the sequences of the population in place using the same
+// procedure as MutateSeqSpace. If the population has site rates, hits are
+// placed as in MutateSeqSpaceSiteRates. The cached fitness of every
+// individual that received at least one hit is invalidated.
+func (pop *Population) Mutate(mu float64, rateMatrix [][]float64) {
+	if len(rateMatrix) != pop.NumChars {
+		panic("Number of rows in rateMatrix must be equal to the number of characters")
+	}
+	if pop.Columns != nil {
+		pop.mutateAligned(mu, rateMatrix)
+		return
 	}
-	popSize := len(*seqSpacePtr)
-	numSites := len((*seqSpacePtr)[0])
+	s := pop.rng()
+	popSize := pop.Size()
+	numSites := pop.NumSites
 	muPerSeq := mu * float64(numSites)
+	if pop.SiteRates != nil {
+		muPerSeq = mu * utils.Sum(pop.SiteRates...)
+	}
 
 	// Returns three arrays of equal lengths.
 	// array[0] is always 0, array[1] is column coords, and
 	// array[2] is number of hits
 	var hitsPerSeq [][]int
 	if mu > 0.1 {
-		hitsPerSeq = sampler.BinomialMutCoords(muPerSeq, popSize, 1)
+		hitsPerSeq = s.BinomialMutCoords(muPerSeq, popSize, 1)
 	} else {
-		hitsPerSeq = sampler.PoissonMutCoords(muPerSeq, popSize, 1)
+		hitsPerSeq = s.PoissonMutCoords(muPerSeq, popSize, 1)
 	}
 
 	var permSites []int
 	var seqIdx int
 	for i, hits := range hitsPerSeq[2] {
-		permSites = rand.Perm(numSites)
-		seqIdx = hitsPerSeq[0][i]
-		for _, siteIdx := range permSites[:hits] {
-			MutateChar(&(*seqSpacePtr)[seqIdx][siteIdx], rateMatrix)
+		if hits > numSites {
+			hits = numSites
+		}
+		if pop.SiteRates != nil {
+			permSites = weightedSitesWithoutReplacement(s, pop.SiteRates, hits)
+		} else {
+			permSites = s.Perm(numSites)[:hits]
+		}
+		seqIdx = hitsPerSeq[1][i]
+		for _, siteIdx := range permSites {
+			pop.mutateCharAt(s, seqIdx, siteIdx, rateMatrix)
+		}
+		pop.invalidateFitnessAt(seqIdx)
+	}
+}
+
+// mutateCharAt mutates the j-th character of the i-th sequence with
+// MutateCharWith and notifies the mutation observers if it changed.
+func (pop *Population) mutateCharAt(s *sampler.Sampler, i, j int, rateMatrix [][]float64) {
+	oldChar := pop.Sequences[i][j]
+	newChar := oldChar
+	MutateCharWith(s, &newChar, rateMatrix)
+	if newChar != oldChar {
+		pop.notifyMutation(i, j, oldChar, newChar)
+		pop.Sequences[i][j] = newChar
+	}
+}
+
+// mutateAligned is the variant of Mutate for populations whose sequences
+// may differ in length because of indels. The number of hits is drawn
+// separately for each sequence from its own length and site rates.
+func (pop *Population) mutateAligned(mu float64, rateMatrix [][]float64) {
+	s := pop.rng()
+	for i := range pop.Sequences {
+		pop.mutateSequence(s, i, mu, rateMatrix)
+	}
+}
+
+// mutateSequence mutates the i-th sequence on its own. The number of hits
+// is Poisson distributed with mean mu times the sum of its site rates, and
+// hits land on distinct sites in proportion to their rates.
+func (pop *Population) mutateSequence(s *sampler.Sampler, i int, mu float64, rateMatrix [][]float64) {
+	seq := pop.Sequences[i]
+	weights := make([]float64, len(seq))
+	for j := range seq {
+		weights[j] = pop.siteRate(i, j)
+	}
+	muPerSeq := mu * utils.Sum(weights...)
+	if muPerSeq <= 0 {
+		return
+	}
+	hits := s.PoissonSample(muPerSeq)
+	if hits <= 0 {
+		return
+	}
+	for _, siteIdx := range weightedSitesWithoutReplacement(s, weights, hits) {
+		pop.mutateCharAt(s, i, siteIdx, rateMatrix)
+	}
+	pop.invalidateFitnessAt(i)
+}
+
+// MutateSeqContinuous mutates every character of the sequence along a
+// branch of length t under the instantaneous rate matrix q. The transition
+// probabilities P(t) = exp(qt) are computed once and each character is
+// replaced by a draw from the row of P(t) that corresponds to it, so the
+// result is exact for any t, unlike repeated per-generation steps.
+func MutateSeqContinuous(seqArrayPtr *[]int, q [][]float64, t float64) {
+	MutateSeqContinuousWith(sampler.Default, seqArrayPtr, q, t)
+}
+
+// MutateSeqContinuousWith is like MutateSeqContinuous but draws from the
+// given sampler.
+func MutateSeqContinuousWith(s *sampler.Sampler, seqArrayPtr *[]int, q [][]float64, t float64) {
+	MutateSeqExplicitlyWith(s, seqArrayPtr, substitution.TransitionMatrix(q, t))
+}
+
+// MutateSeqSpaceContinuous mutates every sequence in the sequence space
+// along a branch of length t under the instantaneous rate matrix q, as in
+// MutateSeqContinuous.
+func MutateSeqSpaceContinuous(seqSpacePtr *[][]int, q [][]float64, t float64) {
+	MutateSeqSpaceContinuousWith(sampler.Default, seqSpacePtr, q, t)
+}
+
+// MutateSeqSpaceContinuousWith is like MutateSeqSpaceContinuous but draws
+// from the given sampler.
+func MutateSeqSpaceContinuousWith(s *sampler.Sampler, seqSpacePtr *[][]int, q [][]float64, t float64) {
+	pop := newPopulation(*seqSpacePtr, len(q))
+	pop.Sampler = s
+	pop.MutateContinuous(q, t)
+	*seqSpacePtr = pop.Sequences
+}
+
+// MutateContinuous mutates every site of every sequence along a branch of
+// length t under the instantaneous rate matrix q. If the population has
+// site rates, a site with relative rate r evolves along a branch of length
+// r*t. The cached fitness of every individual that changed is invalidated.
+func (pop *Population) MutateContinuous(q [][]float64, t float64) {
+	if len(q) != pop.NumChars {
+		panic("Number of rows in q must be equal to the number of characters")
+	}
+	s := pop.rng()
+	// Transition matrices are computed once per distinct site rate
+	transitionMatrices := make(map[float64][][]float64)
+	transitionMatrixAt := func(i, j int) [][]float64 {
+		rate := pop.siteRate(i, j)
+		p, ok := transitionMatrices[rate]
+		if !ok {
+			p = substitution.TransitionMatrix(q, rate*t)
+			transitionMatrices[rate] = p
+		}
+		return p
+	}
+	for i, seq := range pop.Sequences {
+		changed := false
+		for j, char := range seq {
+			newChar := s.MultinomialWhere(1, transitionMatrixAt(i, j)[char], 1)[0]
+			if newChar != char {
+				pop.notifyMutation(i, j, char, newChar)
+				seq[j] = newChar
+				changed = true
+			}
+		}
+		if changed {
+			pop.invalidateFitnessAt(i)
 		}
 	}
 }
@@ -1,7 +1,8 @@
 package mesim
 
 import (
-	"math/rand"
+	"math"
+	"mesim/sampler"
 	"mesim/utils"
 	"testing"
 )
@@ -20,12 +21,12 @@ func TestMutateChar0To1(t *testing.T) {
 		[]float64{0.0, 0.0, 0.0, 0.0},
 	}
 	var newChar int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		newChar = ancChar
-		MutateChar(&newChar, rateMatrix)
+		MutateCharWith(s, &newChar, rateMatrix)
 		if newChar != 1 {
 			t.Errorf("MutateChar(%d): expected 1, actual (%d)", ancChar, newChar)
 		}
@@ -46,12 +47,12 @@ func TestMutateChar0To1Or2(t *testing.T) {
 		[]float64{0.0, 0.0, 0.0, 0.0},
 	}
 	var newChar int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		newChar = ancChar
-		MutateChar(&newChar, rateMatrix)
+		MutateCharWith(s, &newChar, rateMatrix)
 		if newChar != 1 && newChar != 2 {
 			t.Errorf("MutateChar(%d): expected 1 or 2, actual (%d)", ancChar, newChar)
 		}
@@ -70,12 +71,12 @@ func TestMutateCharNoChange(t *testing.T) {
 		[]float64{0.0, 0.0, 0.0, 1.0},
 	}
 	var newChar int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		newChar = ancChar
-		MutateChar(&newChar, rateMatrix)
+		MutateCharWith(s, &newChar, rateMatrix)
 		if newChar != ancChar {
 			t.Errorf("MutateChar(%d): expected 0, actual (%d)", ancChar, newChar)
 		}
@@ -96,12 +97,12 @@ func TestMutateCharMustChange(t *testing.T) {
 		[]float64{0.3, 0.3, 0.4, 0.0},
 	}
 	var newChar int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		newChar = ancChar
-		MutateChar(&newChar, rateMatrix)
+		MutateCharWith(s, &newChar, rateMatrix)
 		if newChar == ancChar {
 			t.Errorf("MutateChar(%d): expected 1, 2, or 3, actual (%d)", ancChar, newChar)
 		}
@@ -123,11 +124,11 @@ func TestMutateCharRandomChange(t *testing.T) {
 		[]float64{0.333, 0.333, 0.333, 0.001},
 	}
 	newChar := ancChar
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// Compound mutation for 10 rounds
 	for i := 0; i < 10; i++ {
-		MutateChar(&newChar, rateMatrix)
+		MutateCharWith(s, &newChar, rateMatrix)
 	}
 	if ancChar == newChar {
 		t.Errorf("MutateChar(%d): expected 1, 2, or 3, actual (%d)", ancChar, newChar)
@@ -149,13 +150,13 @@ func TestMutateSeqExplicitlyTo1(t *testing.T) {
 		[]float64{0.0, 1.0, 0.0, 0.0},
 	}
 	var evolvedSlice []int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		// Deepcopy ancArray
 		evolvedSlice = utils.DeepCopyInts(ancSlice)
-		MutateSeqExplicitly(&evolvedSlice, rateMatrix)
+		MutateSeqExplicitlyWith(s, &evolvedSlice, rateMatrix)
 		for i := range evolvedSlice {
 			if evolvedSlice[i] != 1 {
 				t.Errorf("MutateSeqExplicitly(seqArrayPtr, rateMatrix): expected 1, actual (%d)", evolvedSlice[i])
@@ -178,13 +179,13 @@ func TestMutateSeqExplicitlyTo1Or2(t *testing.T) {
 		[]float64{0.0, 0.5, 0.5, 0.0},
 	}
 	var evolvedSlice []int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		// Deepcopy ancArray
 		evolvedSlice = utils.DeepCopyInts(ancSlice)
-		MutateSeqExplicitly(&evolvedSlice, rateMatrix)
+		MutateSeqExplicitlyWith(s, &evolvedSlice, rateMatrix)
 		for i := range evolvedSlice {
 			if evolvedSlice[i] != 1 && evolvedSlice[i] != 2 {
 				t.Errorf("MutateSeqExplicitly(seqArrayPtr, rateMatrix): expected 1 or 2, actual (%d)", evolvedSlice[i])
@@ -206,13 +207,13 @@ func TestMutateSeqExplicitlyNoChange(t *testing.T) {
 		[]float64{0.0, 0.0, 0.0, 1.0},
 	}
 	var evolvedSlice []int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		// Deepcopy ancArray
 		evolvedSlice = utils.DeepCopyInts(ancSlice)
-		MutateSeqExplicitly(&evolvedSlice, rateMatrix)
+		MutateSeqExplicitlyWith(s, &evolvedSlice, rateMatrix)
 		for i := range evolvedSlice {
 			if evolvedSlice[i] != ancSlice[i] {
 				t.Errorf("MutateSeqExplicitly(seqArrayPtr, rateMatrix): expected %d, actual (%d)", ancSlice[i], evolvedSlice[i])
@@ -235,13 +236,13 @@ func TestMutateSeqExplicitlyMustChange(t *testing.T) {
 		[]float64{0.3, 0.3, 0.4, 0.0},
 	}
 	var evolvedSlice []int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		// Deepcopy ancArray
 		evolvedSlice = utils.DeepCopyInts(ancSlice)
-		MutateSeqExplicitly(&evolvedSlice, rateMatrix)
+		MutateSeqExplicitlyWith(s, &evolvedSlice, rateMatrix)
 		for i := range evolvedSlice {
 			if evolvedSlice[i] == ancSlice[i] {
 				t.Errorf("MutateSeqExplicitly(seqArrayPtr, rateMatrix): expected not equal to %d, actual (%d)", ancSlice[i], evolvedSlice[i])
@@ -265,11 +266,11 @@ func TestMutateSeqExplicitlyRandom(t *testing.T) {
 	}
 	// Deepcopy ancArray
 	evolvedSlice := utils.DeepCopyInts(ancSlice)
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// EvolveExplicit for 10 rounds
 	for i := 0; i < 10; i++ {
-		MutateSeqExplicitly(&evolvedSlice, rateMatrix)
+		MutateSeqExplicitlyWith(s, &evolvedSlice, rateMatrix)
 	}
 	sameSlices, _ := utils.CompareIntSlices(ancSlice, evolvedSlice)
 	if sameSlices == true {
@@ -291,13 +292,13 @@ func TestMutateSeqFastTo1(t *testing.T) {
 	}
 	mutationRate := 1.0
 	var evolvedSlice []int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		// Deepcopy ancArray
 		evolvedSlice = utils.DeepCopyInts(ancSlice)
-		MutateSeqFast(&evolvedSlice, mutationRate, rateMatrix)
+		MutateSeqFastWith(s, &evolvedSlice, mutationRate, rateMatrix)
 		for i := range evolvedSlice {
 			if evolvedSlice[i] != 1 {
 				t.Errorf("MutateSeqFast(seqArrayPtr, rateMatrix): expected 1, actual (%d)", evolvedSlice[i])
@@ -317,13 +318,13 @@ func TestMutateSeqFastTo1Or2(t *testing.T) {
 	}
 	mutationRate := 1.0
 	var evolvedSlice []int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		// Deepcopy ancArray
 		evolvedSlice = utils.DeepCopyInts(ancSlice)
-		MutateSeqFast(&evolvedSlice, mutationRate, rateMatrix)
+		MutateSeqFastWith(s, &evolvedSlice, mutationRate, rateMatrix)
 		for i := range evolvedSlice {
 			if evolvedSlice[i] != 1 && evolvedSlice[i] != 2 {
 				t.Errorf("MutateSeqFast(seqArrayPtr, rateMatrix): expected 1 or 2, actual (%d)", evolvedSlice[i])
@@ -343,13 +344,13 @@ func TestMutateSeqFastNoChange(t *testing.T) {
 	}
 	mutationRate := 0.0
 	var evolvedSlice []int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		// Deepcopy ancArray
 		evolvedSlice = utils.DeepCopyInts(ancSlice)
-		MutateSeqFast(&evolvedSlice, mutationRate, rateMatrix)
+		MutateSeqFastWith(s, &evolvedSlice, mutationRate, rateMatrix)
 		for i := range evolvedSlice {
 			if evolvedSlice[i] != ancSlice[i] {
 				t.Errorf("MutateSeqFast(seqArrayPtr, rateMatrix): expected %d, actual (%d)", ancSlice[i], evolvedSlice[i])
@@ -370,13 +371,13 @@ func TestMutateSeqFastMustChange(t *testing.T) {
 	}
 	mutationRate := 1.0
 	var evolvedSlice []int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		// Deepcopy ancArray
 		evolvedSlice = utils.DeepCopyInts(ancSlice)
-		MutateSeqFast(&evolvedSlice, mutationRate, rateMatrix)
+		MutateSeqFastWith(s, &evolvedSlice, mutationRate, rateMatrix)
 		for i := range evolvedSlice {
 			if evolvedSlice[i] == ancSlice[i] {
 				t.Errorf("MutateSeqFast(seqArrayPtr, rateMatrix): expected not equal to %d, actual (%d)", ancSlice[i], evolvedSlice[i])
@@ -396,11 +397,11 @@ func TestMutateSeqFastRandom(t *testing.T) {
 	mutationRate := 0.9
 	// Deepcopy ancArray
 	evolvedSlice := utils.DeepCopyInts(ancSlice)
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// EvolveExplicit for 10 rounds
 	for i := 0; i < 10; i++ {
-		MutateSeqFast(&evolvedSlice, mutationRate, rateMatrix)
+		MutateSeqFastWith(s, &evolvedSlice, mutationRate, rateMatrix)
 	}
 	sameSlices, _ := utils.CompareIntSlices(ancSlice, evolvedSlice)
 	if sameSlices == true {
@@ -429,14 +430,14 @@ func TestMutateSeqSpaceTo1(t *testing.T) {
 	}
 	mutationRate := 1.0 / float64(9)
 	var evolvedSeqSpace [][]int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		// Deepcopy ancArray
 		evolvedSeqSpace = utils.DeepCopyInts2d(ancSeqSpace)
 		fmt.Println(evolvedSeqSpace)
-		MutateSeqSpace(&evolvedSeqSpace, mutationRate, rateMatrix)
+		MutateSeqSpaceWith(s, &evolvedSeqSpace, mutationRate, rateMatrix)
 
 		sameMatrices, _ := utils.CompareIntMatrix(ancSeqSpace, evolvedSeqSpace)
 		if sameMatrices == true {
@@ -457,13 +458,13 @@ func TestMutateSeqSpaceTo1Or2(t *testing.T) {
 	}
 	mutationRate := 1.0
 	var evolvedSlice []int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		// Deepcopy ancArray
 		evolvedSlice = utils.DeepCopyInts(ancSeqSpace)
-		MutateSeqSpace(&evolvedSlice, mutationRate, rateMatrix)
+		MutateSeqSpaceWith(s, &evolvedSlice, mutationRate, rateMatrix)
 		for i := range evolvedSlice {
 			if evolvedSlice[i] != 1 && evolvedSlice[i] != 2 {
 				t.Errorf("MutateSeqSpace(seqArrayPtr, rateMatrix): expected 1 or 2, actual (%d)", evolvedSlice[i])
@@ -483,13 +484,13 @@ func TestMutateSeqSpaceNoChange(t *testing.T) {
 	}
 	mutationRate := 0.0
 	var evolvedSlice []int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		// Deepcopy ancArray
 		evolvedSlice = utils.DeepCopyInts(ancSeqSpace)
-		MutateSeqSpace(&evolvedSlice, mutationRate, rateMatrix)
+		MutateSeqSpaceWith(s, &evolvedSlice, mutationRate, rateMatrix)
 		for i := range evolvedSlice {
 			if evolvedSlice[i] != ancSeqSpace[i] {
 				t.Errorf("MutateSeqSpace(seqArrayPtr, rateMatrix): expected %d, actual (%d)", ancSeqSpace[i], evolvedSlice[i])
@@ -510,13 +511,13 @@ func TestMutateSeqSpaceMustChange(t *testing.T) {
 	}
 	mutationRate := 1.0
 	var evolvedSlice []int
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// MutateChar for 10 rounds
 	for i := 0; i < 10; i++ {
 		// Deepcopy ancArray
 		evolvedSlice = utils.DeepCopyInts(ancSeqSpace)
-		MutateSeqSpace(&evolvedSlice, mutationRate, rateMatrix)
+		MutateSeqSpaceWith(s, &evolvedSlice, mutationRate, rateMatrix)
 		for i := range evolvedSlice {
 			if evolvedSlice[i] == ancSeqSpace[i] {
 				t.Errorf("MutateSeqSpace(seqArrayPtr, rateMatrix): expected not equal to %d, actual (%d)", ancSeqSpace[i], evolvedSlice[i])
@@ -536,11 +537,11 @@ func TestMutateSeqSpaceRandom(t *testing.T) {
 	mutationRate := 0.9
 	// Deepcopy ancArray
 	evolvedSlice := utils.DeepCopyInts(ancSeqSpace)
-	rand.Seed(1)
+	s := sampler.NewSampler(1)
 
 	// EvolveExplicit for 10 rounds
 	for i := 0; i < 10; i++ {
-		MutateSeqSpace(&evolvedSlice, mutationRate, rateMatrix)
+		MutateSeqSpaceWith(s, &evolvedSlice, mutationRate, rateMatrix)
 	}
 	sameSlices, _ := utils.CompareIntSlices(ancSeqSpace, evolvedSlice)
 	if sameSlices == true {
@@ -548,3 +549,79 @@ func TestMutateSeqSpaceRandom(t *testing.T) {
 	}
 }
 */
+
+// Following tests different scenarios for the continuous-time mutation
+// functions
+
+// Test that no character changes along a branch of length zero.
+func TestMutateSeqContinuousZeroLength(t *testing.T) {
+	ancSlice := []int{0, 1, 2, 3, 0, 1, 2, 3}
+	q := [][]float64{
+		[]float64{-1.0, 1.0 / 3, 1.0 / 3, 1.0 / 3},
+		[]float64{1.0 / 3, -1.0, 1.0 / 3, 1.0 / 3},
+		[]float64{1.0 / 3, 1.0 / 3, -1.0, 1.0 / 3},
+		[]float64{1.0 / 3, 1.0 / 3, 1.0 / 3, -1.0},
+	}
+	evolvedSlice := utils.DeepCopyInts(ancSlice)
+	s := sampler.NewSampler(1)
+
+	MutateSeqContinuousWith(s, &evolvedSlice, q, 0)
+	sameSlices, _ := utils.CompareIntSlices(ancSlice, evolvedSlice)
+	if sameSlices == false {
+		t.Errorf("MutateSeqContinuous(seqArrayPtr, q, 0): expected %v, actual %v", ancSlice, evolvedSlice)
+	}
+}
+
+// Test that the proportion of changed characters along a long branch
+// matches the Jukes-Cantor expectation.
+func TestMutateSeqSpaceContinuousJC69(t *testing.T) {
+	q := [][]float64{
+		[]float64{-1.0, 1.0 / 3, 1.0 / 3, 1.0 / 3},
+		[]float64{1.0 / 3, -1.0, 1.0 / 3, 1.0 / 3},
+		[]float64{1.0 / 3, 1.0 / 3, -1.0, 1.0 / 3},
+		[]float64{1.0 / 3, 1.0 / 3, 1.0 / 3, -1.0},
+	}
+	branchLength := 0.5
+	seqSpace := make([][]int, 100)
+	for i := range seqSpace {
+		seqSpace[i] = make([]int, 100)
+	}
+	s := sampler.NewSampler(1)
+
+	MutateSeqSpaceContinuousWith(s, &seqSpace, q, branchLength)
+	diffCnt := 0
+	for _, seq := range seqSpace {
+		for _, char := range seq {
+			if char != 0 {
+				diffCnt++
+			}
+		}
+	}
+	expected := 0.75 - 0.75*math.Exp(-4*branchLength/3)
+	actual := float64(diffCnt) / 10000
+	if math.Abs(expected-actual) > 0.02 {
+		t.Errorf("MutateSeqSpaceContinuous(seqSpacePtr, q, %v): expected proportion of changes %v, actual %v", branchLength, expected, actual)
+	}
+}
+
+// Test that invariant sites do not change in continuous time.
+func TestMutateContinuousSiteRates(t *testing.T) {
+	q := [][]float64{
+		[]float64{-1.0, 1.0},
+		[]float64{1.0, -1.0},
+	}
+	seqSpace := make([][]int, 20)
+	for i := range seqSpace {
+		seqSpace[i] = []int{0, 0, 0, 0}
+	}
+	pop := NewPopulation(seqSpace, 2)
+	pop.SetSiteRates([]float64{0, 2, 0, 2})
+	pop.Sampler = sampler.NewSampler(1)
+
+	pop.MutateContinuous(q, 10)
+	for _, seq := range pop.Sequences {
+		if seq[0] != 0 || seq[2] != 0 {
+			t.Errorf("MutateContinuous(q, 10): expected invariant sites to stay 0, actual %v", seq)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package mesim
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ContactEdge is a contact between two hosts that lasts from generation
+// Start to generation End, inclusive. An End of -1 means that the contact
+// never ends.
+type ContactEdge struct {
+	Source int
+	Target int
+	Start  int
+	End    int
+}
+
+// active reports whether the contact takes place in the given generation.
+func (edge ContactEdge) active(generation int) bool {
+	return generation >= edge.Start && (edge.End < 0 || generation <= edge.End)
+}
+
+// TemporalNetwork is a contact network whose contacts may change over
+// time. Hosts are numbered from zero, and Labels holds their names, for
+// example the node IDs of the file the network was read from. Static
+// networks are temporal networks whose contacts never end.
+//
+// In an undirected network, every contact lets either host infect the
+// other; in a directed network, only Source can infect Target.
+type TemporalNetwork struct {
+	Labels   []string
+	Edges    []ContactEdge
+	Directed bool
+
+	index    map[string]int
+	incident [][]int
+}
+
+// NewTemporalNetwork creates a network without hosts or contacts.
+func NewTemporalNetwork(directed bool) *TemporalNetwork {
+	return &TemporalNetwork{Directed: directed, index: make(map[string]int)}
+}
+
+// Host returns the host with the given label, adding it to the network if
+// it is new.
+func (n *TemporalNetwork) Host(label string) int {
+	if n.index == nil {
+		n.index = make(map[string]int)
+	}
+	if host, ok := n.index[label]; ok {
+		return host
+	}
+	host := len(n.Labels)
+	n.index[label] = host
+	n.Labels = append(n.Labels, label)
+	n.incident = append(n.incident, nil)
+	return host
+}
+
+// NumHosts returns the number of hosts in the network. An epidemic on the
+// network must have as many hosts.
+func (n *TemporalNetwork) NumHosts() int {
+	return len(n.Labels)
+}
+
+// AddContact adds a contact between two hosts.
+func (n *TemporalNetwork) AddContact(edge ContactEdge) {
+	if edge.Source < 0 || edge.Source >= n.NumHosts() || edge.Target < 0 || edge.Target >= n.NumHosts() {
+		panic("Hosts of a contact must be in the network")
+	}
+	if edge.End >= 0 && edge.End < edge.Start {
+		panic("Contact must not end before it starts")
+	}
+	k := len(n.Edges)
+	n.Edges = append(n.Edges, edge)
+	n.incident[edge.Source] = append(n.incident[edge.Source], k)
+	if !n.Directed && edge.Target != edge.Source {
+		n.incident[edge.Target] = append(n.incident[edge.Target], k)
+	}
+}
+
+// Contacts implements ContactNetwork. Every host is returned once, however
+// many contacts the two hosts have in the generation.
+func (n *TemporalNetwork) Contacts(host, generation int) []int {
+	if host >= len(n.incident) {
+		return nil
+	}
+	var contacts []int
+	seen := make(map[int]bool)
+	for _, k := range n.incident[host] {
+		edge := n.Edges[k]
+		if !edge.active(generation) {
+			continue
+		}
+		other := edge.Target
+		if other == host {
+			other = edge.Source
+		}
+		if other != host && !seen[other] {
+			seen[other] = true
+			contacts = append(contacts, other)
+		}
+	}
+	return contacts
+}
+
+// parseGeneration parses a generation number, rounding down fractional
+// times. Negative times are rejected, since an End of -1 means that a
+// contact never ends.
+func parseGeneration(s string) (int, error) {
+	t, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(t) || math.IsInf(t, 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	if t < 0 {
+		return 0, fmt.Errorf("negative time %q", s)
+	}
+	return int(math.Floor(t)), nil
+}
+
+// ReadEdgeList reads a contact network from an edge list with a header
+// row. The columns named source and target hold the labels of the hosts
+// in contact. Contacts last from the generation in the start column to
+// the one in the end column, or only take place in the generation in the
+// time column; without these columns, contacts never end. Times must not
+// be negative. Hosts are numbered in order of first appearance. Comma is
+// the field separator; if zero, it is a comma.
+func ReadEdgeList(r io.Reader, comma rune, directed bool) (*TemporalNetwork, error) {
+	reader := csv.NewReader(r)
+	if comma != 0 {
+		reader.Comma = comma
+	}
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("mesim: reading header: %v", err)
+	}
+	columns := make(map[string]int)
+	for k, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = k
+	}
+	column := func(name string) int {
+		if k, ok := columns[name]; ok {
+			return k
+		}
+		return -1
+	}
+	sourceCol, targetCol := column("source"), column("target")
+	startCol, endCol, timeCol := column("start"), column("end"), column("time")
+	if sourceCol < 0 || targetCol < 0 {
+		return nil, fmt.Errorf("mesim: edge list must have columns %q and %q", "source", "target")
+	}
+
+	n := NewTemporalNetwork(directed)
+	lineNum := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		lineNum++
+		if err != nil {
+			return nil, fmt.Errorf("mesim: row %d: %v", lineNum, err)
+		}
+		field := func(k int) string {
+			if k < 0 || k >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[k])
+		}
+		if field(sourceCol) == "" || field(targetCol) == "" {
+			return nil, fmt.Errorf("mesim: row %d: missing source or target", lineNum)
+		}
+		edge := ContactEdge{Source: n.Host(field(sourceCol)), Target: n.Host(field(targetCol)), End: -1}
+		if timeCol >= 0 && field(timeCol) != "" {
+			if edge.Start, err = parseGeneration(field(timeCol)); err != nil {
+				return nil, fmt.Errorf("mesim: row %d: %v", lineNum, err)
+			}
+			edge.End = edge.Start
+		}
+		if startCol >= 0 && field(startCol) != "" {
+			if edge.Start, err = parseGeneration(field(startCol)); err != nil {
+				return nil, fmt.Errorf("mesim: row %d: %v", lineNum, err)
+			}
+		}
+		if endCol >= 0 && field(endCol) != "" {
+			if edge.End, err = parseGeneration(field(endCol)); err != nil {
+				return nil, fmt.Errorf("mesim: row %d: %v", lineNum, err)
+			}
+			if edge.End < edge.Start {
+				return nil, fmt.Errorf("mesim: row %d: contact ends before it starts", lineNum)
+			}
+		}
+		n.AddContact(edge)
+	}
+	return n, nil
+}
+
+// LoadEdgeList reads a contact network from the edge list at path. Fields
+// are separated by tabs in .tsv and .tab files and by commas otherwise.
+// See ReadEdgeList.
+func LoadEdgeList(path string, directed bool) (*TemporalNetwork, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	comma := ','
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tsv", ".tab":
+		comma = '\t'
+	}
+	return ReadEdgeList(f, comma, directed)
+}
+
+type graphML struct {
+	Keys []struct {
+		ID   string `xml:"id,attr"`
+		For  string `xml:"for,attr"`
+		Name string `xml:"attr.name,attr"`
+	} `xml:"key"`
+	Graphs []struct {
+		EdgeDefault string `xml:"edgedefault,attr"`
+		Nodes       []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+			Data   []struct {
+				Key   string `xml:"key,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"data"`
+		} `xml:"edge"`
+	} `xml:"graph"`
+}
+
+// ReadGraphML reads a contact network from a GraphML document. Hosts are
+// the nodes of the first graph, numbered in document order, and are
+// labelled with their IDs. The network is directed if the edgedefault of
+// the graph is directed. Edge data whose key is named start, end or time
+// gives the generations of the contact as in ReadEdgeList.
+func ReadGraphML(r io.Reader) (*TemporalNetwork, error) {
+	var doc graphML
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("mesim: parsing GraphML: %v", err)
+	}
+	timeKeys := make(map[string]string)
+	for _, key := range doc.Keys {
+		if key.For != "edge" && key.For != "all" {
+			continue
+		}
+		switch name := strings.ToLower(key.Name); name {
+		case "start", "end", "time":
+			timeKeys[key.ID] = name
+		}
+	}
+
+	if len(doc.Graphs) == 0 {
+		return nil, fmt.Errorf("mesim: GraphML document without a graph")
+	}
+	graph := doc.Graphs[0]
+	n := NewTemporalNetwork(graph.EdgeDefault == "directed")
+	for _, node := range graph.Nodes {
+		if node.ID == "" {
+			return nil, fmt.Errorf("mesim: node without an ID")
+		}
+		n.Host(node.ID)
+	}
+	for k, e := range graph.Edges {
+		source, okSource := n.index[e.Source]
+		target, okTarget := n.index[e.Target]
+		if !okSource || !okTarget {
+			return nil, fmt.Errorf("mesim: edge %d: unknown node %q or %q", k, e.Source, e.Target)
+		}
+		edge := ContactEdge{Source: source, Target: target, End: -1}
+		times := make(map[string]int)
+		for _, data := range e.Data {
+			name, ok := timeKeys[data.Key]
+			if !ok {
+				continue
+			}
+			t, err := parseGeneration(data.Value)
+			if err != nil {
+				return nil, fmt.Errorf("mesim: edge %d: %v", k, err)
+			}
+			times[name] = t
+		}
+		if t, ok := times["time"]; ok {
+			edge.Start, edge.End = t, t
+		}
+		if t, ok := times["start"]; ok {
+			edge.Start = t
+		}
+		if t, ok := times["end"]; ok {
+			edge.End = t
+		}
+		if edge.End >= 0 && edge.End < edge.Start {
+			return nil, fmt.Errorf("mesim: edge %d: contact ends before it starts", k)
+		}
+		n.AddContact(edge)
+	}
+	return n, nil
+}
+
+// LoadGraphML reads a contact network from the GraphML file at path. See
+// ReadGraphML.
+func LoadGraphML(path string) (*TemporalNetwork, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadGraphML(f)
+}
+
+// WriteTransmissions writes who infected whom and when as a table with the
+// columns generation, source and target, one row per transmission event in
+// the order they happened. The source of an index case is empty. Hosts are
+// written as labels[host], for example the labels of a TemporalNetwork, or
+// as host IDs if labels is nil.
+func (e *Epidemic) WriteTransmissions(w io.Writer, labels []string) error {
+	name := func(host int) string {
+		if host < 0 {
+			return ""
+		}
+		if labels != nil {
+			return labels[host]
+		}
+		return strconv.Itoa(host)
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"generation", "source", "target"}); err != nil {
+		return err
+	}
+	for _, event := range e.Events {
+		record := []string{strconv.Itoa(event.Generation), name(event.Source), name(event.Target)}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
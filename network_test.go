@@ -0,0 +1,113 @@
+package mesim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadEdgeList(t *testing.T) {
+	n, err := ReadEdgeList(strings.NewReader("source,target\nalice,bob\nbob,carol\n"), 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.NumHosts() != 3 || n.Labels[2] != "carol" {
+		t.Errorf("ReadEdgeList: expected hosts alice, bob and carol, actual %v", n.Labels)
+	}
+	if contacts := n.Contacts(1, 100); len(contacts) != 2 || contacts[0] != 0 || contacts[1] != 2 {
+		t.Errorf("Contacts: expected bob to meet alice and carol, actual %v", contacts)
+	}
+
+	temporal, err := ReadEdgeList(strings.NewReader("source\ttarget\tstart\tend\na\tb\t2\t4\nb\tc\t5\t\n"), '\t', true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(temporal.Contacts(0, 1)) != 0 || len(temporal.Contacts(0, 3)) != 1 || len(temporal.Contacts(0, 5)) != 0 {
+		t.Errorf("Contacts: expected a to meet b from generation 2 to 4 only")
+	}
+	if len(temporal.Contacts(1, 0)) != 0 || len(temporal.Contacts(1, 1000)) != 1 || len(temporal.Contacts(2, 1000)) != 0 {
+		t.Errorf("Contacts: expected b to meet c from generation 5 on, in one direction only")
+	}
+
+	for _, input := range []string{"from,to\na,b\n", "source,target,time\na,b,x\n", "source,target,start,end\na,b,4,2\n", "source,target,start,end\na,b,-3,-1\n"} {
+		if _, err := ReadEdgeList(strings.NewReader(input), 0, false); err == nil {
+			t.Errorf("ReadEdgeList(%q): expected an error", input)
+		}
+	}
+	if _, err := ReadEdgeList(strings.NewReader("source,target\na,\"b\n"), 0, false); err == nil || !strings.HasPrefix(err.Error(), "mesim: row 2: ") {
+		t.Errorf("ReadEdgeList: expected a prefixed error with the row of a malformed record, actual %v", err)
+	}
+}
+
+func TestReadGraphML(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="d0" for="edge" attr.name="time" attr.type="double"/>
+  <graph id="G" edgedefault="undirected">
+    <node id="n0"/>
+    <node id="n1"/>
+    <node id="n2"/>
+    <edge source="n0" target="n1"/>
+    <edge source="n1" target="n2"><data key="d0">3.0</data></edge>
+  </graph>
+</graphml>`
+	n, err := ReadGraphML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.NumHosts() != 3 || n.Directed {
+		t.Errorf("ReadGraphML: expected 3 hosts in an undirected network, actual %v", n.Labels)
+	}
+	if len(n.Contacts(2, 2)) != 0 || len(n.Contacts(2, 3)) != 1 || len(n.Contacts(0, 50)) != 1 {
+		t.Errorf("Contacts: unexpected contacts")
+	}
+	if _, err := ReadGraphML(strings.NewReader(strings.Replace(doc, `target="n2"`, `target="n9"`, 1))); err == nil {
+		t.Errorf("ReadGraphML: expected an error for an unknown node")
+	}
+	if _, err := ReadGraphML(strings.NewReader(strings.Replace(doc, "3.0", "-1", 1))); err == nil {
+		t.Errorf("ReadGraphML: expected an error for a negative time")
+	}
+	twoGraphs := strings.Replace(doc, "</graphml>", `<graph id="H" edgedefault="directed"><node id="m0"/></graph></graphml>`, 1)
+	first, err := ReadGraphML(strings.NewReader(twoGraphs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.NumHosts() != 3 || first.Directed {
+		t.Errorf("ReadGraphML: expected only the first graph to be read, actual hosts %v", first.Labels)
+	}
+}
+
+func TestEpidemicNetworkSize(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Step: expected a panic for a network with fewer hosts than the epidemic")
+		}
+	}()
+	n, err := ReadEdgeList(strings.NewReader("source,target\na,b\n"), 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newTestEpidemic(3, 0, 0)
+	e.Network = n
+	e.Step()
+}
+
+func TestWriteTransmissions(t *testing.T) {
+	n, err := ReadEdgeList(strings.NewReader("source,target,time\na,b,1\nb,c,1\nb,c,5\n"), 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newTestEpidemic(n.NumHosts(), 0, 0)
+	e.Network = n
+	e.Run(10)
+	var buf bytes.Buffer
+	if err := e.WriteTransmissions(&buf, n.Labels); err != nil {
+		t.Fatal(err)
+	}
+	// b is infected at the end of generation 1, too late for the first
+	// contact with c
+	expected := "generation,source,target\n0,,a\n1,a,b\n5,b,c\n"
+	if buf.String() != expected {
+		t.Errorf("WriteTransmissions: expected %q, actual %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,219 @@
+package mesim
+
+import (
+	"mesim/sampler"
+	"mesim/utils"
+)
+
+// Stage identifies the point within a generation at which an observer is
+// called.
+type Stage int
+
+const (
+	BeforeSelection Stage = iota
+	AfterSelection
+	BeforeMutation
+	AfterMutation
+	BeforeRecombination
+	AfterRecombination
+	EndOfGeneration
+)
+
+func (s Stage) String() string {
+	switch s {
+	case BeforeSelection:
+		return "before selection"
+	case AfterSelection:
+		return "after selection"
+	case BeforeMutation:
+		return "before mutation"
+	case AfterMutation:
+		return "after mutation"
+	case BeforeRecombination:
+		return "before recombination"
+	case AfterRecombination:
+		return "after recombination"
+	case EndOfGeneration:
+		return "end of generation"
+	}
+	return "unknown"
+}
+
+// Observer is notified of the state of the population at every stage of
+// a generation. The generation number is that of the generation being
+// produced. Observers must not modify the population.
+type Observer interface {
+	Observe(stage Stage, pop *Population, generation int)
+}
+
+// ObserverFunc adapts an ordinary function to the Observer interface.
+type ObserverFunc func(stage Stage, pop *Population, generation int)
+
+// Observe calls f(stage, pop, generation).
+func (f ObserverFunc) Observe(stage Stage, pop *Population, generation int) {
+	f(stage, pop, generation)
+}
+
+// notify calls every observer in order.
+func notify(observers []Observer, stage Stage, pop *Population, generation int) {
+	for _, obs := range observers {
+		obs.Observe(stage, pop, generation)
+	}
+}
+
+// MutationObserver is notified of every substitution made by the mutation
+// methods of a population, just before the character at the given site of
+// the i-th sequence changes from oldChar to newChar. Observers must not
+// modify the population.
+type MutationObserver interface {
+	ObserveMutation(pop *Population, i, site, oldChar, newChar int)
+}
+
+// MutationObserverFunc adapts an ordinary function to the
+// MutationObserver interface.
+type MutationObserverFunc func(pop *Population, i, site, oldChar, newChar int)
+
+// ObserveMutation calls f(pop, i, site, oldChar, newChar).
+func (f MutationObserverFunc) ObserveMutation(pop *Population, i, site, oldChar, newChar int) {
+	f(pop, i, site, oldChar, newChar)
+}
+
+// notifyMutation calls every mutation observer of the population in order.
+func (pop *Population) notifyMutation(i, site, oldChar, newChar int) {
+	for _, obs := range pop.MutationObservers {
+		obs.ObserveMutation(pop, i, site, oldChar, newChar)
+	}
+}
+
+// recordThisGeneration reports whether a recorder with the given interval
+// should record at the end of the given generation.
+func recordThisGeneration(stage Stage, generation int, interval int) bool {
+	if stage != EndOfGeneration {
+		return false
+	}
+	if interval < 1 {
+		interval = 1
+	}
+	return generation%interval == 0
+}
+
+// AlleleFrequencyRecorder records the frequency of every character at every
+// site at the end of every Interval-th generation.
+//
+// Frequencies[k][i][j] is the frequency of character j at site i in
+// generation Generations[k]. If the alignment is tracked, sites are
+// alignment columns and gaps are not counted as characters.
+type AlleleFrequencyRecorder struct {
+	Interval    int
+	Generations []int
+	Frequencies [][][]float64
+}
+
+// NewAlleleFrequencyRecorder creates an allele frequency recorder that
+// records every interval generations.
+func NewAlleleFrequencyRecorder(interval int) *AlleleFrequencyRecorder {
+	return &AlleleFrequencyRecorder{Interval: interval}
+}
+
+// Observe implements Observer.
+func (r *AlleleFrequencyRecorder) Observe(stage Stage, pop *Population, generation int) {
+	if !recordThisGeneration(stage, generation, r.Interval) {
+		return
+	}
+	freqs := pop.AlleleFrequencies()
+	r.Generations = append(r.Generations, generation)
+	r.Frequencies = append(r.Frequencies, freqs)
+}
+
+// FitnessRecorder records the fitness of every individual at the end of
+// every Interval-th generation.
+//
+// Fitness[k] holds the fitness values in generation Generations[k], and
+// MeanFitness[k] their mean. If Model is not nil, it is used instead of
+// FitnessMatrix and FitnessFunc. The recorder does not use or change the
+// fitness cache of the population, so it may record a different model
+// from the one used for selection.
+type FitnessRecorder struct {
+	Interval      int
+	FitnessMatrix [][]float64
+	FitnessFunc   FitnessFunc
+	Model         FitnessModel
+	Generations   []int
+	Fitness       [][]float64
+	MeanFitness   []float64
+}
+
+// NewFitnessRecorder creates a fitness recorder that evaluates fitness with
+// the given fitness matrix and function every interval generations.
+func NewFitnessRecorder(interval int, fitnessMatrix [][]float64, fitnessFunc FitnessFunc) *FitnessRecorder {
+	return &FitnessRecorder{Interval: interval, FitnessMatrix: fitnessMatrix, FitnessFunc: fitnessFunc}
+}
+
+// Observe implements Observer.
+func (r *FitnessRecorder) Observe(stage Stage, pop *Population, generation int) {
+	if !recordThisGeneration(stage, generation, r.Interval) {
+		return
+	}
+	model := r.Model
+	if model == nil {
+		model = MatrixFitness{Matrix: r.FitnessMatrix, Func: r.FitnessFunc}
+	}
+	// Evaluate directly rather than through the fitness cache of the
+	// population, which holds the values of the model used for selection
+	fitnessSpace := make([]float64, pop.Size())
+	for i, seq := range pop.Sequences {
+		fitnessSpace[i] = model.Fitness(seq)
+	}
+	meanFitness := 0.0
+	if len(fitnessSpace) > 0 {
+		meanFitness = utils.Sum(fitnessSpace...) / float64(len(fitnessSpace))
+	}
+	r.Generations = append(r.Generations, generation)
+	r.Fitness = append(r.Fitness, fitnessSpace)
+	r.MeanFitness = append(r.MeanFitness, meanFitness)
+}
+
+// SequenceRecorder records a random sample of SampleSize sequences, drawn
+// without replacement, at the end of every Interval-th generation.
+//
+// Sequences[k] and IDs[k] hold the sampled sequences and their individual
+// IDs in generation Generations[k]. If Sampler is nil, sampler.Default is
+// used.
+type SequenceRecorder struct {
+	Interval    int
+	SampleSize  int
+	Sampler     *sampler.Sampler
+	Generations []int
+	Sequences   [][][]int
+	IDs         [][]int
+}
+
+// NewSequenceRecorder creates a sequence recorder that samples sampleSize
+// sequences every interval generations.
+func NewSequenceRecorder(interval int, sampleSize int) *SequenceRecorder {
+	return &SequenceRecorder{Interval: interval, SampleSize: sampleSize}
+}
+
+// Observe implements Observer.
+func (r *SequenceRecorder) Observe(stage Stage, pop *Population, generation int) {
+	if !recordThisGeneration(stage, generation, r.Interval) {
+		return
+	}
+	s := r.Sampler
+	if s == nil {
+		s = sampler.Default
+	}
+	sampleSize := r.SampleSize
+	if sampleSize > pop.Size() {
+		sampleSize = pop.Size()
+	}
+	seqs := make([][]int, sampleSize)
+	ids := make([]int, sampleSize)
+	for i, idx := range s.Perm(pop.Size())[:sampleSize] {
+		seqs[i] = utils.DeepCopyInts(pop.Sequences[idx])
+		ids[i] = pop.IDs[idx]
+	}
+	r.Generations = append(r.Generations, generation)
+	r.Sequences = append(r.Sequences, seqs)
+	r.IDs = append(r.IDs, ids)
+}
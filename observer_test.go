@@ -0,0 +1,75 @@
+package mesim
+
+import (
+	"mesim/sampler"
+	"testing"
+)
+
+func TestObserverStages(t *testing.T) {
+	sim := newTestSimulation(3)
+	var stages []Stage
+	var generations []int
+	sim.AddObserver(ObserverFunc(func(stage Stage, pop *Population, generation int) {
+		stages = append(stages, stage)
+		generations = append(generations, generation)
+	}))
+	sim.Run()
+
+	if len(stages) != 3*7 {
+		t.Fatalf("Run(): expected %d observer calls, actual %d", 3*7, len(stages))
+	}
+	for i, stage := range stages {
+		if stage != Stage(i%7) {
+			t.Errorf("Run(): expected stage %v at call %d, actual %v", Stage(i%7), i, stage)
+		}
+		if generations[i] != i/7+1 {
+			t.Errorf("Run(): expected generation %d at call %d, actual %d", i/7+1, i, generations[i])
+		}
+	}
+}
+
+func TestRecorders(t *testing.T) {
+	sim := newTestSimulation(10)
+	freqRecorder := NewAlleleFrequencyRecorder(2)
+	fitRecorder := NewFitnessRecorder(5, sim.FitnessMatrix, sim.FitnessFunc)
+	seqRecorder := NewSequenceRecorder(1, 2)
+	sim.AddObserver(freqRecorder)
+	sim.AddObserver(fitRecorder)
+	sim.AddObserver(seqRecorder)
+	sim.Run()
+
+	if len(freqRecorder.Generations) != 5 || freqRecorder.Generations[0] != 2 {
+		t.Errorf("AlleleFrequencyRecorder: expected generations [2 4 6 8 10], actual %v", freqRecorder.Generations)
+	}
+	for _, freqs := range freqRecorder.Frequencies {
+		if freqs[0][0]+freqs[0][1] != 1 {
+			t.Errorf("AlleleFrequencyRecorder: expected frequencies at site 0 to sum to 1, actual %v", freqs[0])
+		}
+	}
+	if len(fitRecorder.MeanFitness) != 2 || len(fitRecorder.Fitness[0]) != 4 {
+		t.Errorf("FitnessRecorder: expected 2 records of 4 values, actual %v", fitRecorder.Fitness)
+	}
+	if len(seqRecorder.Sequences) != 10 || len(seqRecorder.Sequences[0]) != 2 {
+		t.Errorf("SequenceRecorder: expected 10 samples of 2 sequences, actual %v", seqRecorder.Sequences)
+	}
+}
+
+func TestFitnessRecorderDoesNotAffectSelection(t *testing.T) {
+	seqSpace := make([][]int, 100)
+	for i := range seqSpace {
+		seqSpace[i] = []int{i % 2}
+	}
+	pop := NewPopulation(seqSpace, 2)
+	pop.Sampler = sampler.NewSampler(1)
+	// Allele 1 is lethal, but the recorder evaluates a flat landscape
+	sim := NewSimulation(pop, 1, 0, 0, [][]float64{{0, 1}, {1, 0}}, [][]float64{{1, 0}}, MultiplicativeFitness)
+	recorder := NewFitnessRecorder(1, [][]float64{{1, 1}}, MultiplicativeFitness)
+	recorder.Observe(EndOfGeneration, pop, 0)
+	sim.Run()
+	if f := pop.AlleleFrequency(0, 1); f != 0 {
+		t.Errorf("Run: expected the lethal allele to be purged after a fitness recorder ran, actual frequency %v", f)
+	}
+	if recorder.MeanFitness[0] != 1 {
+		t.Errorf("FitnessRecorder: expected mean fitness 1 on the flat landscape, actual %v", recorder.MeanFitness[0])
+	}
+}
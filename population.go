@@ -0,0 +1,328 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"mesim/utils"
+	"reflect"
+)
+
+// Population is a set of haploid sequences of equal length whose characters
+// are drawn from an alphabet of NumChars characters. Besides the sequences,
+// it keeps per-individual metadata: a unique ID, the ID of the parent it was
+// replicated from, and a cache of fitness values.
+//
+// Sequences, IDs and ParentIDs are parallel slices; the i-th entry of each
+// refers to the same individual.
+//
+// All random draws made by the methods of a population come from Sampler.
+// If Sampler is nil, sampler.Default is used.
+//
+// SiteRates holds the relative mutation rate of each site. If nil, every
+// site mutates at the same rate.
+//
+// MutationObservers are notified of every substitution.
+//
+// Columns is nil unless the true alignment is tracked (see TrackAlignment).
+// Once insertions and deletions occur, sequences may differ in length and
+// NumSites only records the initial length; Columns[i][j] is the alignment
+// column of the j-th character of the i-th sequence.
+//
+// Genealogy is nil unless the ancestry of the population is recorded (see
+// RecordGenealogy).
+type Population struct {
+	Sequences [][]int
+	NumChars  int
+	NumSites  int
+	IDs       []int
+	ParentIDs []int
+	Sampler   *sampler.Sampler
+	SiteRates []float64
+	Columns   [][]int
+	Genealogy *Genealogy
+
+	MutationObservers []MutationObserver
+
+	fitness      []float64
+	fitnessValid []bool
+	fitnessModel FitnessModel
+	nextID       int
+	idStride     int
+	columnOrder  []int
+}
+
+// NewPopulation creates a new population from the given sequence space.
+// The sequences are deep copied so that the population owns its data.
+// Each sequence is assigned an ID in the order it appears in the sequence
+// space, and its parent ID is set to -1.
+func NewPopulation(seqSpace [][]int, numChars int) *Population {
+	if numChars < 1 {
+		panic("Number of characters must be greater than zero")
+	}
+	validateSeqSpace(seqSpace)
+	for _, seq := range seqSpace {
+		for _, char := range seq {
+			if char < 0 || char >= numChars {
+				panic("Characters in seqSpace must be in the range [0, numChars)")
+			}
+		}
+	}
+	return newPopulation(utils.DeepCopyInts2d(seqSpace), numChars)
+}
+
+// newPopulation wraps the given sequence space without copying it or
+// checking its characters against the alphabet. It is used by the
+// functions that operate on raw sequence spaces, which may pass zero as
+// numChars when the alphabet size is not known.
+func newPopulation(seqSpace [][]int, numChars int) *Population {
+	validateSeqSpace(seqSpace)
+	pop := &Population{
+		Sequences: seqSpace,
+		NumChars:  numChars,
+		NumSites:  len(seqSpace[0]),
+		IDs:       make([]int, len(seqSpace)),
+		ParentIDs: make([]int, len(seqSpace)),
+	}
+	for i := range seqSpace {
+		pop.IDs[i] = pop.newID()
+		pop.ParentIDs[i] = -1
+	}
+	pop.InvalidateFitness()
+	return pop
+}
+
+// validateSeqSpace panics if the sequence space is empty or if its
+// sequences are empty or of unequal lengths.
+func validateSeqSpace(seqSpace [][]int) {
+	if len(seqSpace) == 0 {
+		panic("Length of seqSpace must be greater than zero")
+	} else {
+		if len(seqSpace[0]) == 0 {
+			panic("Length of rows in seqSpace must be greater than zero")
+		}
+	}
+	for _, seq := range seqSpace {
+		if len(seq) != len(seqSpace[0]) {
+			panic("Rows in seqSpace must have equal lengths")
+		}
+	}
+}
+
+// Size returns the number of individuals in the population.
+func (pop *Population) Size() int {
+	return len(pop.Sequences)
+}
+
+// Copy returns a deep copy of the population, including its metadata.
+func (pop *Population) Copy() *Population {
+	newPop := &Population{
+		Sequences:         utils.DeepCopyInts2d(pop.Sequences),
+		NumChars:          pop.NumChars,
+		NumSites:          pop.NumSites,
+		IDs:               utils.DeepCopyInts(pop.IDs),
+		ParentIDs:         utils.DeepCopyInts(pop.ParentIDs),
+		Sampler:           pop.Sampler,
+		SiteRates:         copyFloats(pop.SiteRates),
+		MutationObservers: pop.MutationObservers,
+		fitness:           make([]float64, len(pop.fitness)),
+		fitnessValid:      make([]bool, len(pop.fitnessValid)),
+		fitnessModel:      pop.fitnessModel,
+		nextID:            pop.nextID,
+		idStride:          pop.idStride,
+	}
+	copy(newPop.fitness, pop.fitness)
+	copy(newPop.fitnessValid, pop.fitnessValid)
+	if pop.Columns != nil {
+		newPop.Columns = utils.DeepCopyInts2d(pop.Columns)
+		newPop.columnOrder = utils.DeepCopyInts(pop.columnOrder)
+	}
+	if pop.Genealogy != nil {
+		newPop.Genealogy = pop.Genealogy.Copy()
+	}
+	return newPop
+}
+
+// SetSiteRates sets the relative mutation rate of each site, or of each
+// alignment column if the alignment is tracked. Passing nil restores equal
+// rates.
+func (pop *Population) SetSiteRates(siteRates []float64) {
+	if siteRates != nil {
+		validateSiteRates(siteRates, pop.NumColumns())
+	}
+	pop.SiteRates = copyFloats(siteRates)
+}
+
+// rng returns the sampler used by the population.
+func (pop *Population) rng() *sampler.Sampler {
+	if pop.Sampler == nil {
+		return sampler.Default
+	}
+	return pop.Sampler
+}
+
+// newID returns a fresh individual ID.
+func (pop *Population) newID() int {
+	id := pop.nextID
+	if pop.idStride > 0 {
+		pop.nextID += pop.idStride
+	} else {
+		pop.nextID++
+	}
+	return id
+}
+
+// Fitness returns the fitness of every individual in the population.
+// Values are cached per individual and only recomputed for individuals
+// that changed since the last call, unless another fitness matrix or
+// function is given. Call InvalidateFitness when the fitness matrix is
+// changed in place.
+func (pop *Population) Fitness(fitnessMatrix [][]float64, fitnessFunc FitnessFunc) []float64 {
+	if len(fitnessMatrix) == 0 {
+		panic("Length of fitnessMatrix must be greater than zero")
+	}
+	return pop.ModelFitness(MatrixFitness{Matrix: fitnessMatrix, Func: fitnessFunc})
+}
+
+// ModelFitness returns the fitness of every individual in the population
+// under the given fitness model. Values are cached as in Fitness, and
+// evaluating a different model than the one that filled the cache clears
+// it. Call InvalidateFitness when a model changes in place.
+func (pop *Population) ModelFitness(model FitnessModel) []float64 {
+	fitnessSpace := pop.cachedFitness(model)
+	if _, ok := model.(LogFitnessModel); ok {
+		for i := range fitnessSpace {
+			fitnessSpace[i] = math.Exp(fitnessSpace[i])
+		}
+	}
+	return fitnessSpace
+}
+
+// ModelLogFitness returns the log fitness of every individual in the
+// population under the given fitness model. Values are cached as in
+// Fitness.
+func (pop *Population) ModelLogFitness(model FitnessModel) []float64 {
+	logFitnessSpace := pop.cachedFitness(model)
+	if _, ok := model.(LogFitnessModel); !ok {
+		for i := range logFitnessSpace {
+			logFitnessSpace[i] = math.Log(logFitnessSpace[i])
+		}
+	}
+	return logFitnessSpace
+}
+
+// cachedFitness updates the fitness cache and returns a copy of it. For
+// models that implement LogFitnessModel the cache holds log fitness. The
+// cache is cleared when it was filled by another model.
+func (pop *Population) cachedFitness(model FitnessModel) []float64 {
+	logModel, isLog := model.(LogFitnessModel)
+	if !sameModel(model, pop.fitnessModel) {
+		pop.InvalidateFitness()
+		pop.fitnessModel = model
+	}
+	for i, seq := range pop.Sequences {
+		if !pop.fitnessValid[i] {
+			if isLog {
+				pop.fitness[i] = logModel.LogFitness(seq)
+			} else {
+				pop.fitness[i] = model.Fitness(seq)
+			}
+			pop.fitnessValid[i] = true
+		}
+	}
+	fitnessSpace := make([]float64, len(pop.fitness))
+	copy(fitnessSpace, pop.fitness)
+	return fitnessSpace
+}
+
+// sameModel reports whether fitness cached under model b is valid for
+// model a. Matrix models are the same if they share their matrix and
+// function; other models if they are equal, which for pointers means the
+// same model. Models of types that cannot be compared are never the same.
+func sameModel(a, b FitnessModel) (same bool) {
+	// Comparable types may still hold values that cannot be compared
+	defer func() {
+		if recover() != nil {
+			same = false
+		}
+	}()
+	if a == nil || b == nil || reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+	switch a := a.(type) {
+	case MatrixFitness:
+		b := b.(MatrixFitness)
+		return sameMatrix(a.Matrix, b.Matrix) && sameFunc(a.Func, b.Func)
+	case LogMatrixFitness:
+		b := b.(LogMatrixFitness)
+		return sameMatrix(a.Matrix, b.Matrix) && sameFunc(a.Func, b.Func)
+	}
+	if !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// sameMatrix reports whether a and b are the same fitness matrix, not just
+// equal ones.
+func sameMatrix(a, b [][]float64) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// sameFunc reports whether a and b are the same fitness function.
+func sameFunc(a, b FitnessFunc) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+// MeanFitness returns the mean fitness of the population.
+func (pop *Population) MeanFitness(fitnessMatrix [][]float64, fitnessFunc FitnessFunc) float64 {
+	if pop.Size() == 0 {
+		return 0
+	}
+	return utils.Sum(pop.Fitness(fitnessMatrix, fitnessFunc)...) / float64(pop.Size())
+}
+
+// MeanModelFitness returns the mean fitness of the population under the
+// given fitness model.
+func (pop *Population) MeanModelFitness(model FitnessModel) float64 {
+	if pop.Size() == 0 {
+		return 0
+	}
+	return utils.Sum(pop.ModelFitness(model)...) / float64(pop.Size())
+}
+
+// AlleleFrequency returns the proportion of individuals carrying char at
+// the given site. If the alignment is tracked, site is an alignment column
+// and individuals with a gap at that column do not carry char.
+func (pop *Population) AlleleFrequency(site int, char int) float64 {
+	if pop.Size() == 0 {
+		return 0
+	}
+	cnt := 0
+	for i := range pop.Sequences {
+		if c, ok := pop.charAt(i, site); ok && c == char {
+			cnt++
+		}
+	}
+	return float64(cnt) / float64(pop.Size())
+}
+
+// InvalidateFitness clears the fitness cache of every individual.
+func (pop *Population) InvalidateFitness() {
+	pop.fitness = make([]float64, len(pop.Sequences))
+	pop.fitnessValid = make([]bool, len(pop.Sequences))
+}
+
+// invalidateFitnessAt clears the cached fitness of the i-th individual.
+func (pop *Population) invalidateFitnessAt(i int) {
+	pop.fitnessValid[i] = false
+}
+
+// copyFloats returns a copy of s, or nil if s is nil.
+func copyFloats(s []float64) []float64 {
+	if s == nil {
+		return nil
+	}
+	newCopy := make([]float64, len(s))
+	copy(newCopy, s)
+	return newCopy
+}
@@ -0,0 +1,186 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"mesim/utils"
+	"testing"
+)
+
+func TestNewPopulation(t *testing.T) {
+	seqSpace := [][]int{
+		[]int{0, 1, 2, 3},
+		[]int{3, 2, 1, 0},
+		[]int{0, 0, 0, 0},
+	}
+	pop := NewPopulation(seqSpace, 4)
+
+	if pop.Size() != 3 || pop.NumSites != 4 || pop.NumChars != 4 {
+		t.Errorf("NewPopulation(seqSpace, 4): expected size 3, 4 sites and 4 characters, actual %d, %d, %d", pop.Size(), pop.NumSites, pop.NumChars)
+	}
+	for i := range seqSpace {
+		if pop.IDs[i] != i {
+			t.Errorf("NewPopulation(seqSpace, 4): expected ID %d, actual %d", i, pop.IDs[i])
+		}
+		if pop.ParentIDs[i] != -1 {
+			t.Errorf("NewPopulation(seqSpace, 4): expected parent ID -1, actual %d", pop.ParentIDs[i])
+		}
+	}
+	// Population must own a copy of the sequences
+	pop.Sequences[0][0] = 3
+	if seqSpace[0][0] != 0 {
+		t.Errorf("NewPopulation(seqSpace, 4): expected sequences to be copied")
+	}
+}
+
+func TestNewPopulationInvalidChar(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("NewPopulation(seqSpace, 2): expected panic for out of range character")
+		}
+	}()
+	NewPopulation([][]int{[]int{0, 1, 2}}, 2)
+}
+
+func TestPopulationReplicateSelect(t *testing.T) {
+	seqSpace := [][]int{
+		[]int{0, 0, 0, 0},
+		[]int{1, 0, 0, 0},
+	}
+	fitnessMatrix := [][]float64{
+		[]float64{0.0, 1.0}, // Sequences with 0 at pos 0 never replicate
+		[]float64{1.0, 1.0},
+		[]float64{1.0, 1.0},
+		[]float64{1.0, 1.0},
+	}
+	fitnessFunc := func(seq []int, fitnessMatrix [][]float64) (multSum float64) {
+		multSum = float64(1)
+		for i, char := range seq {
+			multSum *= float64(fitnessMatrix[i][char])
+		}
+		return
+	}
+	pop := NewPopulation(seqSpace, 2)
+	pop.Sampler = sampler.NewSampler(1)
+	pop.ReplicateSelect(5, fitnessMatrix, fitnessFunc)
+
+	if pop.Size() != 5 {
+		t.Errorf("ReplicateSelect(5, fitnessMatrix, fitnessFunc): expected size 5, actual %d", pop.Size())
+	}
+	seen := make(map[int]bool)
+	for i, seq := range pop.Sequences {
+		if seq[0] != 1 {
+			t.Errorf("ReplicateSelect(5, fitnessMatrix, fitnessFunc): expected 1 at pos 0, actual %d", seq[0])
+		}
+		if pop.ParentIDs[i] != 1 {
+			t.Errorf("ReplicateSelect(5, fitnessMatrix, fitnessFunc): expected parent ID 1, actual %d", pop.ParentIDs[i])
+		}
+		if seen[pop.IDs[i]] || pop.IDs[i] < 2 {
+			t.Errorf("ReplicateSelect(5, fitnessMatrix, fitnessFunc): expected new unique IDs, actual %v", pop.IDs)
+		}
+		seen[pop.IDs[i]] = true
+	}
+	// Offspring must not share memory
+	pop.Sequences[0][1] = 1
+	if pop.Sequences[1][1] != 0 {
+		t.Errorf("ReplicateSelect(5, fitnessMatrix, fitnessFunc): expected offspring to be copies")
+	}
+}
+
+func TestPopulationFitnessCache(t *testing.T) {
+	seqSpace := [][]int{
+		[]int{0, 0},
+		[]int{1, 1},
+	}
+	fitnessMatrix := [][]float64{
+		[]float64{1.0, 2.0},
+		[]float64{1.0, 2.0},
+	}
+	calls := 0
+	fitnessFunc := func(seq []int, fitnessMatrix [][]float64) (multSum float64) {
+		calls++
+		multSum = float64(1)
+		for i, char := range seq {
+			multSum *= float64(fitnessMatrix[i][char])
+		}
+		return
+	}
+	pop := NewPopulation(seqSpace, 2)
+	pop.Fitness(fitnessMatrix, fitnessFunc)
+	fitnessSpace := pop.Fitness(fitnessMatrix, fitnessFunc)
+	if calls != 2 {
+		t.Errorf("Fitness(fitnessMatrix, fitnessFunc): expected 2 evaluations, actual %d", calls)
+	}
+	if fitnessSpace[0] != 1.0 || fitnessSpace[1] != 4.0 {
+		t.Errorf("Fitness(fitnessMatrix, fitnessFunc): expected [1 4], actual %v", fitnessSpace)
+	}
+	pop.InvalidateFitness()
+	pop.Fitness(fitnessMatrix, fitnessFunc)
+	if calls != 4 {
+		t.Errorf("Fitness(fitnessMatrix, fitnessFunc): expected 4 evaluations after invalidation, actual %d", calls)
+	}
+}
+
+func TestPopulationFitnessCacheLogAndLinear(t *testing.T) {
+	pop := NewPopulation([][]int{{0}, {1}}, 2)
+	fitnessMatrix := [][]float64{{1, 2}}
+	pop.ModelFitness(MatrixFitness{Matrix: fitnessMatrix, Func: MultiplicativeFitness})
+	logFitness := pop.ModelLogFitness(LogMatrixFitness{Matrix: [][]float64{{1, 4}}, Func: LogMultiplicativeFitness})
+	if logFitness[0] != 0 || math.Abs(logFitness[1]-math.Log(4)) > 1e-12 {
+		t.Errorf("ModelLogFitness: expected [0 log(4)] after a linear model filled the cache, actual %v", logFitness)
+	}
+}
+
+func TestPopulationFitnessCacheModels(t *testing.T) {
+	pop := NewPopulation([][]int{{0}, {1}}, 2)
+	pop.ModelFitness(MatrixFitness{Matrix: [][]float64{{1, 2}}, Func: MultiplicativeFitness})
+	if fitness := pop.ModelFitness(MatrixFitness{Matrix: [][]float64{{1, 3}}, Func: MultiplicativeFitness}); fitness[1] != 3 {
+		t.Errorf("ModelFitness: expected the fitness of another matrix, actual %v", fitness)
+	}
+	potts := NewPottsFitness([][]float64{{0, 1}}, nil)
+	if fitness := pop.ModelFitness(potts); fitness[1] != potts.Fitness([]int{1}) {
+		t.Errorf("ModelFitness: expected the fitness of another model, actual %v", fitness)
+	}
+	if sameModel(potts, NewPottsFitness([][]float64{{0, 1}}, nil)) || !sameModel(potts, potts) {
+		t.Errorf("sameModel: expected models to be told apart by identity")
+	}
+}
+
+func TestPopulationSamplerReproducible(t *testing.T) {
+	seqSpace := [][]int{
+		[]int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		[]int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+		[]int{2, 2, 2, 2, 2, 2, 2, 2, 2, 2},
+		[]int{3, 3, 3, 3, 3, 3, 3, 3, 3, 3},
+	}
+	rateMatrix := [][]float64{
+		[]float64{0.00, 0.34, 0.33, 0.33},
+		[]float64{0.33, 0.00, 0.34, 0.33},
+		[]float64{0.33, 0.33, 0.00, 0.34},
+		[]float64{0.34, 0.33, 0.33, 0.00},
+	}
+	fitnessMatrix := make([][]float64, 10)
+	for i := range fitnessMatrix {
+		fitnessMatrix[i] = []float64{1.0, 1.1, 1.2, 1.3}
+	}
+	fitnessFunc := func(seq []int, fitnessMatrix [][]float64) (multSum float64) {
+		multSum = float64(1)
+		for i, char := range seq {
+			multSum *= float64(fitnessMatrix[i][char])
+		}
+		return
+	}
+	run := func() [][]int {
+		pop := NewPopulation(seqSpace, 4)
+		pop.Sampler = sampler.NewSampler(2017)
+		for i := 0; i < 20; i++ {
+			pop.EvolveConstPop(0.05, 0.1, rateMatrix, fitnessMatrix, fitnessFunc)
+		}
+		return pop.Sequences
+	}
+	expected := run()
+	actual := run()
+	if same, _ := utils.CompareIntMatrix(expected, actual); same == false {
+		t.Errorf("EvolveConstPop(...): expected %v with the same seed, actual %v", expected, actual)
+	}
+}
@@ -0,0 +1,476 @@
+package mesim
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Amino acid alphabets of external DCA tools. Character k of a Potts model
+// read from their output is the k-th letter of the alphabet; '-' is the
+// gap. Use PottsFitness.Remap to convert to another alphabet, such as that
+// of the codon package.
+const (
+	PlmDCAAlphabet  = "-ACDEFGHIKLMNPQRSTVWY"
+	CCMpredAlphabet = "ARNDCQEGHILKMFPSTWYV-"
+)
+
+// pottsMagic starts every file in the binary Potts format.
+const pottsMagic = "MSPT"
+
+// pottsVersion is the version of the binary Potts format.
+const pottsVersion = 1
+
+// maxPottsSites, maxPottsChars and maxPottsBytes bound the size of Potts
+// models read from files, so that a corrupt header or index cannot make a
+// reader allocate without limit. maxPottsBytes bounds the memory taken by
+// the fields and the couplings present in the file.
+const (
+	maxPottsSites = 10000
+	maxPottsChars = 256
+	maxPottsBytes = 1 << 30
+)
+
+// checkPottsSize returns an error if a Potts model with the given number
+// of sites, characters and couplings exceeds the size limits.
+func checkPottsSize(numSites, numChars, numCouplings int) error {
+	if numSites > maxPottsSites || numChars > maxPottsChars {
+		return fmt.Errorf("Potts model of %d sites and %d characters exceeds the limit of %d sites and %d characters", numSites, numChars, maxPottsSites, maxPottsChars)
+	}
+	if 8*(numSites*numChars+numCouplings*numChars*numChars) > maxPottsBytes {
+		return fmt.Errorf("Potts model of %d sites, %d characters and %d couplings exceeds the limit of %d bytes", numSites, numChars, numCouplings, maxPottsBytes)
+	}
+	return nil
+}
+
+// Remap returns a copy of the model over the alphabet to, given that the
+// model is over the alphabet from. Fields and couplings of a letter of to
+// are those of the same letter of from, or zero if from lacks it.
+func (m *PottsFitness) Remap(from, to string) *PottsFitness {
+	if len([]rune(from)) != len(m.H[0]) {
+		panic("Length of the source alphabet must be equal to the number of characters of the model")
+	}
+	index := make(map[rune]int)
+	for i, letter := range []rune(from) {
+		index[letter] = i
+	}
+	mapping := make([]int, 0, len(to))
+	for _, letter := range to {
+		if i, ok := index[letter]; ok {
+			mapping = append(mapping, i)
+		} else {
+			mapping = append(mapping, -1)
+		}
+	}
+	h := make([][]float64, len(m.H))
+	for i := range h {
+		h[i] = make([]float64, len(mapping))
+		for a, oldA := range mapping {
+			if oldA >= 0 {
+				h[i][a] = m.H[i][oldA]
+			}
+		}
+	}
+	remapped := NewPottsFitness(h, nil)
+	for i := range m.J {
+		for j, coupling := range m.J[i] {
+			if coupling == nil {
+				continue
+			}
+			newCoupling := make([][]float64, len(mapping))
+			for a, oldA := range mapping {
+				newCoupling[a] = make([]float64, len(mapping))
+				for b, oldB := range mapping {
+					if oldA >= 0 && oldB >= 0 {
+						newCoupling[a][b] = coupling[oldA][oldB]
+					}
+				}
+			}
+			remapped.setCoupling(i, j, newCoupling)
+		}
+	}
+	return remapped
+}
+
+// ReadPottsText reads a Potts model in the text format written by plmDCA
+// and bmDCA. Every line is either
+//
+//	h i a value
+//	J i j a b value
+//
+// giving the field of character a at site i, or the coupling between
+// character a at site i and character b at site j. Sites and characters
+// are numbered from zero; the number of sites and characters is taken from
+// the largest indices found. Pairs may be given in either order, and
+// parameters that are not listed are zero. Empty lines and lines starting
+// with # are ignored.
+func ReadPottsText(r io.Reader) (*PottsFitness, error) {
+	type param struct {
+		i, j, a, b int
+		value      float64
+	}
+	var fields, couplings []param
+	numSites, numChars := 0, 0
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens := strings.Fields(line)
+		var numIndices int
+		switch tokens[0] {
+		case "h":
+			numIndices = 2
+		case "J":
+			numIndices = 4
+		default:
+			return nil, fmt.Errorf("mesim: line %d: unknown parameter type %q", lineNum, tokens[0])
+		}
+		if len(tokens) != numIndices+2 {
+			return nil, fmt.Errorf("mesim: line %d: expected %d values, found %d", lineNum, numIndices+1, len(tokens)-1)
+		}
+		indices := make([]int, numIndices)
+		for k := range indices {
+			idx, err := strconv.Atoi(tokens[k+1])
+			if err != nil || idx < 0 {
+				return nil, fmt.Errorf("mesim: line %d: invalid index %q", lineNum, tokens[k+1])
+			}
+			// Sites come before characters
+			if k < numIndices/2 && idx >= maxPottsSites {
+				return nil, fmt.Errorf("mesim: line %d: site %d beyond the limit of %d sites", lineNum, idx, maxPottsSites)
+			}
+			if k >= numIndices/2 && idx >= maxPottsChars {
+				return nil, fmt.Errorf("mesim: line %d: character %d beyond the limit of %d characters", lineNum, idx, maxPottsChars)
+			}
+			indices[k] = idx
+		}
+		value, err := strconv.ParseFloat(tokens[numIndices+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("mesim: line %d: invalid value %q", lineNum, tokens[numIndices+1])
+		}
+		if numIndices == 2 {
+			fields = append(fields, param{i: indices[0], a: indices[1], value: value})
+			numSites = maxInt(numSites, indices[0]+1)
+			numChars = maxInt(numChars, indices[1]+1)
+		} else {
+			if indices[0] == indices[1] {
+				return nil, fmt.Errorf("mesim: line %d: coupling of site %d with itself", lineNum, indices[0])
+			}
+			couplings = append(couplings, param{indices[0], indices[1], indices[2], indices[3], value})
+			numSites = maxInt(numSites, maxInt(indices[0], indices[1])+1)
+			numChars = maxInt(numChars, maxInt(indices[2], indices[3])+1)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("mesim: %v", err)
+	}
+	if numSites == 0 {
+		return nil, fmt.Errorf("mesim: no Potts parameters found")
+	}
+	pairs := make(map[[2]int]bool)
+	for _, p := range couplings {
+		pairs[[2]int{minInt(p.i, p.j), maxInt(p.i, p.j)}] = true
+	}
+	if err := checkPottsSize(numSites, numChars, len(pairs)); err != nil {
+		return nil, fmt.Errorf("mesim: %v", err)
+	}
+	m := newEmptyPotts(numSites, numChars)
+	for _, p := range fields {
+		m.H[p.i][p.a] = p.value
+	}
+	for _, p := range couplings {
+		i, j, a, b := p.i, p.j, p.a, p.b
+		if i > j {
+			i, j, a, b = j, i, b, a
+		}
+		if m.coupling(i, j) == nil {
+			m.setCoupling(i, j, newSquare(numChars))
+		}
+		m.J[i][j][a][b] = p.value
+	}
+	return m, nil
+}
+
+// ReadCCMpred reads a Potts model in the raw format written by CCMpred.
+// The file starts with one line of fields per site, with 20 or 21 values
+// in the order of CCMpredAlphabet; a missing gap field is zero. Each
+// coupling follows as a line "# i j" with sites numbered from zero and 21
+// lines of 21 values. Lines starting with #> hold metadata and are
+// ignored.
+func ReadCCMpred(r io.Reader) (*PottsFitness, error) {
+	numChars := len(CCMpredAlphabet)
+	var h [][]float64
+	type block struct {
+		i, j int
+		rows [][]float64
+	}
+	var blocks []*block
+	var current *block
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#>") {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			tokens := strings.Fields(strings.TrimPrefix(line, "#"))
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("mesim: line %d: expected a pair of sites", lineNum)
+			}
+			i, err1 := strconv.Atoi(tokens[0])
+			j, err2 := strconv.Atoi(tokens[1])
+			if err1 != nil || err2 != nil || i < 0 || j < 0 || i == j {
+				return nil, fmt.Errorf("mesim: line %d: invalid pair of sites", lineNum)
+			}
+			if err := checkPottsSize(maxInt(i, j)+1, numChars, len(blocks)+1); err != nil {
+				return nil, fmt.Errorf("mesim: line %d: %v", lineNum, err)
+			}
+			if current != nil && len(current.rows) != numChars {
+				return nil, fmt.Errorf("mesim: line %d: expected %d rows of couplings before", lineNum, numChars)
+			}
+			current = &block{i: i, j: j}
+			blocks = append(blocks, current)
+			continue
+		}
+		values, err := parseFloats(line)
+		if err != nil {
+			return nil, fmt.Errorf("mesim: line %d: %v", lineNum, err)
+		}
+		if current == nil {
+			if len(values) == numChars-1 {
+				values = append(values, 0)
+			}
+			if len(values) != numChars {
+				return nil, fmt.Errorf("mesim: line %d: expected %d fields, found %d", lineNum, numChars, len(values))
+			}
+			if err := checkPottsSize(len(h)+1, numChars, len(blocks)); err != nil {
+				return nil, fmt.Errorf("mesim: line %d: %v", lineNum, err)
+			}
+			h = append(h, values)
+			continue
+		}
+		if len(values) != numChars || len(current.rows) == numChars {
+			return nil, fmt.Errorf("mesim: line %d: expected %d rows of %d couplings", lineNum, numChars, numChars)
+		}
+		current.rows = append(current.rows, values)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("mesim: %v", err)
+	}
+	if len(h) == 0 {
+		return nil, fmt.Errorf("mesim: no fields found")
+	}
+	if current != nil && len(current.rows) != numChars {
+		return nil, fmt.Errorf("mesim: expected %d rows of couplings at the end of the file", numChars)
+	}
+	m := NewPottsFitness(h, nil)
+	for _, b := range blocks {
+		if b.i >= len(h) || b.j >= len(h) {
+			return nil, fmt.Errorf("mesim: coupling of sites %d and %d out of range", b.i, b.j)
+		}
+		m.SetCoupling(b.i, b.j, b.rows)
+	}
+	return m, nil
+}
+
+// ReadPottsBinary reads a Potts model in the binary format written by
+// WritePottsBinary.
+func ReadPottsBinary(r io.Reader) (*PottsFitness, error) {
+	magic := make([]byte, len(pottsMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, fmt.Errorf("mesim: reading magic number: %v", err)
+	}
+	if string(magic) != pottsMagic {
+		return nil, fmt.Errorf("mesim: not a binary Potts file")
+	}
+	var header [3]uint32
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("mesim: reading header: %v", err)
+	}
+	if header[0] != pottsVersion {
+		return nil, fmt.Errorf("mesim: unsupported binary Potts version %d", header[0])
+	}
+	numSites, numChars := int(header[1]), int(header[2])
+	if numSites == 0 || numChars == 0 {
+		return nil, fmt.Errorf("mesim: binary Potts file without sites or characters")
+	}
+	if err := checkPottsSize(numSites, numChars, 0); err != nil {
+		return nil, fmt.Errorf("mesim: %v", err)
+	}
+	// Fields are read site by site, so that a truncated file fails before
+	// the memory its header claims is allocated
+	h := make([][]float64, 0)
+	for i := 0; i < numSites; i++ {
+		field := make([]float64, numChars)
+		if err := binary.Read(r, binary.LittleEndian, field); err != nil {
+			return nil, fmt.Errorf("mesim: reading fields of site %d: %v", i, err)
+		}
+		h = append(h, field)
+	}
+	m := NewPottsFitness(h, nil)
+	var numCouplings uint32
+	if err := binary.Read(r, binary.LittleEndian, &numCouplings); err != nil {
+		return nil, fmt.Errorf("mesim: reading number of couplings: %v", err)
+	}
+	for k := 0; k < int(numCouplings); k++ {
+		if err := checkPottsSize(numSites, numChars, k+1); err != nil {
+			return nil, fmt.Errorf("mesim: %v", err)
+		}
+		var pair [2]uint32
+		if err := binary.Read(r, binary.LittleEndian, &pair); err != nil {
+			return nil, fmt.Errorf("mesim: reading coupling %d: %v", k, err)
+		}
+		if pair[0] >= pair[1] || pair[1] >= uint32(numSites) {
+			return nil, fmt.Errorf("mesim: invalid coupling of sites %d and %d", pair[0], pair[1])
+		}
+		i, j := int(pair[0]), int(pair[1])
+		if m.coupling(i, j) != nil {
+			return nil, fmt.Errorf("mesim: coupling of sites %d and %d given twice", i, j)
+		}
+		coupling := newSquare(numChars)
+		for a := range coupling {
+			if err := binary.Read(r, binary.LittleEndian, coupling[a]); err != nil {
+				return nil, fmt.Errorf("mesim: reading coupling %d: %v", k, err)
+			}
+		}
+		m.setCoupling(i, j, coupling)
+	}
+	return m, nil
+}
+
+// WritePottsBinary writes the model in the binary Potts format. All
+// values are little endian:
+//
+//	magic        4 bytes "MSPT"
+//	version      uint32, currently 1
+//	numSites     uint32
+//	numChars     uint32
+//	fields       numSites*numChars float64, site by site
+//	numCouplings uint32
+//	couplings    numCouplings times: uint32 i, uint32 j with i < j, and
+//	             numChars*numChars float64, row a holding J[i][j][a]
+func WritePottsBinary(w io.Writer, m *PottsFitness) error {
+	numChars := len(m.H[0])
+	if _, err := io.WriteString(w, pottsMagic); err != nil {
+		return err
+	}
+	header := [3]uint32{pottsVersion, uint32(len(m.H)), uint32(numChars)}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	for _, field := range m.H {
+		if err := binary.Write(w, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	numCouplings := uint32(0)
+	for i := range m.J {
+		for j := i + 1; j < len(m.J[i]); j++ {
+			if m.J[i][j] != nil {
+				numCouplings++
+			}
+		}
+	}
+	if err := binary.Write(w, binary.LittleEndian, numCouplings); err != nil {
+		return err
+	}
+	for i := range m.J {
+		for j := i + 1; j < len(m.J[i]); j++ {
+			if m.J[i][j] == nil {
+				continue
+			}
+			if err := binary.Write(w, binary.LittleEndian, [2]uint32{uint32(i), uint32(j)}); err != nil {
+				return err
+			}
+			for _, row := range m.J[i][j] {
+				if err := binary.Write(w, binary.LittleEndian, row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// LoadPottsText reads a Potts model from a file in the plmDCA text format.
+// See ReadPottsText.
+func LoadPottsText(path string) (*PottsFitness, error) {
+	return loadPotts(path, ReadPottsText)
+}
+
+// LoadCCMpred reads a Potts model from a raw CCMpred file. See
+// ReadCCMpred.
+func LoadCCMpred(path string) (*PottsFitness, error) {
+	return loadPotts(path, ReadCCMpred)
+}
+
+// LoadPottsBinary reads a Potts model from a file in the binary Potts
+// format. See WritePottsBinary.
+func LoadPottsBinary(path string) (*PottsFitness, error) {
+	return loadPotts(path, ReadPottsBinary)
+}
+
+func loadPotts(path string, read func(io.Reader) (*PottsFitness, error)) (*PottsFitness, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return read(bufio.NewReader(f))
+}
+
+// newEmptyPotts returns a Potts model with zero fields and no couplings.
+func newEmptyPotts(numSites, numChars int) *PottsFitness {
+	h := make([][]float64, numSites)
+	for i := range h {
+		h[i] = make([]float64, numChars)
+	}
+	return NewPottsFitness(h, nil)
+}
+
+// newSquare returns an n by n matrix of zeros.
+func newSquare(n int) [][]float64 {
+	matrix := make([][]float64, n)
+	for i := range matrix {
+		matrix[i] = make([]float64, n)
+	}
+	return matrix
+}
+
+// parseFloats parses whitespace separated numbers.
+func parseFloats(line string) ([]float64, error) {
+	tokens := strings.Fields(line)
+	values := make([]float64, len(tokens))
+	for k, token := range tokens {
+		value, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", token)
+		}
+		values[k] = value
+	}
+	return values, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
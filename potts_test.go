@@ -0,0 +1,202 @@
+package mesim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"mesim/sampler"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestReadPottsText(t *testing.T) {
+	text := `# plmDCA parameters
+h 0 0 0.5
+h 0 1 -0.5
+h 2 1 1.0
+J 0 2 1 1 2.0
+J 2 1 0 1 -1.0
+`
+	m, err := ReadPottsText(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("ReadPottsText: unexpected error %v", err)
+	}
+	if len(m.H) != 3 || len(m.H[0]) != 2 {
+		t.Fatalf("ReadPottsText: expected 3 sites and 2 characters, actual %d and %d", len(m.H), len(m.H[0]))
+	}
+	if m.J[1][2] == nil || m.J[1][2][1][0] != -1 {
+		t.Errorf("ReadPottsText: expected reversed pair to be stored as J[1][2][1][0] = -1")
+	}
+	if actual := m.Energy([]int{1, 1, 1}); actual != 2.5 {
+		t.Errorf("Energy: expected 2.5, actual %v", actual)
+	}
+	for _, invalid := range []string{"x 0 0 1\n", "h 0 1\n", "J 1 1 0 0 1\n", "h -1 0 1\n", ""} {
+		if _, err := ReadPottsText(strings.NewReader(invalid)); err == nil {
+			t.Errorf("ReadPottsText(%q): expected error", invalid)
+		}
+	}
+}
+
+func TestReadCCMpred(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 2; i++ {
+		for a := 0; a < 20; a++ {
+			fmt.Fprintf(&buf, "%v\t", float64(i)+float64(a)/100)
+		}
+		fmt.Fprintln(&buf)
+	}
+	fmt.Fprintln(&buf, "# 0 1")
+	for a := 0; a < 21; a++ {
+		for b := 0; b < 21; b++ {
+			value := 0.0
+			if a == 0 && b == 1 {
+				value = 3
+			}
+			fmt.Fprintf(&buf, "%v\t", value)
+		}
+		fmt.Fprintln(&buf)
+	}
+	fmt.Fprintln(&buf, "#>META> {}")
+	m, err := ReadCCMpred(&buf)
+	if err != nil {
+		t.Fatalf("ReadCCMpred: unexpected error %v", err)
+	}
+	if len(m.H) != 2 || len(m.H[0]) != 21 || m.H[1][20] != 0 {
+		t.Fatalf("ReadCCMpred: expected 2 sites of 21 characters with a zero gap field")
+	}
+	// A then R
+	if actual := m.Energy([]int{0, 1}); math.Abs(actual-4.01) > 1e-12 {
+		t.Errorf("Energy: expected 4.01, actual %v", actual)
+	}
+}
+
+func TestPottsBinaryRoundTrip(t *testing.T) {
+	s := sampler.NewSampler(1)
+	h := make([][]float64, 4)
+	for i := range h {
+		h[i] = []float64{s.NormFloat64(), s.NormFloat64(), s.NormFloat64()}
+	}
+	m := NewPottsFitness(h, nil)
+	m.SetCoupling(0, 3, [][]float64{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}})
+	m.SetCoupling(2, 1, [][]float64{{0, 0, 1}, {0, 0, 0}, {0, 0, 0}})
+	var buf bytes.Buffer
+	if err := WritePottsBinary(&buf, m); err != nil {
+		t.Fatalf("WritePottsBinary: unexpected error %v", err)
+	}
+	read, err := ReadPottsBinary(&buf)
+	if err != nil {
+		t.Fatalf("ReadPottsBinary: unexpected error %v", err)
+	}
+	for _, seq := range [][]int{{0, 0, 0, 0}, {2, 0, 1, 1}, {1, 2, 0, 2}} {
+		if expected, actual := m.Energy(seq), read.Energy(seq); expected != actual {
+			t.Errorf("Energy(%v): expected %v after round trip, actual %v", seq, expected, actual)
+		}
+	}
+	if _, err := ReadPottsBinary(strings.NewReader("ABCD")); err == nil {
+		t.Errorf("ReadPottsBinary: expected error for a file without the magic number")
+	}
+}
+
+func TestReadPottsBinaryInvalid(t *testing.T) {
+	// pottsFile returns a binary Potts file of zero parameters with the
+	// given coupling pairs.
+	pottsFile := func(numSites, numChars uint32, pairs ...[2]uint32) *bytes.Buffer {
+		var buf bytes.Buffer
+		buf.WriteString(pottsMagic)
+		binary.Write(&buf, binary.LittleEndian, [3]uint32{pottsVersion, numSites, numChars})
+		binary.Write(&buf, binary.LittleEndian, make([]float64, numSites*numChars))
+		binary.Write(&buf, binary.LittleEndian, uint32(len(pairs)))
+		for _, pair := range pairs {
+			binary.Write(&buf, binary.LittleEndian, pair)
+			binary.Write(&buf, binary.LittleEndian, make([]float64, numChars*numChars))
+		}
+		return &buf
+	}
+	if _, err := ReadPottsBinary(pottsFile(2, 2, [2]uint32{0, 1})); err != nil {
+		t.Fatalf("ReadPottsBinary: unexpected error %v", err)
+	}
+	var header bytes.Buffer
+	header.WriteString(pottsMagic)
+	binary.Write(&header, binary.LittleEndian, [3]uint32{pottsVersion, 1 << 30, 1 << 30})
+	if _, err := ReadPottsBinary(&header); err == nil {
+		t.Errorf("ReadPottsBinary: expected error for a model beyond the size limit")
+	}
+	if _, err := ReadPottsBinary(pottsFile(2, 2, [2]uint32{0, 5})); err == nil {
+		t.Errorf("ReadPottsBinary: expected error for a coupling out of range")
+	}
+	if _, err := ReadPottsBinary(pottsFile(2, 2, [2]uint32{0, 1}, [2]uint32{0, 1})); err == nil {
+		t.Errorf("ReadPottsBinary: expected error for a coupling given twice")
+	}
+	if _, err := ReadPottsText(strings.NewReader("h 100000000 0 1")); err == nil {
+		t.Errorf("ReadPottsText: expected error for a model beyond the size limit")
+	}
+}
+
+func TestReadPottsTruncated(t *testing.T) {
+	// A header that claims the largest model allowed, without its data
+	var header bytes.Buffer
+	header.WriteString(pottsMagic)
+	binary.Write(&header, binary.LittleEndian, [3]uint32{pottsVersion, maxPottsSites, maxPottsChars})
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := ReadPottsBinary(&header)
+	runtime.ReadMemStats(&after)
+	if err == nil || !strings.HasPrefix(err.Error(), "mesim: ") {
+		t.Errorf("ReadPottsBinary: expected a mesim error for a truncated file, actual %v", err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("ReadPottsBinary: expected little memory for a truncated file, actual %d bytes", allocated)
+	}
+
+	for _, text := range []string{
+		"h 9223372036854775807 0 1",
+		"J 0 9223372036854775807 0 0 1",
+		"h 0 -1 1",
+		"h 0 100000 1",
+	} {
+		if _, err := ReadPottsText(strings.NewReader(text)); err == nil || !strings.HasPrefix(err.Error(), "mesim: line 1: ") {
+			t.Errorf("ReadPottsText(%q): expected an error on line 1, actual %v", text, err)
+		}
+	}
+	if _, err := ReadCCMpred(strings.NewReader("# 0 100000000\n")); err == nil {
+		t.Errorf("ReadCCMpred: expected error for a site beyond the size limit")
+	}
+}
+
+func TestPottsRemap(t *testing.T) {
+	m := NewPottsFitness([][]float64{{0.1, 0.2, 0.3}, {1, 2, 3}}, nil)
+	m.SetCoupling(0, 1, [][]float64{{0, 0, 0}, {0, 0, 5}, {0, 0, 0}})
+	remapped := m.Remap("-AC", "CA*")
+	expected := [][]float64{{0.3, 0.2, 0}, {3, 2, 0}}
+	for i := range expected {
+		for a := range expected[i] {
+			if remapped.H[i][a] != expected[i][a] {
+				t.Errorf("Remap: expected H[%d][%d] = %v, actual %v", i, a, expected[i][a], remapped.H[i][a])
+			}
+		}
+	}
+	// A at site 0 and C at site 1
+	if actual := remapped.Energy([]int{1, 0}); math.Abs(actual-(0.2+3+5)) > 1e-12 {
+		t.Errorf("Energy: expected %v, actual %v", 0.2+3+5, actual)
+	}
+}
+
+func TestPottsLogFitnessSelection(t *testing.T) {
+	// Energies far beyond the range of exp
+	m := NewPottsFitness([][]float64{{0, 1000}, {0, 1000}}, nil)
+	seqSpace := [][]int{{0, 0}, {1, 0}, {1, 1}}
+	logFitnessSpace := SeqSpaceToLogFitSpaceModel(seqSpace, m, true)
+	if math.Abs(logFitnessSpace[2]) > 1e-9 || logFitnessSpace[0] > -1999 {
+		t.Errorf("SeqSpaceToLogFitSpaceModel: unexpected normalized values %v", logFitnessSpace)
+	}
+	pop := NewPopulation(seqSpace, 2)
+	pop.Sampler = sampler.NewSampler(1)
+	pop.ReplicateSelectModel(10, m)
+	for _, seq := range pop.Sequences {
+		if seq[0] != 1 || seq[1] != 1 {
+			t.Fatalf("ReplicateSelectModel: expected only {1, 1}, actual %v", seq)
+		}
+	}
+}
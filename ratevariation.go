@@ -0,0 +1,98 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"mesim/utils"
+)
+
+// DiscreteGammaRates returns the relative rates of numCategories equally
+// probable categories that approximate a gamma distribution with shape
+// alpha and mean 1. The rate of each category is the mean of the gamma
+// distribution within that category (Yang 1994), so the rates average to
+// exactly 1.
+func DiscreteGammaRates(alpha float64, numCategories int) []float64 {
+	if alpha <= 0 {
+		panic("Shape alpha must be greater than zero")
+	}
+	if numCategories < 1 {
+		panic("Number of categories must be greater than zero")
+	}
+	k := float64(numCategories)
+	rates := make([]float64, numCategories)
+	prevCumP := 0.0
+	for i := range rates {
+		cumP := 1.0
+		if i < numCategories-1 {
+			cutPoint := utils.GammaQuantile(float64(i+1)/k, alpha, alpha)
+			cumP = utils.RegularizedGammaP(alpha+1, cutPoint*alpha)
+		}
+		rates[i] = (cumP - prevCumP) * k
+		prevCumP = cumP
+	}
+	return rates
+}
+
+// GammaSiteRates draws a relative mutation rate for each of numSites sites.
+// Each site is invariant with probability pInvariant, in which case its
+// rate is zero. Otherwise its rate is drawn uniformly from the
+// numCategories discrete gamma rates with shape alpha, scaled by
+// 1 / (1 - pInvariant) so that the expected rate over all sites is 1.
+func GammaSiteRates(s *sampler.Sampler, numSites int, alpha float64, numCategories int, pInvariant float64) []float64 {
+	if pInvariant < 0 || pInvariant >= 1 {
+		panic("Proportion of invariant sites must be in the range [0, 1)")
+	}
+	categoryRates := DiscreteGammaRates(alpha, numCategories)
+	siteRates := make([]float64, numSites)
+	for i := range siteRates {
+		if pInvariant > 0 && s.Float64() < pInvariant {
+			continue
+		}
+		siteRates[i] = categoryRates[s.Intn(numCategories)] / (1 - pInvariant)
+	}
+	return siteRates
+}
+
+// validateSiteRates panics if the site rates do not match the number of
+// sites or if any rate is negative.
+func validateSiteRates(siteRates []float64, numSites int) {
+	if len(siteRates) != numSites {
+		panic("Length of siteRates must be equal to the number of sites")
+	}
+	for _, rate := range siteRates {
+		if rate < 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+			panic("Site rates must be non-negative numbers")
+		}
+	}
+}
+
+// weightedSitesWithoutReplacement picks n distinct sites with probability
+// proportional to their weights. Sites with zero weight are never picked,
+// so at most as many sites as there are non-zero weights are returned.
+func weightedSitesWithoutReplacement(s *sampler.Sampler, weights []float64, n int) []int {
+	remaining := make([]float64, len(weights))
+	copy(remaining, weights)
+	total := utils.Sum(remaining...)
+	var sites []int
+	for len(sites) < n && total > 0 {
+		x := s.Float64() * total
+		picked := -1
+		for i, w := range remaining {
+			if w <= 0 {
+				continue
+			}
+			picked = i
+			if x < w {
+				break
+			}
+			x -= w
+		}
+		if picked < 0 {
+			break
+		}
+		sites = append(sites, picked)
+		total -= remaining[picked]
+		remaining[picked] = 0
+	}
+	return sites
+}
@@ -0,0 +1,75 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"testing"
+)
+
+func TestDiscreteGammaRates(t *testing.T) {
+	// Rates for alpha = 0.5 and 4 categories from Yang (1994)
+	expected := []float64{0.0334, 0.2519, 0.8203, 2.8944}
+	actual := DiscreteGammaRates(0.5, 4)
+	sum := 0.0
+	for i := range expected {
+		if math.Abs(expected[i]-actual[i]) > 1e-4 {
+			t.Errorf("DiscreteGammaRates(0.5, 4): expected %v, actual %v", expected, actual)
+			break
+		}
+		sum += actual[i]
+	}
+	if math.Abs(sum/4-1) > 1e-9 {
+		t.Errorf("DiscreteGammaRates(0.5, 4): expected mean 1, actual %v", sum/4)
+	}
+}
+
+func TestGammaSiteRates(t *testing.T) {
+	s := sampler.NewSampler(1)
+	siteRates := GammaSiteRates(s, 10000, 1.0, 4, 0.3)
+	invariant := 0
+	sum := 0.0
+	for _, rate := range siteRates {
+		if rate == 0 {
+			invariant++
+		}
+		sum += rate
+	}
+	if math.Abs(float64(invariant)/10000-0.3) > 0.02 {
+		t.Errorf("GammaSiteRates(s, 10000, 1.0, 4, 0.3): expected about 30%% invariant sites, actual %v", float64(invariant)/10000)
+	}
+	if math.Abs(sum/10000-1) > 0.05 {
+		t.Errorf("GammaSiteRates(s, 10000, 1.0, 4, 0.3): expected mean rate about 1, actual %v", sum/10000)
+	}
+}
+
+func TestMutateSeqSpaceSiteRates(t *testing.T) {
+	seqSpace := make([][]int, 50)
+	for i := range seqSpace {
+		seqSpace[i] = []int{0, 0, 0, 0, 0, 0}
+	}
+	rateMatrix := [][]float64{
+		[]float64{0.0, 1.0},
+		[]float64{1.0, 0.0},
+	}
+	// Only sites 1 and 4 can mutate
+	siteRates := []float64{0, 3, 0, 0, 3, 0}
+	pop := NewPopulation(seqSpace, 2)
+	pop.Sampler = sampler.NewSampler(3)
+	pop.SetSiteRates(siteRates)
+	pop.Mutate(0.05, rateMatrix)
+
+	mutated := 0
+	for _, seq := range pop.Sequences {
+		for i, char := range seq {
+			if char != 0 {
+				mutated++
+				if siteRates[i] == 0 {
+					t.Errorf("Mutate(0.05, rateMatrix): expected invariant site %d not to mutate", i)
+				}
+			}
+		}
+	}
+	if mutated == 0 {
+		t.Errorf("Mutate(0.05, rateMatrix): expected some mutations at variable sites")
+	}
+}
@@ -2,18 +2,30 @@ package sampler
 
 // BinomialSample
 func BinomialSample(n int, p float64) int {
+	return Default.BinomialSample(n, p)
+}
+
+// BinomialSample draws the number of successes out of n trials with
+// success probability p.
+func (s *Sampler) BinomialSample(n int, p float64) int {
 	pArray := []float64{p, 1 - p}
-	result := generalMultinomial(n, pArray, false)
+	result := s.generalMultinomial(n, pArray, false)
 	return result[0]
 }
 
 // BinomialMutCoords
 func BinomialMutCoords(mu float64, nSites, popSize int) [][]int {
+	return Default.BinomialMutCoords(mu, nSites, popSize)
+}
+
+// BinomialMutCoords draws a Bernoulli trial with probability mu for every
+// site of every individual and returns the coordinates of the successes.
+func (s *Sampler) BinomialMutCoords(mu float64, nSites, popSize int) [][]int {
 	var xArray, yArray, value []int
 	var v int
 	for i := 0; i < popSize; i++ {
 		for j := 0; j < nSites; j++ {
-			v = BinomialSample(1, mu)
+			v = s.BinomialSample(1, mu)
 			if v > 0 {
 				xArray = append(xArray, i)
 				yArray = append(yArray, j)
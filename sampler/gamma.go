@@ -0,0 +1,44 @@
+package sampler
+
+import (
+	"math"
+)
+
+// GammaSample draws a number from a gamma distribution with the given
+// shape and a scale of 1.
+func GammaSample(shape float64) float64 {
+	return Default.GammaSample(shape)
+}
+
+// GammaSample draws a number from a gamma distribution with the given
+// shape and a scale of 1, using the method of Marsaglia and Tsang (2000).
+func (s *Sampler) GammaSample(shape float64) float64 {
+	if shape <= 0 {
+		panic("Shape must be greater than zero")
+	}
+	if shape < 1 {
+		// Boost to shape + 1 and scale back down
+		u := s.Float64()
+		for u == 0 {
+			u = s.Float64()
+		}
+		return s.GammaSample(shape+1) * math.Pow(u, 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := s.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := s.Float64()
+		if u < 1-0.0331*x*x*x*x {
+			return d * v
+		}
+		if u > 0 && math.Log(u) < 0.5*x*x+d*(1-v+math.Log(v)) {
+			return d * v
+		}
+	}
+}
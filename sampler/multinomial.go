@@ -2,50 +2,41 @@ package sampler
 
 import (
 	"math"
-	"math/rand"
+	"mesim/utils"
 )
 
-// BinomialSample
-func BinomialSample(n int, p float64) int {
-	pArray := []float64{p, 1 - p}
-	result := generalMultinomial(n, pArray, false)
-	return result[0]
-}
-
-// BinomialMutCoords
-func BinomialMutCoords(mu float64, nSites, popSize int) [][]int {
-	var xArray, yArray, value []int
-	var v int
-	for i := 0; i < popSize; i++ {
-		for j := 0; j < nSites; j++ {
-			v = BinomialSample(1, mu)
-			if v > 0 {
-				xArray = append(xArray, i)
-				yArray = append(yArray, j)
-				value = append(value, v)
-			}
-
-		}
-	}
-	result := [][]int{xArray, yArray, value}
-	return result
+// MultinomialSample draws a sample from a multinomial distribution.
+func MultinomialSample(n int, p []float64) (result []int) {
+	return Default.MultinomialSample(n, p)
 }
 
 // MultinomialSample draws a sample from a multinomial distribution.
-func MultinomialSample(n int, p []float64) (result []int) {
-	result = generalMultinomial(n, p, false)
+func (s *Sampler) MultinomialSample(n int, p []float64) (result []int) {
+	result = s.generalMultinomial(n, p, false)
 	return result
 }
 
 // MultinomialLogSample draws a sample from a multinomial distribution.
 func MultinomialLogSample(n int, p []float64) (result []int) {
-	result = generalMultinomial(n, p, true)
+	return Default.MultinomialLogSample(n, p)
+}
+
+// MultinomialLogSample draws a sample from a multinomial distribution
+// whose probabilities are given in log space. The log probabilities may be
+// unnormalised; they are normalised with a stable log-sum-exp.
+func (s *Sampler) MultinomialLogSample(n int, p []float64) (result []int) {
+	result = s.generalMultinomial(n, p, true)
 	return result
 }
 
 // MultinomialWhere returns the coordinates equal to the given value
 func MultinomialWhere(n int, p []float64, cnt int) (result []int) {
-	for i, hit := range MultinomialSample(n, p) {
+	return Default.MultinomialWhere(n, p, cnt)
+}
+
+// MultinomialWhere returns the coordinates equal to the given value
+func (s *Sampler) MultinomialWhere(n int, p []float64, cnt int) (result []int) {
+	for i, hit := range s.MultinomialSample(n, p) {
 		if hit == cnt {
 			result = append(result, i)
 		}
@@ -53,32 +44,35 @@ func MultinomialWhere(n int, p []float64, cnt int) (result []int) {
 	return
 }
 
-func generalMultinomial(n int, p []float64, isLogP bool) []int {
+func (s *Sampler) generalMultinomial(n int, p []float64, isLogP bool) []int {
 	trials := 10000
 
 	// If n * len(p) > 1000, uses concurrency
 	if n*len(p) > trials {
+		// Each goroutine draws from its own stream. Streams are split off
+		// in order before any goroutine starts and counts are summed, so
+		// the result does not depend on scheduling.
 		workers := 0
 		resultChan := make(chan []int)
 
 		for n > trials {
-			go func() {
+			go func(ws *Sampler) {
 				if isLogP == true {
-					resultChan <- multinomialLog(trials, p)
+					resultChan <- multinomialLog(ws, trials, p)
 				} else {
-					resultChan <- multinomial(trials, p)
+					resultChan <- multinomial(ws, trials, p)
 				}
-			}()
+			}(s.Split())
 			n -= trials
 			workers++
 		}
-		go func() {
+		go func(ws *Sampler, n int) {
 			if isLogP == true {
-				resultChan <- multinomialLog(n, p)
+				resultChan <- multinomialLog(ws, n, p)
 			} else {
-				resultChan <- multinomial(n, p)
+				resultChan <- multinomial(ws, n, p)
 			}
-		}()
+		}(s.Split(), n)
 		workers++
 
 		result := make([]int, len(p))
@@ -91,14 +85,14 @@ func generalMultinomial(n int, p []float64, isLogP bool) []int {
 		return result
 	}
 	if isLogP == true {
-		return multinomialLog(n, p)
+		return multinomialLog(s, n, p)
 	}
-	return multinomial(n, p)
+	return multinomial(s, n, p)
 
 }
 
 // multinomial is the base function of Multinomial.
-func multinomial(n int, p []float64) []int {
+func multinomial(s *Sampler, n int, p []float64) []int {
 	result := make([]int, len(p))
 	cumP := make([]float64, len(p))
 	lastIdx := len(p) - 1
@@ -111,7 +105,7 @@ func multinomial(n int, p []float64) []int {
 
 	for i := 0; i < n; i++ {
 		// Generate pseudorandom number
-		x := rand.Float64()
+		x := s.Float64()
 
 		// for j; e := range cumP {
 		for j := 0; j < len(cumP); j++ {
@@ -127,32 +121,14 @@ func multinomial(n int, p []float64) []int {
 	return result
 }
 
-func multinomialLog(n int, logP []float64) []int {
-	result := make([]int, len(logP))
-	cumP := make([]float64, len(logP))
-	lastIdx := len(logP) - 1
-
-	// Create a cummulative distribution of p
-	cumP[0] = math.Exp(logP[0])
-	for i := 1; i < len(logP); i++ {
-		cumP[i] = cumP[i-1] + math.Exp(logP[i])
+// multinomialLog is the base function of MultinomialLog. The log
+// probabilities are normalised with log-sum-exp, so they only need to be
+// known up to an additive constant.
+func multinomialLog(s *Sampler, n int, logP []float64) []int {
+	p := make([]float64, len(logP))
+	logSum := utils.LogSumExp(logP...)
+	for i := range logP {
+		p[i] = math.Exp(logP[i] - logSum)
 	}
-
-	// fmt.Println(cumP)
-	for i := 0; i < n; i++ {
-		// Generate pseudorandom number
-		x := rand.Float64()
-
-		// for j; e := range cumP {
-		for j := 0; j < len(cumP); j++ {
-			if x < cumP[j] {
-				result[j]++
-				break
-			} else if x > cumP[lastIdx] && x <= 1.0 {
-				result[lastIdx]++
-				break
-			}
-		}
-	}
-	return result
+	return multinomial(s, n, p)
 }
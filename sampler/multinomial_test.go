@@ -2,7 +2,6 @@ package sampler
 
 import (
 	"math"
-	"math/rand"
 	"testing"
 )
 
@@ -12,10 +11,10 @@ func TestMultinomial(t *testing.T) {
 	times := 10000
 	samples := make([][]int, times)
 	seed := 0
-	rand.Seed(int64(seed))
+	s := NewSampler(int64(seed))
 
 	for i := 0; i < times; i++ {
-		samples[i] = MultinomialSample(n, p)
+		samples[i] = s.MultinomialSample(n, p)
 	}
 
 	// Average
@@ -58,10 +57,10 @@ func TestMultinomialLog(t *testing.T) {
 	times := 10000
 	samples := make([][]int, times)
 	seed := 0
-	rand.Seed(int64(seed))
+	s := NewSampler(int64(seed))
 
 	for i := 0; i < times; i++ {
-		samples[i] = MultinomialLogSample(n, logP)
+		samples[i] = s.MultinomialLogSample(n, logP)
 	}
 
 	// Average
@@ -2,7 +2,6 @@ package sampler
 
 import (
 	"math"
-	"math/rand"
 	utils "mesim/utils"
 )
 
@@ -10,33 +9,43 @@ import (
 // returns a 2-d array of Poisson random variables
 // whose rows represent individuals and columns represent sites.
 func PoissonMutArray(mu float64, nSites, popSize int) (result [][]int) {
-	tmp := make([]int, nSites*popSize)
+	return Default.PoissonMutArray(mu, nSites, popSize)
+}
+
+// PoissonMutArray samples from a Poisson distribution and
+// returns a 2-d array of Poisson random variables
+// whose rows represent individuals and columns represent sites.
+func (s *Sampler) PoissonMutArray(mu float64, nSites, popSize int) (result [][]int) {
+	var tmp []int
 	n := nSites * popSize
 	blockSize := int(1e6) //TODO : Optimize block size
-
 	if n > blockSize {
-		workers := 0
-		resultChan := make(chan []int)
-
-		for n > blockSize {
-			go func() {
-				resultChan <- poissonMutArray(mu, 1e5)
-			}()
-			n -= blockSize
-			workers++
+		// Each block is filled by its own goroutine using a stream split
+		// off in block order. Blocks are concatenated in the same order so
+		// that the result does not depend on scheduling.
+		numBlocks := (n + blockSize - 1) / blockSize
+		blocks := make([][]int, numBlocks)
+		done := make(chan bool)
+		for b := 0; b < numBlocks; b++ {
+			size := blockSize
+			if b == numBlocks-1 {
+				size = n - b*blockSize
+			}
+			go func(ws *Sampler, b, size int) {
+				blocks[b] = poissonMutArray(ws, mu, size)
+				done <- true
+			}(s.Split(), b, size)
 		}
-		go func() {
-			resultChan <- poissonMutArray(mu, n)
-		}()
-		workers++
-
-		for i := 0; i < workers; i++ {
-			tmp = append(tmp, <-resultChan...)
+		for b := 0; b < numBlocks; b++ {
+			<-done
+		}
+		tmp = make([]int, 0, n)
+		for _, block := range blocks {
+			tmp = append(tmp, block...)
 		}
 	} else {
-		tmp = poissonMutArray(mu, nSites*popSize)
+		tmp = poissonMutArray(s, mu, n)
 	}
-
 	for i := 0; i < n; i += nSites {
 		result = append(result, tmp[i:i+nSites])
 	}
@@ -46,11 +55,10 @@ func PoissonMutArray(mu float64, nSites, popSize int) (result [][]int) {
 // poissonMutArray is the base function of PoissonMutArray.
 // It calls the PoissonSampler function to generate a set of Poisson
 // random variables.
-func poissonMutArray(mu float64, n int) []int {
+func poissonMutArray(s *Sampler, mu float64, n int) []int {
 	result := make([]int, n)
-
 	for i := 0; i < n; i++ {
-		result[i] = PoissonSample(mu)
+		result[i] = s.PoissonSample(mu)
 	}
 	return result
 }
@@ -58,7 +66,6 @@ func poissonMutArray(mu float64, n int) []int {
 //PoissonMutCoords
 func PoissonMutCoordsFromArray(arr [][]int) [][]int {
 	var xArray, yArray, value []int
-
 	for m, col := range arr {
 		for n, v := range col {
 			if v > 0 {
@@ -74,11 +81,18 @@ func PoissonMutCoordsFromArray(arr [][]int) [][]int {
 
 //PoissonMutCoords
 func PoissonMutCoords(mu float64, nSites, popSize int) [][]int {
+	return Default.PoissonMutCoords(mu, nSites, popSize)
+}
+
+// PoissonMutCoords draws a Poisson number of hits with mean mu for every
+// site of every individual and returns the coordinates with at least one
+// hit.
+func (s *Sampler) PoissonMutCoords(mu float64, nSites, popSize int) [][]int {
 	var xArray, yArray, value []int
 	n := nSites * popSize
 	var v int
 	for i := 0; i < n; i++ {
-		v = PoissonSample(mu)
+		v = s.PoissonSample(mu)
 		if v > 0 {
 			var q, r = utils.DivMod(i, nSites)
 			xArray = append(xArray, q)
@@ -93,12 +107,18 @@ func PoissonMutCoords(mu float64, nSites, popSize int) [][]int {
 // PoissonSample return a pseudorandom sample from a Poisson
 // distribution of lambda using the Knuth algorithm.
 func PoissonSample(lambda float64) int {
+	return Default.PoissonSample(lambda)
+}
+
+// PoissonSample return a pseudorandom sample from a Poisson
+// distribution of lambda using the Knuth algorithm.
+func (s *Sampler) PoissonSample(lambda float64) int {
 	L := math.Exp(-1 * lambda)
 	k := 0
 	p := 1.
 	for p > L {
 		k++
-		p *= rand.Float64()
+		p *= s.Float64()
 	}
 	return int(k - 1)
 }
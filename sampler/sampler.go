@@ -0,0 +1,106 @@
+package sampler
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+)
+
+// Sampler is a source of pseudorandom numbers for the sampling functions of
+// this package. A Sampler is not safe for concurrent use; functions that
+// sample in parallel derive an independent Sampler for each goroutine using
+// Split so that results only depend on the root seed.
+type Sampler struct {
+	rng *rand.Rand
+}
+
+// Default is the Sampler used by the package-level sampling functions.
+// It draws from the global math/rand state, so it is seeded by rand.Seed.
+var Default = NewSamplerFromSource(globalSource{})
+
+// NewSampler returns a new Sampler seeded with the given value.
+func NewSampler(seed int64) *Sampler {
+	return NewSamplerFromSource(rand.NewSource(seed))
+}
+
+// NewSamplerFromSource returns a new Sampler that draws from the given
+// source.
+func NewSamplerFromSource(src rand.Source) *Sampler {
+	return &Sampler{rng: rand.New(src)}
+}
+
+// Split derives a new, independent Sampler from s. The seed of the new
+// Sampler is drawn from s, so the sequence of Samplers returned by
+// successive calls to Split is fully determined by the seed of s.
+func (s *Sampler) Split() *Sampler {
+	return NewSampler(int64(splitMix64(s.rng.Uint64())))
+}
+
+// Float64 returns a pseudorandom number in [0.0, 1.0).
+func (s *Sampler) Float64() float64 {
+	return s.rng.Float64()
+}
+
+// Intn returns a pseudorandom number in [0, n).
+func (s *Sampler) Intn(n int) int {
+	return s.rng.Intn(n)
+}
+
+// Perm returns a pseudorandom permutation of the integers [0, n).
+func (s *Sampler) Perm(n int) []int {
+	return s.rng.Perm(n)
+}
+
+// NormFloat64 returns a normally distributed number with mean 0 and
+// standard deviation 1.
+func (s *Sampler) NormFloat64() float64 {
+	return s.rng.NormFloat64()
+}
+
+// ExpFloat64 returns an exponentially distributed number with rate 1.
+func (s *Sampler) ExpFloat64() float64 {
+	return s.rng.ExpFloat64()
+}
+
+// Uint64 returns a pseudorandom 64-bit value.
+func (s *Sampler) Uint64() uint64 {
+	return s.rng.Uint64()
+}
+
+// HashNormFloat64 returns a normally distributed number with mean 0 and
+// standard deviation 1 that is fully determined by seed and key. Unlike
+// draws from a Sampler, it does not depend on the order of the calls.
+func HashNormFloat64(seed uint64, key []byte) float64 {
+	h := fnv.New64a()
+	h.Write(key)
+	x := splitMix64(seed ^ h.Sum64())
+	y := splitMix64(x)
+	// Box-Muller transform of two uniform numbers in (0, 1)
+	u1 := (float64(x>>11) + 0.5) / (1 << 53)
+	u2 := (float64(y>>11) + 0.5) / (1 << 53)
+	return math.Sqrt(-2*math.Log(u1)) * math.Cos(2*math.Pi*u2)
+}
+
+// splitMix64 scrambles x using the SplitMix64 finalizer so that seeds
+// derived from consecutive draws are well separated.
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// globalSource is a rand.Source backed by the global math/rand functions.
+type globalSource struct{}
+
+func (globalSource) Int63() int64 {
+	return rand.Int63()
+}
+
+func (globalSource) Uint64() uint64 {
+	return rand.Uint64()
+}
+
+func (globalSource) Seed(seed int64) {
+	rand.Seed(seed)
+}
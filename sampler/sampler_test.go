@@ -0,0 +1,105 @@
+package sampler
+
+import (
+	"math"
+	"runtime"
+	"testing"
+)
+
+func TestSamplerReproducible(t *testing.T) {
+	n := 100000 // Large enough to sample in parallel
+	p := []float64{0.4, 0.3, 0.2, 0.1}
+
+	prevProcs := runtime.GOMAXPROCS(1)
+	expected := NewSampler(42).MultinomialSample(n, p)
+	runtime.GOMAXPROCS(4)
+	actual := NewSampler(42).MultinomialSample(n, p)
+	runtime.GOMAXPROCS(prevProcs)
+
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Errorf("MultinomialSample(%d, %v): expected %v with the same seed, actual %v", n, p, expected, actual)
+			break
+		}
+	}
+}
+
+func TestSamplerPoissonMutArrayReproducible(t *testing.T) {
+	nSites, popSize := 1000, 1500 // Large enough to sample in parallel
+	mu := 0.01
+
+	expected := NewSampler(7).PoissonMutArray(mu, nSites, popSize)
+	actual := NewSampler(7).PoissonMutArray(mu, nSites, popSize)
+
+	if len(actual) != popSize || len(actual[0]) != nSites {
+		t.Fatalf("PoissonMutArray(%v, %d, %d): expected %dx%d array, actual %dx%d", mu, nSites, popSize, popSize, nSites, len(actual), len(actual[0]))
+	}
+	for i := range expected {
+		for j := range expected[i] {
+			if expected[i][j] != actual[i][j] {
+				t.Fatalf("PoissonMutArray(%v, %d, %d): expected same array with the same seed", mu, nSites, popSize)
+			}
+		}
+	}
+}
+
+func TestSamplerSplit(t *testing.T) {
+	s1 := NewSampler(1)
+	s2 := NewSampler(1)
+	a, b := s1.Split(), s2.Split()
+	for i := 0; i < 10; i++ {
+		if a.Float64() != b.Float64() {
+			t.Fatalf("Split(): expected identical streams from identical parents")
+		}
+	}
+	c := s1.Split()
+	same := true
+	for i := 0; i < 10; i++ {
+		if a.Float64() != c.Float64() {
+			same = false
+		}
+	}
+	if same {
+		t.Errorf("Split(): expected successive splits to produce different streams")
+	}
+}
+
+func TestGammaSample(t *testing.T) {
+	s := NewSampler(1)
+	for _, shape := range []float64{0.3, 1, 4.5} {
+		n := 100000
+		sum, sumSq := 0.0, 0.0
+		for i := 0; i < n; i++ {
+			x := s.GammaSample(shape)
+			if x < 0 {
+				t.Fatalf("GammaSample(%v): expected non-negative value, actual %v", shape, x)
+			}
+			sum += x
+			sumSq += x * x
+		}
+		mean := sum / float64(n)
+		variance := sumSq/float64(n) - mean*mean
+		// Mean and variance of Gamma(shape, 1) are both equal to shape
+		if math.Abs(mean-shape) > 0.05*shape || math.Abs(variance-shape) > 0.1*shape {
+			t.Errorf("GammaSample(%v): expected mean and variance %v, actual %v and %v", shape, shape, mean, variance)
+		}
+	}
+}
+
+func TestHashNormFloat64(t *testing.T) {
+	if HashNormFloat64(1, []byte{1, 2}) != HashNormFloat64(1, []byte{1, 2}) {
+		t.Errorf("HashNormFloat64: expected the same value for the same seed and key")
+	}
+	n := 100000
+	sum, sumSq := 0.0, 0.0
+	for i := 0; i < n; i++ {
+		x := HashNormFloat64(3, []byte{byte(i), byte(i >> 8), byte(i >> 16)})
+		sum += x
+		sumSq += x * x
+	}
+	mean := sum / float64(n)
+	variance := sumSq/float64(n) - mean*mean
+	if math.Abs(mean) > 0.02 || math.Abs(variance-1) > 0.03 {
+		t.Errorf("HashNormFloat64: expected mean 0 and variance 1, actual %v and %v", mean, variance)
+	}
+}
@@ -0,0 +1,163 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"sort"
+)
+
+// Selector decides how many offspring every individual contributes to the
+// next generation. Select receives the log fitness of every individual and
+// returns their offspring counts, which must sum to nextPopSize.
+type Selector interface {
+	Select(s *sampler.Sampler, logFitness []float64, nextPopSize int) []int
+}
+
+// WrightFisherSelector samples offspring in proportion to fitness, as
+// ReplicateSelect does.
+type WrightFisherSelector struct{}
+
+// Select implements Selector.
+func (WrightFisherSelector) Select(s *sampler.Sampler, logFitness []float64, nextPopSize int) []int {
+	return s.MultinomialLogSample(nextPopSize, logFitness)
+}
+
+// TruncationSelector lets only the fittest Fraction of the population
+// reproduce, each of them with equal probability. At least one individual
+// is always kept, and ties at the threshold are broken at random.
+type TruncationSelector struct {
+	Fraction float64
+}
+
+// NewTruncationSelector creates a truncation selector that keeps the given
+// fraction of the population.
+func NewTruncationSelector(fraction float64) *TruncationSelector {
+	if fraction <= 0 || fraction > 1 {
+		panic("Fraction must be in the range (0, 1]")
+	}
+	return &TruncationSelector{Fraction: fraction}
+}
+
+// Select implements Selector.
+func (sel *TruncationSelector) Select(s *sampler.Sampler, logFitness []float64, nextPopSize int) []int {
+	numKept := int(math.Ceil(sel.Fraction * float64(len(logFitness))))
+	if numKept < 1 {
+		numKept = 1
+	}
+	ranked := rankByFitness(s, logFitness)
+	kept := ranked[len(ranked)-numKept:]
+	p := make([]float64, numKept)
+	for k := range p {
+		p[k] = 1 / float64(numKept)
+	}
+	counts := make([]int, len(logFitness))
+	for k, cnt := range s.MultinomialSample(nextPopSize, p) {
+		counts[kept[k]] = cnt
+	}
+	return counts
+}
+
+// TournamentSelector picks the parent of every offspring by drawing Size
+// individuals at random, with replacement, and taking the fittest of them.
+// Larger tournaments select more strongly.
+type TournamentSelector struct {
+	Size int
+}
+
+// NewTournamentSelector creates a tournament selector with tournaments of
+// the given size.
+func NewTournamentSelector(size int) *TournamentSelector {
+	if size < 1 {
+		panic("Tournament size must be greater than zero")
+	}
+	return &TournamentSelector{Size: size}
+}
+
+// Select implements Selector.
+func (sel *TournamentSelector) Select(s *sampler.Sampler, logFitness []float64, nextPopSize int) []int {
+	counts := make([]int, len(logFitness))
+	for k := 0; k < nextPopSize; k++ {
+		winner := s.Intn(len(logFitness))
+		for j := 1; j < sel.Size; j++ {
+			challenger := s.Intn(len(logFitness))
+			if logFitness[challenger] > logFitness[winner] {
+				winner = challenger
+			}
+		}
+		counts[winner]++
+	}
+	return counts
+}
+
+// RankSelector samples offspring with linear ranking. The probability of
+// being a parent depends only on the fitness rank: the fittest individual
+// is chosen Pressure times as often as average, and the least fit
+// 2 - Pressure times as often. Pressure must be in [1, 2]; a pressure of 1
+// means no selection. Ties are broken at random.
+type RankSelector struct {
+	Pressure float64
+}
+
+// NewRankSelector creates a linear rank selector with the given selective
+// pressure.
+func NewRankSelector(pressure float64) *RankSelector {
+	if pressure < 1 || pressure > 2 {
+		panic("Selective pressure must be in the range [1, 2]")
+	}
+	return &RankSelector{Pressure: pressure}
+}
+
+// Select implements Selector.
+func (sel *RankSelector) Select(s *sampler.Sampler, logFitness []float64, nextPopSize int) []int {
+	n := len(logFitness)
+	ranked := rankByFitness(s, logFitness)
+	p := make([]float64, n)
+	for rank, i := range ranked {
+		if n == 1 {
+			p[i] = 1
+			break
+		}
+		p[i] = (2 - sel.Pressure + 2*(sel.Pressure-1)*float64(rank)/float64(n-1)) / float64(n)
+	}
+	return s.MultinomialSample(nextPopSize, p)
+}
+
+// FecunditySelector is a Cannings-type offspring model in which every
+// individual has a random fecundity on top of its fitness. Fecundities
+// are drawn each generation from a gamma distribution with the given
+// Shape and a mean of one, and offspring are sampled in proportion to
+// fitness times fecundity. The smaller the shape, the larger the variance
+// in offspring number, down to sweepstakes reproduction where a few
+// individuals leave most offspring; as the shape grows the model
+// approaches Wright-Fisher sampling.
+type FecunditySelector struct {
+	Shape float64
+}
+
+// NewFecunditySelector creates a fecundity variance selector with the given
+// gamma shape.
+func NewFecunditySelector(shape float64) *FecunditySelector {
+	if shape <= 0 {
+		panic("Shape must be greater than zero")
+	}
+	return &FecunditySelector{Shape: shape}
+}
+
+// Select implements Selector.
+func (sel *FecunditySelector) Select(s *sampler.Sampler, logFitness []float64, nextPopSize int) []int {
+	logWeights := make([]float64, len(logFitness))
+	for i, f := range logFitness {
+		logWeights[i] = f + math.Log(s.GammaSample(sel.Shape)/sel.Shape)
+	}
+	return s.MultinomialLogSample(nextPopSize, logWeights)
+}
+
+// rankByFitness returns the indices of the individuals from least to most
+// fit, breaking ties at random.
+func rankByFitness(s *sampler.Sampler, logFitness []float64) []int {
+	ranked := s.Perm(len(logFitness))
+	sort.SliceStable(ranked, func(a, b int) bool {
+		return logFitness[ranked[a]] < logFitness[ranked[b]]
+	})
+	return ranked
+}
@@ -0,0 +1,113 @@
+package mesim
+
+import (
+	"math"
+	"mesim/sampler"
+	"testing"
+)
+
+// testLogFitness returns the log fitness 0, 1, ..., n-1.
+func testLogFitness(n int) []float64 {
+	logFitness := make([]float64, n)
+	for i := range logFitness {
+		logFitness[i] = float64(i)
+	}
+	return logFitness
+}
+
+func sumCounts(counts []int) int {
+	total := 0
+	for _, cnt := range counts {
+		total += cnt
+	}
+	return total
+}
+
+func TestTruncationSelector(t *testing.T) {
+	s := sampler.NewSampler(1)
+	counts := NewTruncationSelector(0.3).Select(s, testLogFitness(10), 100)
+	if total := sumCounts(counts); total != 100 {
+		t.Fatalf("TruncationSelector: expected 100 offspring, actual %d", total)
+	}
+	for i, cnt := range counts {
+		if i < 7 && cnt != 0 {
+			t.Errorf("TruncationSelector: expected no offspring from individual %d below the threshold, actual %d", i, cnt)
+		}
+		if i >= 7 && cnt == 0 {
+			t.Errorf("TruncationSelector: expected offspring from individual %d above the threshold", i)
+		}
+	}
+}
+
+func TestTournamentSelector(t *testing.T) {
+	s := sampler.NewSampler(1)
+	logFitness := testLogFitness(10)
+	counts := NewTournamentSelector(1).Select(s, logFitness, 10000)
+	if total := sumCounts(counts); total != 10000 {
+		t.Fatalf("TournamentSelector: expected 10000 offspring, actual %d", total)
+	}
+	// Tournaments of size 1 are neutral
+	for i, cnt := range counts {
+		if math.Abs(float64(cnt)-1000) > 150 {
+			t.Errorf("TournamentSelector(1): expected about 1000 offspring from individual %d, actual %d", i, cnt)
+		}
+	}
+	// The winner of a tournament of 3 is the fittest with probability
+	// 1 - 0.9^3
+	counts = NewTournamentSelector(3).Select(s, logFitness, 10000)
+	expected := 10000 * (1 - math.Pow(0.9, 3))
+	if math.Abs(float64(counts[9])-expected) > 150 {
+		t.Errorf("TournamentSelector(3): expected about %v offspring from the fittest, actual %d", expected, counts[9])
+	}
+	if counts[0] > 50 {
+		t.Errorf("TournamentSelector(3): expected few offspring from the least fit, actual %d", counts[0])
+	}
+}
+
+func TestRankSelector(t *testing.T) {
+	s := sampler.NewSampler(1)
+	// Rank only depends on order, not on the size of fitness differences
+	logFitness := []float64{-1000, 0, 1000}
+	counts := NewRankSelector(2).Select(s, logFitness, 30000)
+	expected := []float64{0, 10000, 20000}
+	for i := range expected {
+		if math.Abs(float64(counts[i])-expected[i]) > 300 {
+			t.Errorf("RankSelector(2): expected about %v offspring from individual %d, actual %d", expected[i], i, counts[i])
+		}
+	}
+}
+
+func TestFecunditySelector(t *testing.T) {
+	s := sampler.NewSampler(1)
+	logFitness := make([]float64, 100)
+	variance := func(sel Selector) float64 {
+		sum, sumSq := 0.0, 0.0
+		for rep := 0; rep < 20; rep++ {
+			for _, cnt := range sel.Select(s, logFitness, 100) {
+				sum += float64(cnt)
+				sumSq += float64(cnt * cnt)
+			}
+		}
+		mean := sum / 2000
+		return sumSq/2000 - mean*mean
+	}
+	// Offspring variance is about 1 under Wright-Fisher sampling and
+	// 1 + 1/shape with gamma distributed fecundity
+	wfVariance := variance(WrightFisherSelector{})
+	fecundityVariance := variance(NewFecunditySelector(0.25))
+	if wfVariance > 1.3 {
+		t.Errorf("WrightFisherSelector: expected offspring variance about 1, actual %v", wfVariance)
+	}
+	if fecundityVariance < 3 {
+		t.Errorf("FecunditySelector(0.25): expected offspring variance about 5, actual %v", fecundityVariance)
+	}
+}
+
+func TestSimulationSelector(t *testing.T) {
+	sim := newTestSimulation(1)
+	sim.Selector = NewTruncationSelector(0.25)
+	sim.Run()
+	if f := sim.Population.AlleleFrequency(0, 1); f != 1 {
+		t.Errorf("Simulation with truncation selection: expected the fittest allele to be fixed, actual frequency %v", f)
+	}
+}
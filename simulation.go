@@ -0,0 +1,251 @@
+package mesim
+
+import (
+	"time"
+)
+
+// StopReason describes why a simulation stopped.
+type StopReason int
+
+const (
+	// StopGenerationLimit means that the simulation ran for the maximum
+	// number of generations.
+	StopGenerationLimit StopReason = iota
+	// StopFixation means that an allele became fixed at a site.
+	StopFixation
+	// StopLoss means that an allele was lost at a site.
+	StopLoss
+	// StopFitnessThreshold means that the mean fitness crossed a threshold.
+	StopFitnessThreshold
+	// StopExtinction means that the population size dropped to zero.
+	StopExtinction
+	// StopTimeLimit means that the wall-clock time limit was reached.
+	StopTimeLimit
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopGenerationLimit:
+		return "generation limit"
+	case StopFixation:
+		return "fixation"
+	case StopLoss:
+		return "loss"
+	case StopFitnessThreshold:
+		return "fitness threshold"
+	case StopExtinction:
+		return "extinction"
+	case StopTimeLimit:
+		return "time limit"
+	}
+	return "unknown"
+}
+
+// StopCondition decides whether a simulation should stop. It is checked
+// at the end of every generation.
+type StopCondition interface {
+	Stop(sim *Simulation) (StopReason, bool)
+}
+
+// Simulation runs a population forward in time for a number of
+// generations of selection, mutation and recombination.
+//
+// If Demography is nil, the population is kept at its initial size.
+// If ContextMutation is not nil, substitutions follow the context model
+// instead of MutationRate and RateMatrix.
+// If FitnessModel is not nil, it is used to evaluate fitness instead of
+// FitnessMatrix and FitnessFunc. If LogFitness is true, FitnessFunc
+// returns log fitness and selection is carried out in log space.
+// If Selector is not nil, it decides the offspring numbers instead of
+// fitness-proportional sampling.
+// If Engine is nil, generations are discrete and non-overlapping as in
+// WrightFisherEngine.
+// If Indels is not nil, insertions and deletions are applied right after
+// substitutions and the true alignment of the population is tracked.
+// A MaxGenerations of zero means that the simulation runs until one of
+// the stop conditions is met.
+type Simulation struct {
+	Population        *Population
+	Demography        Demography
+	MutationRate      float64
+	RecombinationRate float64
+	RateMatrix        [][]float64
+	ContextMutation   *ContextModel
+	Indels            *IndelModel
+	FitnessMatrix     [][]float64
+	FitnessFunc       FitnessFunc
+	FitnessModel      FitnessModel
+	LogFitness        bool
+	Selector          Selector
+	Engine            Engine
+	MaxGenerations    int
+	StopConditions    []StopCondition
+	Observers         []Observer
+
+	// Generation is the current generation of the population.
+	Generation int
+
+	startTime time.Time
+}
+
+// SimulationResult describes the outcome of a simulation run.
+type SimulationResult struct {
+	// Generation is the generation at which the simulation stopped.
+	Generation int
+	Reason     StopReason
+	// Condition is the stop condition that ended the run, or nil if the
+	// run ended because of the generation limit or extinction.
+	Condition StopCondition
+	Elapsed   time.Duration
+}
+
+// NewSimulation creates a simulation of the given population with a
+// constant population size and no stop conditions other than the
+// generation limit.
+func NewSimulation(pop *Population, maxGenerations int, mutationRate float64, recombinationRate float64, rateMatrix [][]float64, fitnessMatrix [][]float64, fitnessFunc FitnessFunc) *Simulation {
+	return &Simulation{
+		Population:        pop,
+		MutationRate:      mutationRate,
+		RecombinationRate: recombinationRate,
+		RateMatrix:        rateMatrix,
+		FitnessMatrix:     fitnessMatrix,
+		FitnessFunc:       fitnessFunc,
+		MaxGenerations:    maxGenerations,
+	}
+}
+
+// AddStopCondition adds a condition that ends the simulation early.
+func (sim *Simulation) AddStopCondition(cond StopCondition) {
+	sim.StopConditions = append(sim.StopConditions, cond)
+}
+
+// AddObserver adds an observer that is notified at every stage of every
+// generation.
+func (sim *Simulation) AddObserver(obs Observer) {
+	sim.Observers = append(sim.Observers, obs)
+}
+
+// Elapsed returns the wall-clock time since the current run started.
+func (sim *Simulation) Elapsed() time.Duration {
+	return time.Since(sim.startTime)
+}
+
+// Run advances the population until the generation limit is reached, the
+// population goes extinct, or one of the stop conditions is met.
+// Calling Run again continues from the current generation.
+func (sim *Simulation) Run() *SimulationResult {
+	if sim.MaxGenerations <= 0 && len(sim.StopConditions) == 0 {
+		panic("Simulation must have a generation limit or a stop condition")
+	}
+	if sim.Demography == nil {
+		sim.Demography = NewConstantDemography(sim.Population.Size())
+	}
+	sim.startTime = time.Now()
+
+	result := &SimulationResult{}
+	for {
+		if sim.Population.Size() == 0 {
+			result.Reason = StopExtinction
+			break
+		}
+		if sim.MaxGenerations > 0 && sim.Generation >= sim.MaxGenerations {
+			result.Reason = StopGenerationLimit
+			break
+		}
+		sim.Step()
+		if sim.Population.Size() == 0 {
+			result.Reason = StopExtinction
+			break
+		}
+		if cond, reason, ok := sim.checkStopConditions(); ok {
+			result.Reason = reason
+			result.Condition = cond
+			break
+		}
+	}
+	result.Generation = sim.Generation
+	result.Elapsed = sim.Elapsed()
+	return result
+}
+
+// Step advances the population by exactly one generation with the engine
+// of the simulation.
+func (sim *Simulation) Step() {
+	engine := sim.Engine
+	if engine == nil {
+		engine = WrightFisherEngine{}
+	}
+	engine.Advance(sim, sim.Generation+1)
+	sim.Generation++
+}
+
+// fitnessModel returns the fitness model of the simulation.
+func (sim *Simulation) fitnessModel() FitnessModel {
+	if sim.FitnessModel != nil {
+		return sim.FitnessModel
+	}
+	if sim.LogFitness {
+		return LogMatrixFitness{Matrix: sim.FitnessMatrix, Func: sim.FitnessFunc}
+	}
+	return MatrixFitness{Matrix: sim.FitnessMatrix, Func: sim.FitnessFunc}
+}
+
+func (sim *Simulation) checkStopConditions() (StopCondition, StopReason, bool) {
+	for _, cond := range sim.StopConditions {
+		if reason, ok := cond.Stop(sim); ok {
+			return cond, reason, true
+		}
+	}
+	return nil, 0, false
+}
+
+// FixationCondition stops a simulation when Char is fixed at Site.
+type FixationCondition struct {
+	Site int
+	Char int
+}
+
+// Stop implements StopCondition.
+func (c FixationCondition) Stop(sim *Simulation) (StopReason, bool) {
+	return StopFixation, sim.Population.AlleleFrequency(c.Site, c.Char) == 1
+}
+
+// LossCondition stops a simulation when Char is lost at Site.
+type LossCondition struct {
+	Site int
+	Char int
+}
+
+// Stop implements StopCondition.
+func (c LossCondition) Stop(sim *Simulation) (StopReason, bool) {
+	return StopLoss, sim.Population.AlleleFrequency(c.Site, c.Char) == 0
+}
+
+// FitnessThresholdCondition stops a simulation when the mean fitness of
+// the population rises to or above Threshold. If Below is true, the
+// simulation stops when the mean fitness drops to or below Threshold
+// instead.
+type FitnessThresholdCondition struct {
+	Threshold float64
+	Below     bool
+}
+
+// Stop implements StopCondition.
+func (c FitnessThresholdCondition) Stop(sim *Simulation) (StopReason, bool) {
+	meanFitness := sim.Population.MeanModelFitness(sim.fitnessModel())
+	if c.Below {
+		return StopFitnessThreshold, meanFitness <= c.Threshold
+	}
+	return StopFitnessThreshold, meanFitness >= c.Threshold
+}
+
+// TimeLimitCondition stops a simulation once the wall-clock time of the
+// current run exceeds Limit.
+type TimeLimitCondition struct {
+	Limit time.Duration
+}
+
+// Stop implements StopCondition.
+func (c TimeLimitCondition) Stop(sim *Simulation) (StopReason, bool) {
+	return StopTimeLimit, sim.Elapsed() >= c.Limit
+}
@@ -0,0 +1,83 @@
+package mesim
+
+import (
+	"mesim/sampler"
+	"testing"
+	"time"
+)
+
+func newTestSimulation(maxGenerations int) *Simulation {
+	seqSpace := [][]int{
+		[]int{0, 0, 0, 0},
+		[]int{0, 0, 0, 0},
+		[]int{0, 0, 0, 0},
+		[]int{1, 0, 0, 0},
+	}
+	rateMatrix := [][]float64{
+		[]float64{0.0, 1.0},
+		[]float64{1.0, 0.0},
+	}
+	fitnessMatrix := [][]float64{
+		[]float64{1.0, 10.0}, // Strongly favours 1 at pos 0
+		[]float64{1.0, 1.0},
+		[]float64{1.0, 1.0},
+		[]float64{1.0, 1.0},
+	}
+	fitnessFunc := func(seq []int, fitnessMatrix [][]float64) (multSum float64) {
+		multSum = float64(1)
+		for i, char := range seq {
+			multSum *= float64(fitnessMatrix[i][char])
+		}
+		return
+	}
+	pop := NewPopulation(seqSpace, 2)
+	pop.Sampler = sampler.NewSampler(1)
+	return NewSimulation(pop, maxGenerations, 0, 0, rateMatrix, fitnessMatrix, fitnessFunc)
+}
+
+func TestSimulationGenerationLimit(t *testing.T) {
+	sim := newTestSimulation(5)
+	result := sim.Run()
+	if result.Reason != StopGenerationLimit || result.Generation != 5 {
+		t.Errorf("Run(): expected to stop at generation 5 due to %v, actual generation %d due to %v", StopGenerationLimit, result.Generation, result.Reason)
+	}
+}
+
+func TestSimulationFixation(t *testing.T) {
+	sim := newTestSimulation(1000)
+	sim.AddStopCondition(FixationCondition{Site: 0, Char: 1})
+	result := sim.Run()
+	if result.Reason != StopFixation || result.Condition == nil {
+		t.Errorf("Run(): expected to stop due to %v, actual %v", StopFixation, result.Reason)
+	}
+	if sim.Population.AlleleFrequency(0, 1) != 1 {
+		t.Errorf("Run(): expected allele 1 at site 0 to be fixed, actual frequency %v", sim.Population.AlleleFrequency(0, 1))
+	}
+}
+
+func TestSimulationFitnessThreshold(t *testing.T) {
+	sim := newTestSimulation(1000)
+	sim.AddStopCondition(FitnessThresholdCondition{Threshold: 5.0})
+	result := sim.Run()
+	if result.Reason != StopFitnessThreshold {
+		t.Errorf("Run(): expected to stop due to %v, actual %v", StopFitnessThreshold, result.Reason)
+	}
+}
+
+func TestSimulationExtinction(t *testing.T) {
+	sim := newTestSimulation(100)
+	sim.Demography = NewStepDemography(4, []int{3}, []int{0})
+	result := sim.Run()
+	if result.Reason != StopExtinction || result.Generation != 3 {
+		t.Errorf("Run(): expected to stop at generation 3 due to %v, actual generation %d due to %v", StopExtinction, result.Generation, result.Reason)
+	}
+}
+
+func TestSimulationTimeLimit(t *testing.T) {
+	sim := newTestSimulation(0)
+	sim.AddStopCondition(TimeLimitCondition{Limit: 10 * time.Millisecond})
+	result := sim.Run()
+	if result.Reason != StopTimeLimit || result.Elapsed < 10*time.Millisecond {
+		t.Errorf("Run(): expected to stop after 10ms due to %v, actual %v due to %v", StopTimeLimit, result.Elapsed, result.Reason)
+	}
+}
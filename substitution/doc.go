@@ -0,0 +1,8 @@
+/*
+Package substitution constructs nucleotide substitution models and the
+character transition matrices used by the mutation functions of mesim.
+
+Nucleotides are encoded as integers in the order A=0, C=1, G=2, T=3.
+Transitions are A<->G and C<->T; all other changes are transversions.
+*/
+package substitution
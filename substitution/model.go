@@ -0,0 +1,332 @@
+package substitution
+
+import (
+	"fmt"
+	"math"
+	"mesim/utils"
+	"strings"
+)
+
+// Nucleotide characters in the order used by every model of this package.
+const (
+	A = iota
+	C
+	G
+	T
+)
+
+// NumNucleotides is the number of characters of a nucleotide model.
+const NumNucleotides = 4
+
+// tolerance is the absolute error allowed when checking that
+// probabilities sum to one.
+const tolerance = 1e-9
+
+// Model is a time-reversible nucleotide substitution model.
+//
+// Q is the instantaneous rate matrix, scaled so that the mean rate of
+// substitution at equilibrium is one. Frequencies are the equilibrium base
+// frequencies.
+type Model struct {
+	Name        string
+	Q           [][]float64
+	Frequencies []float64
+}
+
+// Params holds the parameters of the named models accepted by New.
+// Parameters that a model does not use are ignored.
+type Params struct {
+	// Kappa is the transition/transversion rate ratio of K80 and HKY85.
+	Kappa float64
+	// KappaR and KappaY are the purine (A<->G) and pyrimidine (C<->T)
+	// transition/transversion rate ratios of TN93.
+	KappaR float64
+	KappaY float64
+	// Frequencies are the equilibrium base frequencies of HKY85, TN93
+	// and GTR. If nil, equal frequencies are used.
+	Frequencies []float64
+	// Exchangeabilities are the GTR exchangeabilities in the order
+	// AC, AG, AT, CG, CT, GT.
+	Exchangeabilities []float64
+}
+
+// New returns the model with the given name (JC69, K80, HKY85, TN93 or
+// GTR, case insensitive) parameterised by p.
+func New(name string, p Params) (*Model, error) {
+	freqs := p.Frequencies
+	if freqs == nil {
+		freqs = equalFrequencies()
+	}
+	if err := validateFrequencies(freqs); err != nil {
+		return nil, err
+	}
+	switch strings.ToUpper(name) {
+	case "JC69", "JC":
+		return JC69(), nil
+	case "K80", "K2P":
+		if p.Kappa <= 0 {
+			return nil, fmt.Errorf("substitution: kappa must be greater than zero, got %v", p.Kappa)
+		}
+		return K80(p.Kappa), nil
+	case "HKY85", "HKY":
+		if p.Kappa <= 0 {
+			return nil, fmt.Errorf("substitution: kappa must be greater than zero, got %v", p.Kappa)
+		}
+		return HKY85(p.Kappa, freqs), nil
+	case "TN93":
+		if p.KappaR <= 0 || p.KappaY <= 0 {
+			return nil, fmt.Errorf("substitution: kappaR and kappaY must be greater than zero, got %v and %v", p.KappaR, p.KappaY)
+		}
+		return TN93(p.KappaR, p.KappaY, freqs), nil
+	case "GTR":
+		if err := validateExchangeabilities(p.Exchangeabilities); err != nil {
+			return nil, err
+		}
+		return GTR(p.Exchangeabilities, freqs), nil
+	}
+	return nil, fmt.Errorf("substitution: unknown model %q", name)
+}
+
+// JC69 returns the Jukes-Cantor model with equal rates and frequencies.
+func JC69() *Model {
+	return newModel("JC69", []float64{1, 1, 1, 1, 1, 1}, equalFrequencies())
+}
+
+// K80 returns the Kimura two-parameter model with transition/transversion
+// rate ratio kappa and equal frequencies.
+func K80(kappa float64) *Model {
+	if kappa <= 0 {
+		panic("kappa must be greater than zero")
+	}
+	return newModel("K80", []float64{1, kappa, 1, 1, kappa, 1}, equalFrequencies())
+}
+
+// HKY85 returns the Hasegawa-Kishino-Yano model with transition/transversion
+// rate ratio kappa and the given base frequencies.
+func HKY85(kappa float64, freqs []float64) *Model {
+	if kappa <= 0 {
+		panic("kappa must be greater than zero")
+	}
+	return newModel("HKY85", []float64{1, kappa, 1, 1, kappa, 1}, freqs)
+}
+
+// TN93 returns the Tamura-Nei model with separate purine (kappaR) and
+// pyrimidine (kappaY) transition/transversion rate ratios and the given
+// base frequencies.
+func TN93(kappaR, kappaY float64, freqs []float64) *Model {
+	if kappaR <= 0 || kappaY <= 0 {
+		panic("kappaR and kappaY must be greater than zero")
+	}
+	return newModel("TN93", []float64{1, kappaR, 1, 1, kappaY, 1}, freqs)
+}
+
+// GTR returns the general time-reversible model with the given
+// exchangeabilities, in the order AC, AG, AT, CG, CT, GT, and base
+// frequencies.
+func GTR(exchangeabilities []float64, freqs []float64) *Model {
+	if err := validateExchangeabilities(exchangeabilities); err != nil {
+		panic(err.Error())
+	}
+	return newModel("GTR", exchangeabilities, freqs)
+}
+
+// newModel builds the normalised rate matrix from exchangeabilities
+// and base frequencies.
+func newModel(name string, exchangeabilities []float64, freqs []float64) *Model {
+	if err := validateFrequencies(freqs); err != nil {
+		panic(err.Error())
+	}
+	// Pairs in the order of the exchangeabilities
+	pairs := [][2]int{{A, C}, {A, G}, {A, T}, {C, G}, {C, T}, {G, T}}
+	q := make([][]float64, NumNucleotides)
+	for i := range q {
+		q[i] = make([]float64, NumNucleotides)
+	}
+	for k, pair := range pairs {
+		i, j := pair[0], pair[1]
+		q[i][j] = exchangeabilities[k] * freqs[j]
+		q[j][i] = exchangeabilities[k] * freqs[i]
+	}
+	meanRate := 0.0
+	for i := range q {
+		rowSum := 0.0
+		for j := range q[i] {
+			if i != j {
+				rowSum += q[i][j]
+			}
+		}
+		q[i][i] = -rowSum
+		meanRate += freqs[i] * rowSum
+	}
+	for i := range q {
+		for j := range q[i] {
+			q[i][j] /= meanRate
+		}
+	}
+	frequencies := make([]float64, len(freqs))
+	copy(frequencies, freqs)
+	return &Model{Name: name, Q: q, Frequencies: frequencies}
+}
+
+// RateMatrix returns a copy of the instantaneous rate matrix Q.
+func (m *Model) RateMatrix() [][]float64 {
+	q := make([][]float64, len(m.Q))
+	for i := range m.Q {
+		q[i] = make([]float64, len(m.Q[i]))
+		copy(q[i], m.Q[i])
+	}
+	return q
+}
+
+// JumpMatrix returns the transition matrix of the embedded jump chain of
+// the model: the probability that a character changes into each of the
+// other characters given that it changes. The diagonal is zero and every
+// row sums to one, so the matrix can be passed directly as the rate matrix
+// of MutateSeqSpace and MutateSeqFast.
+func (m *Model) JumpMatrix() [][]float64 {
+	return JumpMatrix(m.Q)
+}
+
+// JumpMatrix converts an instantaneous rate matrix into the transition
+// matrix of its embedded jump chain.
+func JumpMatrix(q [][]float64) [][]float64 {
+	p := make([][]float64, len(q))
+	for i := range q {
+		p[i] = make([]float64, len(q[i]))
+		exitRate := -q[i][i]
+		if exitRate <= 0 {
+			panic("Diagonal of the rate matrix must be negative")
+		}
+		for j := range q[i] {
+			if i != j {
+				p[i][j] = q[i][j] / exitRate
+			}
+		}
+	}
+	return p
+}
+
+// TransitionMatrix returns the matrix of substitution probabilities
+// P(t) = exp(Qt) over a branch of length t, measured in expected
+// substitutions per site.
+func (m *Model) TransitionMatrix(t float64) [][]float64 {
+	return TransitionMatrix(m.Q, t)
+}
+
+// TransitionMatrix returns P(t) = exp(Qt) for the instantaneous rate
+// matrix q. Row i of P(t) is the distribution of the character at the end
+// of a branch of length t given that it started as character i.
+func TransitionMatrix(q [][]float64, t float64) [][]float64 {
+	if err := ValidateRateMatrix(q); err != nil {
+		panic(err.Error())
+	}
+	if t < 0 {
+		panic("Branch length must not be negative")
+	}
+	p := utils.MatExp(utils.MatScale(q, t))
+	// Remove round-off so that rows are proper distributions
+	for i := range p {
+		sum := 0.0
+		for j := range p[i] {
+			if p[i][j] < 0 {
+				p[i][j] = 0
+			}
+			sum += p[i][j]
+		}
+		for j := range p[i] {
+			p[i][j] /= sum
+		}
+	}
+	return p
+}
+
+// ValidateRateMatrix checks that q is an instantaneous rate matrix: it
+// must be square, have non-negative off-diagonal entries, and rows that
+// sum to zero.
+func ValidateRateMatrix(q [][]float64) error {
+	if len(q) == 0 {
+		return fmt.Errorf("substitution: rate matrix must have one or more rows")
+	}
+	for i, row := range q {
+		if len(row) != len(q) {
+			return fmt.Errorf("substitution: rate matrix must be square, row %d has %d columns", i, len(row))
+		}
+		sum := 0.0
+		scale := 0.0
+		for j, v := range row {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("substitution: entry (%d, %d) must be a number, got %v", i, j, v)
+			}
+			if i != j && v < 0 {
+				return fmt.Errorf("substitution: off-diagonal entry (%d, %d) must not be negative, got %v", i, j, v)
+			}
+			sum += v
+			scale += math.Abs(v)
+		}
+		if math.Abs(sum) > tolerance*math.Max(scale, 1) {
+			return fmt.Errorf("substitution: row %d must sum to zero, got %v", i, sum)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the given matrix can be used as a zero-diagonal
+// character transition matrix: it must be square, have a zero diagonal,
+// non-negative entries, and rows that sum to one.
+func Validate(matrix [][]float64) error {
+	if len(matrix) == 0 {
+		return fmt.Errorf("substitution: matrix must have one or more rows")
+	}
+	for i, row := range matrix {
+		if len(row) != len(matrix) {
+			return fmt.Errorf("substitution: matrix must be square, row %d has %d columns", i, len(row))
+		}
+		sum := 0.0
+		for j, v := range row {
+			if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("substitution: entry (%d, %d) must be a non-negative number, got %v", i, j, v)
+			}
+			if i == j && v != 0 {
+				return fmt.Errorf("substitution: diagonal entry (%d, %d) must be zero, got %v", i, j, v)
+			}
+			sum += v
+		}
+		if math.Abs(sum-1) > tolerance {
+			return fmt.Errorf("substitution: row %d must sum to one, got %v", i, sum)
+		}
+	}
+	return nil
+}
+
+func equalFrequencies() []float64 {
+	return []float64{0.25, 0.25, 0.25, 0.25}
+}
+
+func validateFrequencies(freqs []float64) error {
+	if len(freqs) != NumNucleotides {
+		return fmt.Errorf("substitution: expected %d base frequencies, got %d", NumNucleotides, len(freqs))
+	}
+	sum := 0.0
+	for _, f := range freqs {
+		if f <= 0 {
+			return fmt.Errorf("substitution: base frequencies must be greater than zero, got %v", freqs)
+		}
+		sum += f
+	}
+	if math.Abs(sum-1) > tolerance {
+		return fmt.Errorf("substitution: base frequencies must sum to one, got %v", sum)
+	}
+	return nil
+}
+
+func validateExchangeabilities(exchangeabilities []float64) error {
+	if len(exchangeabilities) != 6 {
+		return fmt.Errorf("substitution: expected 6 exchangeabilities, got %d", len(exchangeabilities))
+	}
+	for _, e := range exchangeabilities {
+		if e <= 0 {
+			return fmt.Errorf("substitution: exchangeabilities must be greater than zero, got %v", exchangeabilities)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package substitution
+
+import (
+	"math"
+	"testing"
+)
+
+func TestJC69JumpMatrix(t *testing.T) {
+	p := JC69().JumpMatrix()
+	for i := range p {
+		for j := range p[i] {
+			expected := 1 / float64(3)
+			if i == j {
+				expected = 0
+			}
+			if math.Abs(p[i][j]-expected) > 1e-12 {
+				t.Errorf("JC69().JumpMatrix(): expected %v at (%d, %d), actual %v", expected, i, j, p[i][j])
+			}
+		}
+	}
+	if err := Validate(p); err != nil {
+		t.Errorf("Validate(JC69().JumpMatrix()): expected no error, actual %v", err)
+	}
+}
+
+func TestK80JumpMatrix(t *testing.T) {
+	p := K80(2).JumpMatrix()
+	expected := []float64{0, 0.25, 0.5, 0.25}
+	for j := range expected {
+		if math.Abs(p[A][j]-expected[j]) > 1e-12 {
+			t.Errorf("K80(2).JumpMatrix(): expected row A %v, actual %v", expected, p[A])
+			break
+		}
+	}
+}
+
+func TestModelMeanRate(t *testing.T) {
+	freqs := []float64{0.1, 0.2, 0.3, 0.4}
+	models := []*Model{
+		JC69(),
+		K80(3),
+		HKY85(3, freqs),
+		TN93(2, 5, freqs),
+		GTR([]float64{1, 2, 3, 4, 5, 6}, freqs),
+	}
+	for _, m := range models {
+		meanRate := 0.0
+		for i := range m.Q {
+			meanRate -= m.Frequencies[i] * m.Q[i][i]
+			// Detailed balance
+			for j := range m.Q {
+				if math.Abs(m.Frequencies[i]*m.Q[i][j]-m.Frequencies[j]*m.Q[j][i]) > 1e-12 {
+					t.Errorf("%s: expected detailed balance at (%d, %d)", m.Name, i, j)
+				}
+			}
+		}
+		if math.Abs(meanRate-1) > 1e-12 {
+			t.Errorf("%s: expected mean rate 1, actual %v", m.Name, meanRate)
+		}
+		if err := Validate(m.JumpMatrix()); err != nil {
+			t.Errorf("Validate(%s.JumpMatrix()): expected no error, actual %v", m.Name, err)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	m, err := New("hky85", Params{Kappa: 4, Frequencies: []float64{0.1, 0.2, 0.3, 0.4}})
+	if err != nil || m.Name != "HKY85" {
+		t.Errorf("New(\"hky85\", ...): expected HKY85 model, actual %v, %v", m, err)
+	}
+	if _, err := New("F81X", Params{}); err == nil {
+		t.Errorf("New(\"F81X\", ...): expected error for unknown model")
+	}
+	if _, err := New("K80", Params{}); err == nil {
+		t.Errorf("New(\"K80\", ...): expected error for missing kappa")
+	}
+	if _, err := New("GTR", Params{Exchangeabilities: []float64{1, 2, 3}}); err == nil {
+		t.Errorf("New(\"GTR\", ...): expected error for wrong number of exchangeabilities")
+	}
+	if _, err := New("HKY85", Params{Kappa: 2, Frequencies: []float64{0.5, 0.5, 0.5, 0.5}}); err == nil {
+		t.Errorf("New(\"HKY85\", ...): expected error for frequencies that do not sum to one")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	invalid := [][][]float64{
+		{},
+		{{0, 1}, {1, 0}, {1, 0}},
+		{{0.5, 0.5}, {1, 0}},
+		{{0, 0.9}, {1, 0}},
+		{{0, -1, 2}, {0.5, 0, 0.5}, {0.5, 0.5, 0}},
+	}
+	for _, matrix := range invalid {
+		if err := Validate(matrix); err == nil {
+			t.Errorf("Validate(%v): expected error", matrix)
+		}
+	}
+}
+
+func TestTransitionMatrixJC69(t *testing.T) {
+	// Closed form of the Jukes-Cantor model
+	for _, branchLength := range []float64{0, 0.01, 0.5, 2, 50} {
+		p := JC69().TransitionMatrix(branchLength)
+		same := 0.25 + 0.75*math.Exp(-4*branchLength/3)
+		diff := 0.25 - 0.25*math.Exp(-4*branchLength/3)
+		for i := range p {
+			for j := range p[i] {
+				expected := diff
+				if i == j {
+					expected = same
+				}
+				if math.Abs(p[i][j]-expected) > 1e-10 {
+					t.Errorf("JC69().TransitionMatrix(%v): expected %v at (%d, %d), actual %v", branchLength, expected, i, j, p[i][j])
+				}
+			}
+		}
+	}
+}
+
+func TestTransitionMatrixStationary(t *testing.T) {
+	freqs := []float64{0.1, 0.2, 0.3, 0.4}
+	p := GTR([]float64{1, 2, 3, 4, 5, 6}, freqs).TransitionMatrix(100)
+	for i := range p {
+		for j := range p[i] {
+			if math.Abs(p[i][j]-freqs[j]) > 1e-8 {
+				t.Errorf("GTR(...).TransitionMatrix(100): expected row %d to converge to %v, actual %v", i, freqs, p[i])
+				break
+			}
+		}
+	}
+}
+
+func TestValidateRateMatrix(t *testing.T) {
+	if err := ValidateRateMatrix(JC69().Q); err != nil {
+		t.Errorf("ValidateRateMatrix(JC69().Q): expected no error, actual %v", err)
+	}
+	invalid := [][][]float64{
+		{},
+		{{-1, 1}, {1, -1}, {0, 0}},
+		{{-1, 1}, {1, 0}},
+		{{1, -1}, {-1, 1}},
+	}
+	for _, q := range invalid {
+		if err := ValidateRateMatrix(q); err == nil {
+			t.Errorf("ValidateRateMatrix(%v): expected error", q)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package mesim
+
+import (
+	"fmt"
+	"mesim/sampler"
+	"mesim/utils"
+	"strings"
+	"sync"
+)
+
+// HostState is the epidemiological state of a host.
+type HostState int
+
+const (
+	// Susceptible hosts can be infected.
+	Susceptible HostState = iota
+	// Infected hosts carry a within-host population and can infect others.
+	Infected
+	// Recovered hosts have cleared the infection and cannot be infected
+	// again.
+	Recovered
+)
+
+func (state HostState) String() string {
+	switch state {
+	case Susceptible:
+		return "susceptible"
+	case Infected:
+		return "infected"
+	case Recovered:
+		return "recovered"
+	}
+	return "unknown"
+}
+
+// Host is one host of an epidemic. While the host is infected, Simulation
+// evolves its within-host population; it is nil before infection and
+// after recovery.
+type Host struct {
+	ID         int
+	State      HostState
+	Simulation *Simulation
+
+	// Source is the host this host was infected by, or -1 for an index
+	// case or a host that was never infected.
+	Source      int
+	InfectedAt  int
+	RecoveredAt int
+}
+
+// ContactNetwork decides which hosts can infect which.
+type ContactNetwork interface {
+	// Contacts returns the hosts the given host is in contact with in the
+	// given generation.
+	Contacts(host, generation int) []int
+}
+
+// StaticNetwork is a contact network that does not change over time.
+// Neighbors[i] holds the contacts of host i.
+type StaticNetwork struct {
+	Neighbors [][]int
+}
+
+// Contacts implements ContactNetwork.
+func (n *StaticNetwork) Contacts(host, generation int) []int {
+	if host >= len(n.Neighbors) {
+		return nil
+	}
+	return n.Neighbors[host]
+}
+
+// TransmissionEvent records the infection of Target by Source, or the
+// seeding of an index case if Source is -1.
+type TransmissionEvent struct {
+	Generation int
+	Source     int
+	Target     int
+	// FounderIDs holds the IDs of the transmitted genomes in the
+	// within-host population of the source.
+	FounderIDs []int
+}
+
+// Epidemic simulates the spread of a pathogen between hosts, each of
+// which carries a within-host population that evolves with the engine of
+// its own simulation.
+//
+// Every generation, the within-host populations of all infected hosts
+// advance one generation in parallel. Then every host that was infected
+// before the generation started contacts other hosts: the hosts given by
+// Network, or, if Network is nil, a Poisson number of hosts with mean
+// ContactRate chosen uniformly at random. A network that knows its number
+// of hosts, such as a TemporalNetwork, must have as many hosts as the
+// epidemic. Each contact with a susceptible host infects it with
+// probability TransmissionProbability, and a uniformly drawn sample of
+// Bottleneck genomes of the source, drawn without replacement, founds its
+// within-host population. Finally, these hosts recover with probability
+// RecoveryRate. Hosts whose within-host population goes extinct recover
+// as well.
+//
+// NewWithinHost creates the simulation of a newly infected host from its
+// founders. Its demography typically lets the founders grow to the
+// within-host population size; if it has none, the population keeps the
+// size of the founders. It must return a new simulation for every host,
+// since hosts advance in parallel like the demes of a Metapopulation, with
+// the same restrictions on what they may share. Founder populations draw
+// from samplers split off Sampler, which also drives transmission; if
+// Sampler is nil, sampler.Default is used.
+type Epidemic struct {
+	Hosts                   []*Host
+	Network                 ContactNetwork
+	ContactRate             float64
+	TransmissionProbability float64
+	RecoveryRate            float64
+	Bottleneck              int
+	NewWithinHost           func(founders *Population) *Simulation
+	Sampler                 *sampler.Sampler
+
+	// Events records every transmission in the order it happened.
+	Events []TransmissionEvent
+	// Generation is the current generation of the epidemic.
+	Generation int
+}
+
+// NewEpidemic creates an epidemic among numHosts susceptible hosts in a
+// well-mixed population. Use Infect to seed index cases.
+func NewEpidemic(s *sampler.Sampler, numHosts int, contactRate, transmissionProbability, recoveryRate float64, bottleneck int, newWithinHost func(founders *Population) *Simulation) *Epidemic {
+	if numHosts < 1 {
+		panic("Number of hosts must be greater than zero")
+	}
+	if contactRate < 0 {
+		panic("Contact rate must not be negative")
+	}
+	if transmissionProbability < 0 || transmissionProbability > 1 || recoveryRate < 0 || recoveryRate > 1 {
+		panic("Probabilities must be in the range [0, 1]")
+	}
+	if bottleneck < 1 {
+		panic("Bottleneck must be greater than zero")
+	}
+	e := &Epidemic{
+		Hosts:                   make([]*Host, numHosts),
+		ContactRate:             contactRate,
+		TransmissionProbability: transmissionProbability,
+		RecoveryRate:            recoveryRate,
+		Bottleneck:              bottleneck,
+		NewWithinHost:           newWithinHost,
+		Sampler:                 s,
+	}
+	for i := range e.Hosts {
+		e.Hosts[i] = &Host{ID: i, Source: -1}
+	}
+	return e
+}
+
+// rng returns the sampler used for transmission.
+func (e *Epidemic) rng() *sampler.Sampler {
+	if e.Sampler == nil {
+		return sampler.Default
+	}
+	return e.Sampler
+}
+
+// Infect makes the given host an index case whose within-host population
+// is founded by pop.
+func (e *Epidemic) Infect(host int, pop *Population) {
+	if e.Hosts[host].State != Susceptible {
+		panic("Only susceptible hosts can be infected")
+	}
+	founderIDs := utils.DeepCopyInts(pop.IDs)
+	e.infect(-1, host, pop, founderIDs)
+}
+
+// infect starts the infection of target with the given founders.
+func (e *Epidemic) infect(source, target int, founders *Population, founderIDs []int) {
+	if founders.Sampler == nil {
+		founders.Sampler = e.rng().Split()
+	}
+	host := e.Hosts[target]
+	host.State = Infected
+	host.Simulation = e.NewWithinHost(founders)
+	if host.Simulation.Demography == nil {
+		host.Simulation.Demography = NewConstantDemography(founders.Size())
+	}
+	host.Source = source
+	host.InfectedAt = e.Generation
+	e.Events = append(e.Events, TransmissionEvent{
+		Generation: e.Generation,
+		Source:     source,
+		Target:     target,
+		FounderIDs: founderIDs,
+	})
+}
+
+// endInfection ends the infection of the given host.
+func (e *Epidemic) endInfection(host *Host) {
+	host.State = Recovered
+	host.Simulation = nil
+	host.RecoveredAt = e.Generation
+}
+
+// transmit samples founders from the within-host population of source and
+// infects target with them.
+func (e *Epidemic) transmit(s *sampler.Sampler, source, target int) {
+	pop := e.Hosts[source].Simulation.Population
+	n := e.Bottleneck
+	if n > pop.Size() {
+		n = pop.Size()
+	}
+	chosen := s.Perm(pop.Size())[:n]
+	founderIDs := make([]int, n)
+	for k, i := range chosen {
+		founderIDs[k] = pop.IDs[i]
+	}
+	founders := pop.founders(chosen)
+	e.infect(source, target, founders, founderIDs)
+}
+
+// founders returns a new population made of copies of the individuals at
+// the given indices. Like Copy, it keeps the site rates and the tracked
+// alignment, but the founders get fresh IDs and no parents, as in
+// NewPopulation.
+func (pop *Population) founders(indices []int) *Population {
+	newPop := &Population{
+		Sequences: make([][]int, len(indices)),
+		NumChars:  pop.NumChars,
+		NumSites:  pop.NumSites,
+		IDs:       make([]int, len(indices)),
+		ParentIDs: make([]int, len(indices)),
+		SiteRates: copyFloats(pop.SiteRates),
+	}
+	if pop.Columns != nil {
+		newPop.Columns = make([][]int, len(indices))
+		newPop.columnOrder = utils.DeepCopyInts(pop.columnOrder)
+	}
+	for k, i := range indices {
+		newPop.Sequences[k] = utils.DeepCopyInts(pop.Sequences[i])
+		if pop.Columns != nil {
+			newPop.Columns[k] = utils.DeepCopyInts(pop.Columns[i])
+		}
+		newPop.IDs[k] = newPop.newID()
+		newPop.ParentIDs[k] = -1
+	}
+	newPop.InvalidateFitness()
+	return newPop
+}
+
+// Infected returns the IDs of the infected hosts.
+func (e *Epidemic) Infected() []int {
+	var infected []int
+	for _, host := range e.Hosts {
+		if host.State == Infected {
+			infected = append(infected, host.ID)
+		}
+	}
+	return infected
+}
+
+// Counts returns the number of susceptible, infected and recovered hosts.
+func (e *Epidemic) Counts() (susceptible, infected, recovered int) {
+	for _, host := range e.Hosts {
+		switch host.State {
+		case Susceptible:
+			susceptible++
+		case Infected:
+			infected++
+		case Recovered:
+			recovered++
+		}
+	}
+	return
+}
+
+// Step advances the epidemic by one generation.
+func (e *Epidemic) Step() {
+	if n, ok := e.Network.(interface{ NumHosts() int }); ok && n.NumHosts() != len(e.Hosts) {
+		panic("Network must have as many hosts as the epidemic")
+	}
+	s := e.rng()
+	infected := e.Infected()
+	var wg sync.WaitGroup
+	for _, id := range infected {
+		wg.Add(1)
+		go func(sim *Simulation) {
+			defer wg.Done()
+			sim.Step()
+		}(e.Hosts[id].Simulation)
+	}
+	wg.Wait()
+	e.Generation++
+
+	var spreaders []int
+	for _, id := range infected {
+		if e.Hosts[id].Simulation.Population.Size() == 0 {
+			e.endInfection(e.Hosts[id])
+		} else {
+			spreaders = append(spreaders, id)
+		}
+	}
+	for _, id := range spreaders {
+		for _, contact := range e.contacts(s, id) {
+			if e.Hosts[contact].State == Susceptible && s.Float64() < e.TransmissionProbability {
+				e.transmit(s, id, contact)
+			}
+		}
+	}
+	for _, id := range spreaders {
+		if s.Float64() < e.RecoveryRate {
+			e.endInfection(e.Hosts[id])
+		}
+	}
+}
+
+// contacts returns the hosts the given host contacts in the current
+// generation.
+func (e *Epidemic) contacts(s *sampler.Sampler, host int) []int {
+	if e.Network != nil {
+		contacts := e.Network.Contacts(host, e.Generation)
+		for _, contact := range contacts {
+			if contact < 0 || contact >= len(e.Hosts) {
+				panic("Contacts must be hosts of the epidemic")
+			}
+		}
+		return contacts
+	}
+	if len(e.Hosts) < 2 {
+		return nil
+	}
+	contacts := make([]int, s.PoissonSample(e.ContactRate))
+	for k := range contacts {
+		// Any host but the host itself
+		contacts[k] = s.Intn(len(e.Hosts) - 1)
+		if contacts[k] >= host {
+			contacts[k]++
+		}
+	}
+	return contacts
+}
+
+// Run advances the epidemic by the given number of generations, or until
+// no host is infected. It returns the number of generations run.
+func (e *Epidemic) Run(numGenerations int) int {
+	for k := 0; k < numGenerations; k++ {
+		if len(e.Infected()) == 0 {
+			return k
+		}
+		e.Step()
+	}
+	return numGenerations
+}
+
+// SampleSequences draws up to n genomes, without replacement, from the
+// within-host population of every infected host. It returns the host of
+// every sampled genome along with a copy of the genome.
+func (e *Epidemic) SampleSequences(n int) (hosts []int, seqSpace [][]int) {
+	s := e.rng()
+	for _, id := range e.Infected() {
+		pop := e.Hosts[id].Simulation.Population
+		k := n
+		if k > pop.Size() {
+			k = pop.Size()
+		}
+		for _, i := range s.Perm(pop.Size())[:k] {
+			hosts = append(hosts, id)
+			seqSpace = append(seqSpace, utils.DeepCopyInts(pop.Sequences[i]))
+		}
+	}
+	return
+}
+
+// TransmissionTree returns the transmission tree in Newick format. Nodes
+// are labelled with host IDs, every host is the parent of the hosts it
+// infected, and branch lengths are the generations between infections.
+// Several index cases are joined at an unlabelled root.
+func (e *Epidemic) TransmissionTree() string {
+	children := make(map[int][]int)
+	var roots []int
+	for _, event := range e.Events {
+		if event.Source < 0 {
+			roots = append(roots, event.Target)
+		} else {
+			children[event.Source] = append(children[event.Source], event.Target)
+		}
+	}
+	var b strings.Builder
+	var write func(host int)
+	write = func(host int) {
+		if len(children[host]) > 0 {
+			b.WriteString("(")
+			for k, child := range children[host] {
+				if k > 0 {
+					b.WriteString(",")
+				}
+				write(child)
+				fmt.Fprintf(&b, ":%d", e.Hosts[child].InfectedAt-e.Hosts[host].InfectedAt)
+			}
+			b.WriteString(")")
+		}
+		fmt.Fprintf(&b, "%d", host)
+	}
+	if len(roots) == 1 {
+		write(roots[0])
+	} else {
+		b.WriteString("(")
+		for k, root := range roots {
+			if k > 0 {
+				b.WriteString(",")
+			}
+			write(root)
+		}
+		b.WriteString(")")
+	}
+	b.WriteString(";")
+	return b.String()
+}
@@ -0,0 +1,87 @@
+package mesim
+
+import (
+	"mesim/sampler"
+	"strings"
+	"testing"
+)
+
+func newTestEpidemic(numHosts int, contactRate, recoveryRate float64) *Epidemic {
+	e := NewEpidemic(sampler.NewSampler(1), numHosts, contactRate, 1, recoveryRate, 5, func(founders *Population) *Simulation {
+		sim := NewSimulation(founders, 0, 0.01, 0, [][]float64{{0, 1}, {1, 0}}, [][]float64{{1, 1}, {1, 1}}, MultiplicativeFitness)
+		sim.Demography = NewConstantDemography(50)
+		return sim
+	})
+	seqSpace := make([][]int, 10)
+	for i := range seqSpace {
+		seqSpace[i] = []int{0, 0}
+	}
+	e.Infect(0, NewPopulation(seqSpace, 2))
+	return e
+}
+
+func TestEpidemic(t *testing.T) {
+	e := newTestEpidemic(50, 2, 0.2)
+	e.Run(100)
+	susceptible, infected, recovered := e.Counts()
+	if susceptible+infected+recovered != 50 || recovered < 10 {
+		t.Errorf("Run: expected an outbreak, actual %d susceptible, %d infected and %d recovered", susceptible, infected, recovered)
+	}
+	if len(e.Events) != infected+recovered {
+		t.Errorf("Run: expected one transmission event per infected host, actual %d events", len(e.Events))
+	}
+	for k, event := range e.Events[1:] {
+		source := e.Hosts[event.Source]
+		if event.Generation <= source.InfectedAt || (source.State == Recovered && event.Generation > source.RecoveredAt) {
+			t.Errorf("Events[%d]: expected the source to be infected at the time of transmission", k+1)
+		}
+		if len(event.FounderIDs) != 5 {
+			t.Errorf("Events[%d]: expected a bottleneck of 5 genomes, actual %d", k+1, len(event.FounderIDs))
+		}
+	}
+	tree := e.TransmissionTree()
+	if !strings.HasSuffix(tree, ")0;") || strings.Count(tree, ":") != len(e.Events)-1 {
+		t.Errorf("TransmissionTree: expected host 0 at the root of a tree of every host, actual %s", tree)
+	}
+}
+
+func TestEpidemicNetwork(t *testing.T) {
+	// Hosts on a line can only infect their right neighbour
+	e := newTestEpidemic(5, 0, 0)
+	e.Network = &StaticNetwork{Neighbors: [][]int{{1}, {2}, {3}, {4}}}
+	e.Run(10)
+	if _, infected, _ := e.Counts(); infected != 5 {
+		t.Errorf("Run: expected every host to be infected, actual %d", infected)
+	}
+	if tree := e.TransmissionTree(); tree != "((((4:1)3:1)2:1)1:1)0;" {
+		t.Errorf("TransmissionTree: expected a chain, actual %s", tree)
+	}
+	hosts, seqSpace := e.SampleSequences(3)
+	if len(hosts) != 15 || len(seqSpace) != 15 || hosts[14] != 4 {
+		t.Errorf("SampleSequences: expected 3 genomes from each of 5 hosts, actual %v", hosts)
+	}
+}
+
+func TestEpidemicWithIndels(t *testing.T) {
+	e := NewEpidemic(sampler.NewSampler(1), 20, 2, 1, 0.1, 5, func(founders *Population) *Simulation {
+		sim := NewSimulation(founders, 0, 0.01, 0, [][]float64{{0, 1}, {1, 0}}, nil, nil)
+		sim.FitnessModel = NewHouseOfCardsFitness(sampler.NewSampler(2), 0)
+		sim.Indels = NewIndelModel(0.1, 0.1, NewGeometricLength(0.5), NewGeometricLength(0.5))
+		sim.Demography = NewConstantDemography(30)
+		return sim
+	})
+	seqSpace := make([][]int, 10)
+	for i := range seqSpace {
+		seqSpace[i] = make([]int, 20)
+	}
+	e.Infect(0, NewPopulation(seqSpace, 2))
+	e.Run(30)
+	if len(e.Events) < 2 {
+		t.Fatalf("Run: expected transmissions between hosts with indels, actual %d events", len(e.Events))
+	}
+	for _, host := range e.Hosts {
+		if host.State == Infected && host.Simulation.Population.Columns == nil {
+			t.Errorf("Run: expected infected host %d to keep tracking the alignment", host.ID)
+		}
+	}
+}
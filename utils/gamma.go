@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"math"
+)
+
+// RegularizedGammaP returns the regularized lower incomplete gamma
+// function P(a, x) for a > 0 and x >= 0.
+func RegularizedGammaP(a, x float64) float64 {
+	if a <= 0 {
+		panic("Shape must be greater than zero")
+	}
+	if x <= 0 {
+		return 0
+	}
+	if math.IsInf(x, 1) {
+		return 1
+	}
+	lnPrefix := a*math.Log(x) - x - lgamma(a)
+	if x < a+1 {
+		// Series representation
+		term := 1 / a
+		sum := term
+		for n := 1; n < 1000; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-15 {
+				break
+			}
+		}
+		return sum * math.Exp(lnPrefix)
+	}
+	// Continued fraction representation of Q(a, x) by the modified
+	// Lentz method
+	tiny := 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1; n < 1000; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+	return 1 - math.Exp(lnPrefix)*h
+}
+
+// GammaQuantile returns the value x such that the cumulative distribution
+// function of a gamma distribution with the given shape and rate at x
+// equals p.
+func GammaQuantile(p, shape, rate float64) float64 {
+	if p < 0 || p > 1 {
+		panic("Probability must be in the range [0, 1]")
+	}
+	if rate <= 0 {
+		panic("Rate must be greater than zero")
+	}
+	if p == 0 {
+		return 0
+	}
+	if p == 1 {
+		return math.Inf(1)
+	}
+	// Bracket the quantile, then bisect
+	lo, hi := 0.0, shape+1
+	for RegularizedGammaP(shape, hi) < p {
+		lo = hi
+		hi *= 2
+	}
+	for i := 0; i < 200; i++ {
+		mid := (lo + hi) / 2
+		if RegularizedGammaP(shape, mid) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+		if hi-lo <= 1e-14*hi {
+			break
+		}
+	}
+	return (lo + hi) / 2 / rate
+}
+
+func lgamma(x float64) float64 {
+	v, _ := math.Lgamma(x)
+	return v
+}
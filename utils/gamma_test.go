@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRegularizedGammaP(t *testing.T) {
+	// P(1, x) is the exponential CDF
+	for _, x := range []float64{0.1, 0.5, 1, 2, 5, 10} {
+		expected := 1 - math.Exp(-x)
+		actual := RegularizedGammaP(1, x)
+		if math.Abs(expected-actual) > 1e-12 {
+			t.Errorf("RegularizedGammaP(1, %v): expected %v, actual %v", x, expected, actual)
+		}
+	}
+}
+
+func TestGammaQuantile(t *testing.T) {
+	for _, shape := range []float64{0.2, 0.5, 1, 2, 10} {
+		for _, p := range []float64{0.01, 0.25, 0.5, 0.75, 0.99} {
+			x := GammaQuantile(p, shape, shape)
+			actual := RegularizedGammaP(shape, x*shape)
+			if math.Abs(actual-p) > 1e-9 {
+				t.Errorf("GammaQuantile(%v, %v, %v): expected CDF %v at quantile, actual %v", p, shape, shape, p, actual)
+			}
+		}
+	}
+}
@@ -1,5 +1,9 @@
 package utils
 
+import (
+	"math"
+)
+
 func DivMod(numerator, denominator int) (quotient, remainder int) {
 	quotient = numerator / denominator // integer division, decimals are truncated
 	remainder = numerator % denominator
@@ -14,6 +18,26 @@ func Sum(input ...float64) (sum float64) {
 	return
 }
 
+// LogSumExp returns log(sum(exp(input))) without overflow or underflow by
+// factoring out the largest value. It returns -Inf for an empty input or
+// if every value is -Inf.
+func LogSumExp(input ...float64) float64 {
+	max := math.Inf(-1)
+	for _, x := range input {
+		if x > max {
+			max = x
+		}
+	}
+	if math.IsInf(max, 0) {
+		return max
+	}
+	sum := 0.0
+	for _, x := range input {
+		sum += math.Exp(x - max)
+	}
+	return max + math.Log(sum)
+}
+
 func ColSum(matrix [][]float64) []float64 {
 	if len(matrix) < 1 {
 		panic("Matrix must have one or more rows")
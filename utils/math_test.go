@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLogSumExp(t *testing.T) {
+	cases := []struct {
+		input    []float64
+		expected float64
+	}{
+		{[]float64{0, 0}, math.Log(2)},
+		{[]float64{math.Log(0.25), math.Log(0.75)}, 0},
+		{[]float64{-1000, -1000}, -1000 + math.Log(2)},
+		{[]float64{1000, 0}, 1000},
+		{[]float64{math.Inf(-1), math.Inf(-1)}, math.Inf(-1)},
+		{[]float64{}, math.Inf(-1)},
+	}
+	for _, c := range cases {
+		actual := LogSumExp(c.input...)
+		if math.IsInf(c.expected, -1) {
+			if !math.IsInf(actual, -1) {
+				t.Errorf("LogSumExp(%v): expected -Inf, actual %v", c.input, actual)
+			}
+			continue
+		}
+		if math.Abs(actual-c.expected) > 1e-12 {
+			t.Errorf("LogSumExp(%v): expected %v, actual %v", c.input, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"math"
+)
+
+// Identity returns the n by n identity matrix.
+func Identity(n int) [][]float64 {
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n)
+		m[i][i] = 1
+	}
+	return m
+}
+
+// MatMul returns the product of the matrices a and b.
+func MatMul(a, b [][]float64) [][]float64 {
+	if len(a) == 0 || len(a[0]) != len(b) {
+		panic("Number of columns of a must be equal to the number of rows of b")
+	}
+	c := make([][]float64, len(a))
+	for i := range a {
+		c[i] = make([]float64, len(b[0]))
+		for k, aik := range a[i] {
+			if aik == 0 {
+				continue
+			}
+			for j, bkj := range b[k] {
+				c[i][j] += aik * bkj
+			}
+		}
+	}
+	return c
+}
+
+// MatScale returns the matrix a multiplied by the scalar x.
+func MatScale(a [][]float64, x float64) [][]float64 {
+	c := make([][]float64, len(a))
+	for i := range a {
+		c[i] = make([]float64, len(a[i]))
+		for j := range a[i] {
+			c[i][j] = a[i][j] * x
+		}
+	}
+	return c
+}
+
+// MatSolve returns the matrix x that solves a x = b using Gauss-Jordan
+// elimination with partial pivoting. The matrix a must be square.
+func MatSolve(a, b [][]float64) [][]float64 {
+	n := len(a)
+	// Augmented matrix [a | b]
+	aug := make([][]float64, n)
+	for i := range a {
+		if len(a[i]) != n {
+			panic("Matrix must be square")
+		}
+		aug[i] = make([]float64, n+len(b[i]))
+		copy(aug[i], a[i])
+		copy(aug[i][n:], b[i])
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(aug[row][col]) > math.Abs(aug[pivot][col]) {
+				pivot = row
+			}
+		}
+		if aug[pivot][col] == 0 {
+			panic("Matrix is singular")
+		}
+		aug[col], aug[pivot] = aug[pivot], aug[col]
+		pivotValue := aug[col][col]
+		for j := range aug[col] {
+			aug[col][j] /= pivotValue
+		}
+		for row := 0; row < n; row++ {
+			if row == col || aug[row][col] == 0 {
+				continue
+			}
+			factor := aug[row][col]
+			for j := range aug[row] {
+				aug[row][j] -= factor * aug[col][j]
+			}
+		}
+	}
+	x := make([][]float64, n)
+	for i := range aug {
+		x[i] = aug[i][n:]
+	}
+	return x
+}
+
+// MatExp returns the matrix exponential of the square matrix a using a
+// degree 6 Padé approximant with scaling and squaring.
+func MatExp(a [][]float64) [][]float64 {
+	n := len(a)
+	// Scale a so that its infinity norm is at most 0.5
+	norm := 0.0
+	for i := range a {
+		rowSum := 0.0
+		for j := range a[i] {
+			rowSum += math.Abs(a[i][j])
+		}
+		norm = math.Max(norm, rowSum)
+	}
+	squarings := 0
+	if norm > 0.5 {
+		squarings = int(math.Ceil(math.Log2(norm / 0.5)))
+	}
+	scaled := MatScale(a, 1/math.Pow(2, float64(squarings)))
+
+	// Padé coefficients c_k = (2q-k)! q! / ((2q)! k! (q-k)!) for q = 6
+	q := 6
+	c := 1.0
+	num := Identity(n)
+	den := Identity(n)
+	power := Identity(n)
+	for k := 1; k <= q; k++ {
+		c *= float64(q-k+1) / float64(k*(2*q-k+1))
+		power = MatMul(power, scaled)
+		sign := 1.0
+		if k%2 == 1 {
+			sign = -1.0
+		}
+		for i := range power {
+			for j := range power[i] {
+				num[i][j] += c * power[i][j]
+				den[i][j] += sign * c * power[i][j]
+			}
+		}
+	}
+	result := MatSolve(den, num)
+	for i := 0; i < squarings; i++ {
+		result = MatMul(result, result)
+	}
+	return result
+}
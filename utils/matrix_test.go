@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMatExpDiagonal(t *testing.T) {
+	a := [][]float64{
+		[]float64{1, 0},
+		[]float64{0, -2},
+	}
+	expected := [][]float64{
+		[]float64{math.E, 0},
+		[]float64{0, math.Exp(-2)},
+	}
+	actual := MatExp(a)
+	for i := range expected {
+		for j := range expected[i] {
+			if math.Abs(expected[i][j]-actual[i][j]) > 1e-12 {
+				t.Errorf("MatExp(%v): expected %v, actual %v", a, expected, actual)
+			}
+		}
+	}
+}
+
+func TestMatExpTwoState(t *testing.T) {
+	// Two-state rate matrix with known solution
+	alpha, beta, time := 0.3, 0.7, 5.0
+	a := [][]float64{
+		[]float64{-alpha * time, alpha * time},
+		[]float64{beta * time, -beta * time},
+	}
+	decay := math.Exp(-(alpha + beta) * time)
+	expected := [][]float64{
+		[]float64{(beta + alpha*decay) / (alpha + beta), alpha * (1 - decay) / (alpha + beta)},
+		[]float64{beta * (1 - decay) / (alpha + beta), (alpha + beta*decay) / (alpha + beta)},
+	}
+	actual := MatExp(a)
+	for i := range expected {
+		for j := range expected[i] {
+			if math.Abs(expected[i][j]-actual[i][j]) > 1e-12 {
+				t.Errorf("MatExp(%v): expected %v, actual %v", a, expected, actual)
+			}
+		}
+	}
+}
+
+func TestMatSolve(t *testing.T) {
+	a := [][]float64{
+		[]float64{0, 2},
+		[]float64{1, 1},
+	}
+	b := [][]float64{
+		[]float64{4},
+		[]float64{3},
+	}
+	x := MatSolve(a, b)
+	if math.Abs(x[0][0]-1) > 1e-12 || math.Abs(x[1][0]-2) > 1e-12 {
+		t.Errorf("MatSolve(%v, %v): expected [[1] [2]], actual %v", a, b, x)
+	}
+}